@@ -180,18 +180,11 @@ func (d *DB) GetID(ctx context.Context, path string) (int64, error) {
 // MakeAlias takes an id (usually pid or cid), generates a 3 word id(wid), and
 // stores it in Firebase. The generated wid is returned as a string, with words comma seperated
 func (d *DB) MakeAlias(ctx context.Context, uid string, path string) (string, error) {
-
-	// get a unique ID from the distributed counter
-	aid, err := d.GetID(ctx, path)
+	wid, err := d.nextWID(ctx, path)
 	if err != nil {
 		return "", err
 	}
 
-	// convert that to a 2 word id
-	widList := tinycrypt.GenerateWord24(uint64(aid))
-	// the result is an array,so concat into a single string
-	wid := strings.Join(widList, ",")
-
 	// get the mapping collection
 	col := d.Collection(path)
 
@@ -200,7 +193,22 @@ func (d *DB) MakeAlias(ctx context.Context, uid string, path string) (string, er
 		"target": uid,
 	})
 
-	return strings.Join(widList, ","), err
+	return wid, err
+}
+
+// nextWID generates the next wid for the given alias path,
+// without storing a mapping for it.
+func (d *DB) nextWID(ctx context.Context, path string) (string, error) {
+	// get a unique ID from the distributed counter
+	aid, err := d.GetID(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	// convert that to a 2 word id
+	widList := tinycrypt.GenerateWord24(uint64(aid))
+	// the result is an array,so concat into a single string
+	return strings.Join(widList, ","), nil
 }
 
 // GetUIDFromWID returns the UID given a WID
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/labstack/echo/v4"
@@ -25,10 +26,394 @@ type Class struct {
 	Programs    []string `firestore:"programs" json:"programs"`
 	CID         string   `firestore:"CID" json:"cid"`
 	WID         string   `firestore:"WID" json:"wid"`
+	Description string   `firestore:"description" json:"description"`
+
+	// Discoverable classes can be found and previewed by
+	// users who are not members.
+	Discoverable bool `firestore:"discoverable" json:"discoverable"`
+
+	// Archived classes are no longer in use and are left
+	// out of listings.
+	Archived bool `firestore:"archived" json:"archived"`
+
+	// MaxPrograms caps the number of programs in the class
+	// library. Zero means the class is unbounded.
+	MaxPrograms int `firestore:"maxPrograms" json:"maxPrograms"`
+
+	// MaxAssignmentCodeBytes caps the size of the code of
+	// programs in the class. Zero means only MaxCodeBytes
+	// applies.
+	MaxAssignmentCodeBytes int `firestore:"maxAssignmentCodeBytes" json:"maxAssignmentCodeBytes"`
+
+	// Timezone is the IANA name of the zone the class is held
+	// in, used when scheduling. Empty means UTC.
+	Timezone string `firestore:"timezone" json:"timezone"`
+
+	// Deadlines maps the pid of a template program in the
+	// class library to when work on it is due.
+	Deadlines map[string]string `firestore:"deadlines" json:"deadlines"`
+
+	// Stats are kept up to date as members and programs are
+	// added and removed, so that they can be read cheaply.
+	Stats ClassStats `firestore:"stats" json:"stats"`
+
+	// DateCreated records when the class was created, and
+	// UpdatedAt when it was last changed after that. Empty
+	// UpdatedAt means the class has not changed since.
+	DateCreated string `firestore:"dateCreated" json:"dateCreated"`
+	UpdatedAt   string `firestore:"updatedAt" json:"updatedAt"`
 }
 
-// AddClassToUser takes a uid and a pid,
-// and adds the pid to the user's list of programs
+// ClassStats holds aggregate information about a class.
+type ClassStats struct {
+	Members      int    `firestore:"members" json:"members"`
+	Programs     int    `firestore:"programs" json:"programs"`
+	LastActivity string `firestore:"lastActivity" json:"lastActivity"`
+}
+
+// CodeLimit returns the largest a program's code may be in
+// this class, in bytes.
+func (c *Class) CodeLimit() int {
+	if c.MaxAssignmentCodeBytes > 0 && c.MaxAssignmentCodeBytes < MaxCodeBytes {
+		return c.MaxAssignmentCodeBytes
+	}
+	return MaxCodeBytes
+}
+
+// Location returns the time zone of the class, falling back
+// to UTC if it is unset or unknown.
+func (c *Class) Location() *time.Location {
+	return location(c.Timezone)
+}
+
+// Deadline returns when work on the template program with the
+// given pid is due, if the class has a deadline for it.
+func (c *Class) Deadline(pid string) (time.Time, bool) {
+	d, ok := c.Deadlines[pid]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(TimestampLayout, d)
+	return t, err == nil
+}
+
+// ClassSummary is a lightweight view of a Class, suitable
+// for listings where the full member and program lists
+// are not needed.
+type ClassSummary struct {
+	CID       string `json:"cid"`
+	WID       string `json:"wid"`
+	Name      string `json:"name"`
+	Thumbnail int64  `json:"thumbnail"`
+	Members   int    `json:"members"`
+	Programs  int    `json:"programs"`
+}
+
+// Summary returns the ClassSummary of the class.
+func (c *Class) Summary() ClassSummary {
+	return ClassSummary{
+		CID:       c.CID,
+		WID:       c.WID,
+		Name:      c.Name,
+		Thumbnail: c.Thumbnail,
+		Members:   len(c.Members),
+		Programs:  len(c.Programs),
+	}
+}
+
+// IsInstructor returns whether the user with the given
+// uid is an instructor of the class.
+func (c *Class) IsInstructor(uid string) bool {
+	for _, i := range c.Instructors {
+		if i == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMember returns whether the user with the given uid
+// is a member of the class.
+func (c *Class) IsMember(uid string) bool {
+	for _, m := range c.Members {
+		if m == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAccess returns whether the user with the given uid may
+// view the class: its creator, instructors, and members.
+func (c *Class) HasAccess(uid string) bool {
+	return c.Creator == uid || c.IsInstructor(uid) || c.IsMember(uid)
+}
+
+// HasProgram returns whether the program with the given
+// pid is in the class library.
+func (c *Class) HasProgram(pid string) bool {
+	for _, p := range c.Programs {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returned by MoveClassProgram when a move is not
+// possible given the classes as they are.
+var (
+	ErrProgramNotInClass = errors.New("program is not in the source class library")
+	ErrProgramInClass    = errors.New("program is already in the destination class library")
+	ErrClassFull         = errors.New("destination class does not have room for the program")
+)
+
+// HasRoomFor returns whether n more programs can be added
+// to the class library without exceeding MaxPrograms.
+func (c *Class) HasRoomFor(n int) bool {
+	return c.MaxPrograms == 0 || len(c.Programs)+n <= c.MaxPrograms
+}
+
+// RebuildStats recomputes the member and program counts of
+// the class from scratch.
+func (c *Class) RebuildStats() {
+	c.Stats.Members = len(c.Members)
+	c.Stats.Programs = len(c.Programs)
+}
+
+// ClassUpdate is a partial Class, as given to UpdateClass.
+// Discoverable and Archived are pointers so that they can be
+// cleared as well as set; they are left unchanged when nil.
+type ClassUpdate struct {
+	Class
+	Discoverable *bool `json:"discoverable"`
+	Archived     *bool `json:"archived"`
+}
+
+// classField is a field of a Class that UpdateClass may write.
+// field returns a pointer to it in the given class, and flag,
+// for boolean fields, returns whether an update sets it.
+type classField struct {
+	path  string
+	field func(c *Class) interface{}
+	flag  func(u *ClassUpdate) *bool
+}
+
+// classFields lists every field UpdateClass may write, in the
+// order they are written. The CID, stats, and timestamps are
+// not among them.
+var classFields = []classField{
+	{path: "thumbnail", field: func(c *Class) interface{} { return &c.Thumbnail }},
+	{path: "name", field: func(c *Class) interface{} { return &c.Name }},
+	{path: "creator", field: func(c *Class) interface{} { return &c.Creator }},
+	{path: "instructors", field: func(c *Class) interface{} { return &c.Instructors }},
+	{path: "members", field: func(c *Class) interface{} { return &c.Members }},
+	{path: "programs", field: func(c *Class) interface{} { return &c.Programs }},
+	{path: "WID", field: func(c *Class) interface{} { return &c.WID }},
+	{path: "description", field: func(c *Class) interface{} { return &c.Description }},
+	{
+		path:  "discoverable",
+		field: func(c *Class) interface{} { return &c.Discoverable },
+		flag:  func(u *ClassUpdate) *bool { return u.Discoverable },
+	},
+	{
+		path:  "archived",
+		field: func(c *Class) interface{} { return &c.Archived },
+		flag:  func(u *ClassUpdate) *bool { return u.Archived },
+	},
+	{path: "maxPrograms", field: func(c *Class) interface{} { return &c.MaxPrograms }},
+	{path: "maxAssignmentCodeBytes", field: func(c *Class) interface{} { return &c.MaxAssignmentCodeBytes }},
+	{path: "timezone", field: func(c *Class) interface{} { return &c.Timezone }},
+	{path: "deadlines", field: func(c *Class) interface{} { return &c.Deadlines }},
+}
+
+// value returns the value of the field in the update, and
+// whether the update sets it. Other than boolean fields, only
+// non-zero values are set.
+func (f classField) value(u *ClassUpdate) (interface{}, bool) {
+	if f.flag != nil {
+		if b := f.flag(u); b != nil {
+			return *b, true
+		}
+		return nil, false
+	}
+	switch v := f.field(&u.Class).(type) {
+	case *int64:
+		return *v, *v != 0
+	case *int:
+		return *v, *v != 0
+	case *string:
+		return *v, *v != ""
+	case *[]string:
+		return *v, len(*v) != 0
+	case *map[string]string:
+		return *v, len(*v) != 0
+	}
+	return nil, false
+}
+
+// set sets the field of the class to v, as returned by value.
+func (f classField) set(c *Class, v interface{}) {
+	switch p := f.field(c).(type) {
+	case *int64:
+		*p = v.(int64)
+	case *int:
+		*p = v.(int)
+	case *string:
+		*p = v.(string)
+	case *bool:
+		*p = v.(bool)
+	case *[]string:
+		*p = v.([]string)
+	case *map[string]string:
+		*p = v.(map[string]string)
+	}
+}
+
+// ToFirestoreUpdate returns the []firestore.Update representation
+// of the fields set by this update. If it sets the members or
+// programs of the class, their count in the stats is set too.
+func (u *ClassUpdate) ToFirestoreUpdate() (up []firestore.Update) {
+	for _, f := range classFields {
+		if v, ok := f.value(u); ok {
+			up = append(up, firestore.Update{Path: f.path, Value: v})
+		}
+	}
+	if len(u.Members) != 0 {
+		up = append(up, firestore.Update{Path: "stats.members", Value: len(u.Members)})
+	}
+	if len(u.Programs) != 0 {
+		up = append(up, firestore.Update{Path: "stats.programs", Value: len(u.Programs)})
+	}
+	return
+}
+
+// ToFirestoreUpdate returns the []firestore.Update representation
+// of this struct. Any fields that are non-zero valued are included
+// in the update, save for the CID and the stats.
+func (c *Class) ToFirestoreUpdate() []firestore.Update {
+	return c.asUpdate().ToFirestoreUpdate()
+}
+
+// asUpdate returns the ClassUpdate setting each non-zero field
+// of the class.
+func (c *Class) asUpdate() *ClassUpdate {
+	u := &ClassUpdate{Class: *c}
+	if c.Discoverable {
+		u.Discoverable = &c.Discoverable
+	}
+	if c.Archived {
+		u.Archived = &c.Archived
+	}
+	return u
+}
+
+// merge copies the fields set by the update onto the class,
+// keeping its stats up to date, as UpdateClass does.
+func (c *Class) merge(u *ClassUpdate) {
+	for _, f := range classFields {
+		if v, ok := f.value(u); ok {
+			f.set(c, v)
+		}
+	}
+	if len(u.Members) != 0 || len(u.Programs) != 0 {
+		c.RebuildStats()
+	}
+}
+
+// touch rebuilds the stats of the class and records that
+// there was activity in it.
+func (c *Class) touch() {
+	c.RebuildStats()
+	c.Stats.LastActivity = time.Now().UTC().String()
+}
+
+// stamp records that the class is being stored now.
+func (c *Class) stamp() {
+	c.UpdatedAt = time.Now().UTC().String()
+}
+
+// without returns a copy of list with every occurrence of
+// s removed.
+func without(list []string, s string) []string {
+	res := make([]string, 0, len(list))
+	for _, e := range list {
+		if e != s {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// AddMember adds the user with the given uid to the class,
+// returning whether they were not already a member.
+func (c *Class) AddMember(uid string) bool {
+	if c.IsMember(uid) {
+		return false
+	}
+	c.Members = append(c.Members, uid)
+	c.touch()
+	return true
+}
+
+// RemoveMember removes the user with the given uid from the
+// class, returning whether they were a member.
+func (c *Class) RemoveMember(uid string) bool {
+	if !c.IsMember(uid) {
+		return false
+	}
+	c.Members = without(c.Members, uid)
+	c.touch()
+	return true
+}
+
+// AddInstructor adds the user with the given uid to the
+// class's instructors, returning whether they were not already
+// one.
+func (c *Class) AddInstructor(uid string) bool {
+	if c.IsInstructor(uid) {
+		return false
+	}
+	c.Instructors = append(c.Instructors, uid)
+	c.touch()
+	return true
+}
+
+// RemoveInstructor removes the user with the given uid from
+// the class's instructors, returning whether they were one.
+func (c *Class) RemoveInstructor(uid string) bool {
+	if !c.IsInstructor(uid) {
+		return false
+	}
+	c.Instructors = without(c.Instructors, uid)
+	c.touch()
+	return true
+}
+
+// AddProgram adds the program with the given pid to the class
+// library, returning whether it was not already there.
+func (c *Class) AddProgram(pid string) bool {
+	if c.HasProgram(pid) {
+		return false
+	}
+	c.Programs = append(c.Programs, pid)
+	c.touch()
+	return true
+}
+
+// RemoveProgram removes the program with the given pid from
+// the class library, returning whether it was there.
+func (c *Class) RemoveProgram(pid string) bool {
+	if !c.HasProgram(pid) {
+		return false
+	}
+	c.Programs = without(c.Programs, pid)
+	c.touch()
+	return true
+}
+
+// AddClassToUser takes a uid and a cid, and adds the cid
+// to the user's list of classes if it is not already there.
 func (d *DB) AddClassToUser(ctx context.Context, uid string, cid string) error {
 	//get the user doc
 	ref := d.Collection(usersPath).Doc(uid)
@@ -41,16 +426,30 @@ func (d *DB) AddClassToUser(ctx context.Context, uid string, cid string) error {
 	})
 }
 
-// AddUserToClass add an uid to a given class
+// AddUserToClass adds an uid to a given class, doing nothing
+// if the user is already a member.
 func (d *DB) AddUserToClass(ctx context.Context, uid string, cid string) error {
 	//get the class doc
 	ref := d.Collection(classesPath).Doc(cid)
 
 	//add the user id
 	return d.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		return tx.Update(ref, []firestore.Update{
-			{Path: "members", Value: firestore.ArrayUnion(uid)},
-		})
+		snap, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		class := Class{}
+		if err := snap.DataTo(&class); err != nil {
+			return err
+		}
+		if !class.AddMember(uid) {
+			return nil
+		}
+
+		return tx.Update(ref, stamped(
+			firestore.Update{Path: "members", Value: firestore.ArrayUnion(uid)},
+			firestore.Update{Path: "stats", Value: class.Stats},
+		))
 	})
 }
 
@@ -61,9 +460,47 @@ func (d *DB) RemoveUserFromClass(ctx context.Context, uid string, cid string) er
 
 	//remove the user id
 	return d.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		return tx.Update(ref, []firestore.Update{
-			{Path: "members", Value: firestore.ArrayRemove(uid)},
-		})
+		snap, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		class := Class{}
+		if err := snap.DataTo(&class); err != nil {
+			return err
+		}
+		if !class.RemoveMember(uid) {
+			return nil
+		}
+
+		return tx.Update(ref, stamped(
+			firestore.Update{Path: "members", Value: firestore.ArrayRemove(uid)},
+			firestore.Update{Path: "stats", Value: class.Stats},
+		))
+	})
+}
+
+// RemoveProgramFromClass removes a pid from the library of a
+// given class, doing nothing if it is not there.
+func (d *DB) RemoveProgramFromClass(ctx context.Context, cid string, pid string) error {
+	ref := d.Collection(classesPath).Doc(cid)
+
+	return d.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		class := Class{}
+		if err := snap.DataTo(&class); err != nil {
+			return err
+		}
+		if !class.RemoveProgram(pid) {
+			return nil
+		}
+
+		return tx.Update(ref, stamped(
+			firestore.Update{Path: "programs", Value: firestore.ArrayRemove(pid)},
+			firestore.Update{Path: "stats", Value: class.Stats},
+		))
 	})
 }
 
@@ -100,38 +537,49 @@ func (d *DB) loadClass(ctx context.Context, cid string) (*Class, error) {
 
 // CreateClass is the handler for creating a new class.
 // It takes the UID of the creator, the name of the class,
-// and a thumbnail id.
+// a thumbnail id, and optionally a description and whether
+// the class is discoverable.
+//
+// Returns 201 created with the class, and a Location header
+// naming its CID.
 func (d *DB) CreateClass(c echo.Context) error {
 	// create an anonymous structure to handle requests
 	req := struct {
-		UID       string `json:"uid"`
-		Name      string `json:"name"`
-		Thumbnail int64  `json:"thumbnail"`
+		UID          string `json:"uid"`
+		Name         string `json:"name"`
+		Thumbnail    int64  `json:"thumbnail"`
+		Description  string `json:"description"`
+		Discoverable bool   `json:"discoverable"`
 	}{}
 
 	// read JSON from request body
 	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, err.Error())
 	}
 
+	if err := ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
 	switch {
-	case req.UID == "":
-		return c.String(http.StatusBadRequest, "uid is required")
 	case req.Name == "":
-		return c.String(http.StatusBadRequest, "class name is required")
-	case req.Thumbnail < 0 || req.Thumbnail >= thumbnailCount:
-		return c.String(http.StatusBadRequest, "bad thumbnail id")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "class name is required")
+	case !ValidThumbnail(req.Thumbnail):
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "bad thumbnail id")
 	}
 
 	// structure for class info
 	class := Class{
-		Thumbnail:   req.Thumbnail,
-		Name:        req.Name,
-		Creator:     req.UID,
-		Instructors: []string{req.UID},
-		Members:     []string{},
-		Programs:    []string{},
+		Thumbnail:    req.Thumbnail,
+		Name:         req.Name,
+		Creator:      req.UID,
+		Instructors:  []string{req.UID},
+		Members:      []string{},
+		Programs:     []string{},
+		Description:  req.Description,
+		Discoverable: req.Discoverable,
 	}
+	class.touch()
+	class.DateCreated = time.Now().UTC().String()
 
 	// create a new doc for this class
 	err := d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
@@ -140,13 +588,13 @@ func (d *DB) CreateClass(c echo.Context) error {
 		return tx.Set(ref, class)
 	})
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "could not create class doc")
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, "could not create class doc")
 	}
 
 	// create an wid for this class
 	wid, err := d.MakeAlias(c.Request().Context(), class.CID, classesAliasPath)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, err.Error())
 	}
 
 	if err := d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
@@ -156,7 +604,7 @@ func (d *DB) CreateClass(c echo.Context) error {
 			{Path: "WID", Value: wid},
 		})
 	}); err != nil {
-		return c.String(http.StatusInternalServerError, "failed to create class alias")
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, "failed to create class alias")
 	}
 
 	class.WID = wid
@@ -164,16 +612,17 @@ func (d *DB) CreateClass(c echo.Context) error {
 	//add this class to the user's "Classes" list
 	err = d.AddClassToUser(c.Request().Context(), req.UID, class.CID)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "failed to join user to class")
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, "failed to join user to class")
 	}
 
 	//return the class struct in the response
-	return c.JSON(http.StatusOK, class)
+	c.Response().Header().Set(echo.HeaderLocation, "/class/get?cid="+class.CID)
+	return c.JSON(http.StatusCreated, class)
 }
 
 // JoinClass takes a UID and cid(wid) as a JSON, and attempts to
 // add the UID to the class given by cid. The updated struct of the class is returned as a
-// JSON
+// JSON. Users who are already members get a 409.
 func (d *DB) JoinClass(c echo.Context) error {
 	req := struct {
 		UID string `json:"uid"`
@@ -182,19 +631,25 @@ func (d *DB) JoinClass(c echo.Context) error {
 
 	// read JSON from request body
 	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
-		return c.String(http.StatusInternalServerError, err.Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, err.Error())
 	}
 	if req.UID == "" {
-		return c.String(http.StatusBadRequest, "uid is required")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid is required")
+	}
+	if err := ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
 	}
 	if req.CID == "" {
-		return c.String(http.StatusBadRequest, "cid is required")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "cid is required")
 	}
 
 	// get the class as a struct
 	class, err := d.loadClass(c.Request().Context(), req.CID)
 	if err != nil || class == nil {
-		return c.String(http.StatusNotFound, "class does not exist")
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "class does not exist")
+	}
+	if class.IsMember(req.UID) {
+		return httpext.Error(c, http.StatusConflict, httpext.CodeConflict, "user is already a member of the class")
 	}
 
 	// check if user exists
@@ -208,19 +663,35 @@ func (d *DB) JoinClass(c echo.Context) error {
 		}
 		return nil
 	}); err != nil {
-		return c.String(http.StatusNotFound, "user does not exist")
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "user does not exist")
 	}
 
-	// add user to the class
-	err = d.AddUserToClass(c.Request().Context(), req.UID, req.CID)
-	if err != nil {
-		return c.String(http.StatusNotFound, "failed to add user to class")
-	}
+	// add the user to the class and the class to the user
+	// together, so that a failure leaves neither behind.
+	ctx := c.Request().Context()
+	err = d.Transact(ctx, func(tx TLADB) error {
+		cls, err := tx.LoadClass(ctx, req.CID)
+		if err != nil {
+			return err
+		}
+		u, err := tx.LoadUser(ctx, req.UID)
+		if err != nil {
+			return err
+		}
 
-	// add this class to the user's "Classes" list
-	err = d.AddClassToUser(c.Request().Context(), req.UID, req.CID)
+		if cls.AddMember(req.UID) {
+			if err := tx.StoreClass(ctx, cls); err != nil {
+				return err
+			}
+		}
+		*class = cls
+		if u.AddClass(req.CID) {
+			return tx.StoreUser(ctx, u)
+		}
+		return nil
+	})
 	if err != nil {
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to add user to class list").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to add user to class").Error())
 	}
 
 	return c.JSON(http.StatusOK, class)
@@ -235,18 +706,21 @@ func (d *DB) LeaveClass(c echo.Context) error {
 	}
 
 	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
 	}
 	if req.UID == "" {
-		return c.String(http.StatusBadRequest, "uid is required")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid is required")
+	}
+	if err := ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
 	}
 	if req.CID == "" {
-		return c.String(http.StatusBadRequest, "cid is required")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "cid is required")
 	}
 
 	class, err := d.loadClass(c.Request().Context(), req.CID)
 	if err != nil || class == nil {
-		return c.String(http.StatusNotFound, "class does not exist")
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "class does not exist")
 	}
 
 	// check if user exists
@@ -259,21 +733,36 @@ func (d *DB) LeaveClass(c echo.Context) error {
 	})
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			return c.String(http.StatusNotFound, "user does not exist")
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "user does not exist")
 		}
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "unexecpted error occurred!").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "unexecpted error occurred!").Error())
 	}
 
-	// remove user from the class
-	err = d.RemoveUserFromClass(c.Request().Context(), req.UID, req.CID)
-	if err != nil {
-		return c.String(http.StatusNotFound, errors.Wrap(err, "failed to remove user from class").Error())
-	}
+	// remove the user from the class and the class from the
+	// user together, so that a failure leaves neither behind.
+	ctx := c.Request().Context()
+	err = d.Transact(ctx, func(tx TLADB) error {
+		cls, err := tx.LoadClass(ctx, req.CID)
+		if err != nil {
+			return err
+		}
+		u, err := tx.LoadUser(ctx, req.UID)
+		if err != nil {
+			return err
+		}
 
-	// remove cid from user list
-	err = d.RemoveClassFromUser(c.Request().Context(), req.UID, req.CID)
+		if cls.RemoveMember(req.UID) {
+			if err := tx.StoreClass(ctx, cls); err != nil {
+				return err
+			}
+		}
+		if u.RemoveClass(req.CID) {
+			return tx.StoreUser(ctx, u)
+		}
+		return nil
+	})
 	if err != nil {
-		return c.String(http.StatusNotFound, errors.Wrap(err, "failed to remove class ID from user").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to remove user from class").Error())
 	}
 
 	// return the latest state of the user
@@ -289,10 +778,13 @@ func (d *DB) GetClassMembers(c echo.Context) error {
 	}
 
 	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
 	}
 	if req.UID == "" || req.CID == "" {
-		return c.String(http.StatusBadRequest, "uid and cid fields are both required")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and cid fields are both required")
+	}
+	if err := ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
 	}
 	uid := req.UID
 	cid := req.CID
@@ -300,7 +792,7 @@ func (d *DB) GetClassMembers(c echo.Context) error {
 	// get the class as a struct (pointer)
 	class, err := d.loadClass(c.Request().Context(), cid)
 	if err != nil || class == nil {
-		return c.String(http.StatusInternalServerError, fmt.Sprintf("failed to get class: %s", err))
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, fmt.Sprintf("failed to get class: %s", err))
 	}
 
 	// Check if user is in class
@@ -313,7 +805,7 @@ func (d *DB) GetClassMembers(c echo.Context) error {
 	}
 
 	if !isIn {
-		return c.String(http.StatusNotFound, "given user not in class")
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "given user not in class")
 	}
 
 	res := make(map[string]User)
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strconv"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+// ErrInvalidCursor is returned when a page cursor was not
+// produced by the TLADB it is given to.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+func (d *DB) LoadClassPage(ctx context.Context, cursor string, limit int) ([]Class, string, error) {
+	q := d.Collection(classesPath).OrderBy(firestore.DocumentID, firestore.Asc)
+	if cursor != "" {
+		// the cursor holds the cid of the last class of the
+		// previous page.
+		after, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(after) == 0 {
+			return nil, "", ErrInvalidCursor
+		}
+		q = q.StartAfter(string(after))
+	}
+
+	// one extra class is read to tell whether there is a next
+	// page.
+	iter := q.Limit(limit + 1).Documents(ctx)
+	defer iter.Stop()
+	classes := make([]Class, 0, limit)
+	last, next := "", ""
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if len(classes) == limit {
+			next = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		c := Class{}
+		if err := doc.DataTo(&c); err != nil {
+			return nil, "", err
+		}
+		classes = append(classes, c)
+		last = doc.Ref.ID
+	}
+	return classes, next, nil
+}
+
+func (d *MockDB) LoadClassPage(_ context.Context, cursor string, limit int) ([]Class, string, error) {
+	if err := d.fail("LoadClassPage"); err != nil {
+		return nil, "", err
+	}
+
+	// the cursor holds the offset of the page.
+	offset := 0
+	if cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		if offset, err = strconv.Atoi(string(raw)); err != nil || offset < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	cids := make([]string, 0, len(d.db[classesPath]))
+	for cid := range d.db[classesPath] {
+		cids = append(cids, cid)
+	}
+	sort.Strings(cids)
+
+	if offset > len(cids) {
+		offset = len(cids)
+	}
+	end, next := offset+limit, ""
+	if end < len(cids) {
+		next = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	} else {
+		end = len(cids)
+	}
+
+	classes := make([]Class, 0, end-offset)
+	for _, cid := range cids[offset:end] {
+		classes = append(classes, d.db[classesPath][cid].(Class))
+	}
+	return classes, next, nil
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 
 	"testing"
 
@@ -123,7 +125,7 @@ func CreateTestClass(t *testing.T, o *TestObj, classIndex int, userIndex int) {
 		"/",
 		bytes.NewBuffer(pro),
 		o.D.CreateClass,
-		http.StatusOK,
+		http.StatusCreated,
 		true,
 	}
 	b, close := CallFunc(t, &par)
@@ -182,6 +184,206 @@ func TestCreateClass(t *testing.T) {
 	CreateTestUser(t, &obj, 0)
 	CreateTestClass(t, &obj, 0, 0)
 
+	// the last thumbnail is in range.
+	body := fmt.Sprintf(`{"uid": %q, "name": "TestClass", "thumbnail": %d}`, obj.User[0].UID, thumbnailCount-1)
+	req, rec := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), httptest.NewRecorder()
+	require.NoError(t, obj.D.CreateClass(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	// the Location header points at the new class.
+	class := Class{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &class))
+	assert.Equal(t, "/class/get?cid="+class.CID, rec.Header().Get(echo.HeaderLocation))
+
 	// DeleteTestClass(t, &obj, 0)
 	// DeleteTestUser(t, &obj, 0)
 }
+
+// Ensure joining a class twice is rejected and leaves no
+// duplicate entries behind.
+func TestJoinClass(t *testing.T) {
+	obj := TestObj{
+		nil,
+		make([]Class, 1),
+		make([]Class, 1),
+		make([]User, 2),
+	}
+
+	ptr, err := Open(context.Background(), os.Getenv("TLACFG"))
+	obj.D = ptr
+	require.NoError(t, err)
+
+	CreateTestUser(t, &obj, 0)
+	CreateTestUser(t, &obj, 1)
+	CreateTestClass(t, &obj, 0, 0)
+
+	body := fmt.Sprintf(`{"uid": %q, "cid": %q}`, obj.User[1].UID, obj.Class[0].CID)
+	_, close := CallFunc(t, &ReqParam{"PUT", "/", strings.NewReader(body), obj.D.JoinClass, http.StatusOK, false})
+	assert.NoError(t, close())
+	_, close = CallFunc(t, &ReqParam{"PUT", "/", strings.NewReader(body), obj.D.JoinClass, http.StatusConflict, false})
+	assert.NoError(t, close())
+
+	// adding again at the database level does nothing.
+	ctx := context.Background()
+	require.NoError(t, obj.D.AddUserToClass(ctx, obj.User[1].UID, obj.Class[0].CID))
+	require.NoError(t, obj.D.AddClassToUser(ctx, obj.User[1].UID, obj.Class[0].CID))
+
+	class, err := obj.D.LoadClass(ctx, obj.Class[0].CID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{obj.User[1].UID}, class.Members)
+	assert.Equal(t, 1, class.Stats.Members)
+	u, err := obj.D.LoadUser(ctx, obj.User[1].UID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{obj.Class[0].CID}, u.Classes)
+}
+
+// Out of range thumbnails are rejected before the database
+// is touched.
+func TestCreateClassThumbnail(t *testing.T) {
+	d := &DB{}
+	for _, thumbnail := range []int64{-1, thumbnailCount} {
+		body := fmt.Sprintf(`{"uid": "test", "name": "TestClass", "thumbnail": %d}`, thumbnail)
+		_, close := CallFunc(t, &ReqParam{"POST", "/", strings.NewReader(body), d.CreateClass, http.StatusBadRequest, false})
+		assert.NoError(t, close())
+	}
+}
+
+func TestClassCodeLimit(t *testing.T) {
+	t.Run("Unset", func(t *testing.T) {
+		c := Class{}
+		assert.Equal(t, MaxCodeBytes, c.CodeLimit())
+	})
+	t.Run("UnderLimit", func(t *testing.T) {
+		c := Class{MaxAssignmentCodeBytes: 20}
+		assert.LessOrEqual(t, len("print('hi')"), c.CodeLimit())
+	})
+	t.Run("OverLimit", func(t *testing.T) {
+		c := Class{MaxAssignmentCodeBytes: 20}
+		assert.Greater(t, len("print('this is far too long')"), c.CodeLimit())
+	})
+	t.Run("AboveGlobal", func(t *testing.T) {
+		c := Class{MaxAssignmentCodeBytes: MaxCodeBytes + 1}
+		assert.Equal(t, MaxCodeBytes, c.CodeLimit())
+	})
+}
+
+func TestClassHasAccess(t *testing.T) {
+	c := Class{
+		Creator:     "creator",
+		Instructors: []string{"instructor"},
+		Members:     []string{"member"},
+	}
+	for _, uid := range []string{"creator", "instructor", "member"} {
+		assert.True(t, c.HasAccess(uid), uid)
+	}
+	assert.False(t, c.HasAccess("stranger"))
+}
+
+func TestClassToFirestoreUpdate(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		c := Class{CID: "cid", Stats: ClassStats{Members: 1}}
+		assert.Empty(t, c.ToFirestoreUpdate())
+	})
+	t.Run("NonZero", func(t *testing.T) {
+		c := Class{Name: "name", Thumbnail: 3}
+		update := c.ToFirestoreUpdate()
+		require.Len(t, update, 2)
+		assert.Equal(t, "thumbnail", update[0].Path)
+		assert.EqualValues(t, 3, update[0].Value)
+		assert.Equal(t, "name", update[1].Path)
+		assert.Equal(t, "name", update[1].Value)
+	})
+	t.Run("ClearFlags", func(t *testing.T) {
+		no := false
+		u := ClassUpdate{Archived: &no}
+		update := u.ToFirestoreUpdate()
+		require.Len(t, update, 1)
+		assert.Equal(t, "archived", update[0].Path)
+		assert.Equal(t, false, update[0].Value)
+
+		c := Class{Archived: true, Discoverable: true}
+		c.merge(&u)
+		assert.False(t, c.Archived)
+		assert.True(t, c.Discoverable)
+	})
+	t.Run("Stats", func(t *testing.T) {
+		u := ClassUpdate{Class: Class{Members: []string{"a", "b"}}}
+		update := u.ToFirestoreUpdate()
+		require.Len(t, update, 2)
+		assert.Equal(t, "stats.members", update[1].Path)
+		assert.Equal(t, 2, update[1].Value)
+
+		c := Class{Programs: []string{"p"}}
+		c.merge(&u)
+		assert.Equal(t, 2, c.Stats.Members)
+		assert.Equal(t, 1, c.Stats.Programs)
+	})
+	t.Run("MergeMatches", func(t *testing.T) {
+		// merge copies exactly the fields that are written.
+		yes := true
+		u := ClassUpdate{
+			Class: Class{
+				Thumbnail:              1,
+				Name:                   "name",
+				Creator:                "creator",
+				Instructors:            []string{"i"},
+				Members:                []string{"m"},
+				Programs:               []string{"p"},
+				WID:                    "wid",
+				Description:            "description",
+				MaxPrograms:            2,
+				MaxAssignmentCodeBytes: 3,
+				Timezone:               "UTC",
+				Deadlines:              map[string]string{"p": "soon"},
+			},
+			Discoverable: &yes,
+			Archived:     &yes,
+		}
+		c := Class{}
+		c.merge(&u)
+		assert.Len(t, u.ToFirestoreUpdate(), len(classFields)+2)
+		for _, f := range classFields {
+			want, _ := f.value(&u)
+			got, ok := f.value(c.asUpdate())
+			assert.True(t, ok, f.path)
+			assert.Equal(t, want, got, f.path)
+		}
+	})
+}
+
+func TestClassStats(t *testing.T) {
+	t.Run("Joins", func(t *testing.T) {
+		c := Class{}
+		assert.True(t, c.AddMember("a"))
+		assert.True(t, c.AddMember("b"))
+		assert.False(t, c.AddMember("a"))
+		assert.Equal(t, 2, c.Stats.Members)
+		assert.NotEmpty(t, c.Stats.LastActivity)
+	})
+	t.Run("Leaves", func(t *testing.T) {
+		c := Class{}
+		c.AddMember("a")
+		c.AddMember("b")
+		assert.True(t, c.RemoveMember("a"))
+		assert.False(t, c.RemoveMember("a"))
+		assert.Equal(t, 1, c.Stats.Members)
+		assert.Equal(t, []string{"b"}, c.Members)
+	})
+	t.Run("ProgramAdds", func(t *testing.T) {
+		c := Class{}
+		assert.True(t, c.AddProgram("a"))
+		assert.False(t, c.AddProgram("a"))
+		assert.True(t, c.AddProgram("b"))
+		assert.True(t, c.RemoveProgram("a"))
+		assert.Equal(t, 1, c.Stats.Programs)
+	})
+	t.Run("Rebuild", func(t *testing.T) {
+		c := Class{
+			Members:  []string{"a", "b"},
+			Programs: []string{"c"},
+		}
+		c.RebuildStats()
+		assert.Equal(t, 2, c.Stats.Members)
+		assert.Equal(t, 1, c.Stats.Programs)
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"math/rand"
 	"os"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -20,6 +22,30 @@ const (
 	// the number of program thumbnails available to choose from.
 	thumbnailCount = 58
 
+	// TimestampLayout is the layout of the timestamps stored
+	// on documents, such as a program's DateCreated.
+	TimestampLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+	// maxBatchWrites is the most writes Firestore allows
+	// in a single batch.
+	maxBatchWrites = 500
+
+	// MaxCodeBytes is the largest a program's code may be,
+	// in bytes. Classes may impose a stricter limit.
+	MaxCodeBytes = 64 * 1024
+
+	// MaxNotesBytes is the longest a program's notes may be,
+	// in bytes.
+	MaxNotesBytes = 4 * 1024
+
+	// MaxClassNameLength is the longest a class's name may be,
+	// in runes.
+	MaxClassNameLength = 128
+
+	// MaxProgramNameLength is the longest a program's name may
+	// be, in runes.
+	MaxProgramNameLength = 128
+
 	// programsPath describes the path to the program
 	// management endpoint.
 	programsPath = "programs"
@@ -49,6 +75,21 @@ const (
 
 var EnableBetaFeatures = os.Getenv("ENABLE_BETA_FEATURES")
 
+// ProgramCreateCooldown, when set to a duration such as "3s",
+// overrides how long users must wait between creating programs.
+var ProgramCreateCooldown = os.Getenv("PROGRAM_CREATE_COOLDOWN")
+
+// DefaultProgramLanguage is the language given to programs
+// whose language is missing or unknown when they are fixed by
+// an audit. Python is used if it is unset.
+var DefaultProgramLanguage = os.Getenv("DEFAULT_PROGRAM_LANGUAGE")
+
+// UniqueDisplayNames, when "true", rejects display names that
+// are already taken by another user. Disabled by default. Run
+// the display name key backfill before enabling it, so that
+// users created before keys were kept are taken into account.
+var UniqueDisplayNames = os.Getenv("UNIQUE_DISPLAY_NAMES")
+
 func langString(langCode int) string {
 	switch langCode {
 	case python:
@@ -64,6 +105,84 @@ func langString(langCode int) string {
 	}
 }
 
+// Languages returns the names of every language, in order of
+// their codes.
+func Languages() []string {
+	names := make([]string, 0, langCount)
+	for i := python; i < langCount; i++ {
+		names = append(names, langString(i))
+	}
+	return names
+}
+
+// LanguageCode returns the code of the language with the
+// given name, or an error if there is no such language.
+func LanguageCode(language string) (int, error) {
+	for i := python; i < langCount; i++ {
+		if langString(i) == language {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("language %q does not exist", language)
+}
+
+// LanguageDefaultThumbnail returns the thumbnail index that
+// best represents the language with the given name, or an
+// error if there is no such language.
+func LanguageDefaultThumbnail(language string) (int64, error) {
+	code, err := LanguageCode(language)
+	if err != nil {
+		return 0, err
+	}
+
+	var t int64
+	switch code {
+	case python:
+		t = 0
+	case processing:
+		t = 1
+	case html:
+		t = 2
+	case react:
+		t = 3
+	}
+	if !ValidThumbnail(t) {
+		return 0, errors.Errorf("default thumbnail %d of language %q is out of range", t, language)
+	}
+	return t, nil
+}
+
+// ValidThumbnail returns whether t is the index of a
+// program or class thumbnail.
+func ValidThumbnail(t int64) bool {
+	return t >= 0 && t < thumbnailCount
+}
+
+// ValidTimezone returns whether tz is the IANA name of a
+// time zone, or empty, meaning UTC.
+func ValidTimezone(tz string) bool {
+	// "Local" is the server's zone, which means nothing to users.
+	_, err := time.LoadLocation(tz)
+	return err == nil && tz != "Local"
+}
+
+// location returns the time zone with the given IANA name,
+// falling back to UTC if it is empty or unknown.
+func location(tz string) *time.Location {
+	if !ValidTimezone(tz) {
+		return time.UTC
+	}
+	loc, _ := time.LoadLocation(tz)
+	return loc
+}
+
+// DefaultCode returns the code that new programs in the
+// language with the given name start with, or the empty
+// string if there is no such language.
+func DefaultCode(language string) string {
+	return defaultProgram(language).Code
+}
+
 // defaultProgram returns a Program struct initialized to
 // default values for a given Language.
 // if the language does not exist, it returns nil.
@@ -13,6 +13,53 @@ func TestLangString(t *testing.T) {
 	assert.Equal(t, langString(langCount), "DNE")
 }
 
+func TestLanguageCode(t *testing.T) {
+	code, err := LanguageCode("python")
+	assert.NoError(t, err)
+	assert.Equal(t, python, code)
+	code, err = LanguageCode("react")
+	assert.NoError(t, err)
+	assert.Equal(t, react, code)
+	_, err = LanguageCode("DNE")
+	assert.Error(t, err)
+}
+
+func TestLanguages(t *testing.T) {
+	assert.Equal(t, []string{"python", "processing", "html", "react"}, Languages())
+}
+
+func TestDefaultCode(t *testing.T) {
+	for _, language := range Languages() {
+		assert.NotEmpty(t, DefaultCode(language), language)
+	}
+	assert.Empty(t, DefaultCode("DNE"))
+}
+
+func TestLanguageDefaultThumbnail(t *testing.T) {
+	for i := python; i < langCount; i++ {
+		thumbnail, err := LanguageDefaultThumbnail(langString(i))
+		assert.NoError(t, err)
+		assert.True(t, ValidThumbnail(thumbnail))
+	}
+	_, err := LanguageDefaultThumbnail("DNE")
+	assert.Error(t, err)
+}
+
+func TestValidThumbnail(t *testing.T) {
+	assert.True(t, ValidThumbnail(0))
+	assert.True(t, ValidThumbnail(thumbnailCount-1))
+	assert.False(t, ValidThumbnail(thumbnailCount))
+	assert.False(t, ValidThumbnail(-1))
+}
+
+func TestValidTimezone(t *testing.T) {
+	assert.True(t, ValidTimezone(""))
+	assert.True(t, ValidTimezone("America/Los_Angeles"))
+	assert.False(t, ValidTimezone("Local"))
+	assert.False(t, ValidTimezone("Mars/Olympus_Mons"))
+	assert.Equal(t, "UTC", location("Mars/Olympus_Mons").String())
+}
+
 func TestDefaultProgram(t *testing.T) {
 	p := defaultProgram(langString(python))
 	assert.NotEmpty(t, p)
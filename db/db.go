@@ -3,9 +3,12 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -16,6 +19,12 @@ type DB struct {
 	*firestore.Client
 }
 
+// stamped returns the given updates along with one recording
+// that the document was modified now.
+func stamped(up ...firestore.Update) []firestore.Update {
+	return append(up, firestore.Update{Path: "updatedAt", Value: time.Now().UTC().String()})
+}
+
 func (d *DB) LoadProgram(ctx context.Context, pid string) (Program, error) {
 	doc, err := d.Collection(programsPath).Doc(pid).Get(ctx)
 	if err != nil {
@@ -26,16 +35,142 @@ func (d *DB) LoadProgram(ctx context.Context, pid string) (Program, error) {
 	if err := doc.DataTo(&p); err != nil {
 		return Program{}, err
 	}
+	// older program docs do not store their own ID.
+	p.UID = doc.Ref.ID
 	return p, nil
 }
 
+func (d *DB) LoadPrograms(ctx context.Context, pids []string) ([]Program, error) {
+	if len(pids) == 0 {
+		return []Program{}, nil
+	}
+	refs := make([]*firestore.DocumentRef, 0, len(pids))
+	for _, pid := range pids {
+		refs = append(refs, d.Collection(programsPath).Doc(pid))
+	}
+	docs, err := d.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	programs := make([]Program, 0, len(docs))
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		p := Program{}
+		if err := doc.DataTo(&p); err != nil {
+			return nil, err
+		}
+		p.UID = doc.Ref.ID
+		programs = append(programs, p)
+	}
+	return programs, nil
+}
+
+func (d *DB) LoadProgramActivity(ctx context.Context, pids []string) ([]ProgramActivity, error) {
+	// "in" queries take at most 10 values.
+	const maxInValues = 10
+
+	activity := make([]ProgramActivity, 0, len(pids))
+	for start := 0; start < len(pids); start += maxInValues {
+		end := start + maxInValues
+		if end > len(pids) {
+			end = len(pids)
+		}
+		refs := make([]*firestore.DocumentRef, 0, end-start)
+		for _, pid := range pids[start:end] {
+			refs = append(refs, d.Collection(programsPath).Doc(pid))
+		}
+
+		iter := d.Collection(programsPath).
+			Where(firestore.DocumentID, "in", refs).
+			Select("dateCreated", "savedAt", "updatedAt").
+			Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return nil, err
+			}
+			a := ProgramActivity{}
+			if err := doc.DataTo(&a); err != nil {
+				iter.Stop()
+				return nil, err
+			}
+			a.PID = doc.Ref.ID
+			activity = append(activity, a)
+		}
+		iter.Stop()
+	}
+	return activity, nil
+}
+
+func (d *DB) LoadProgramOwners(ctx context.Context, pids []string) (map[string]User, error) {
+	// "array-contains-any" queries take at most 10 values.
+	const maxInValues = 10
+
+	wanted := make(map[string]bool, len(pids))
+	for _, pid := range pids {
+		wanted[pid] = true
+	}
+
+	owners := make(map[string]User)
+	for start := 0; start < len(pids); start += maxInValues {
+		end := start + maxInValues
+		if end > len(pids) {
+			end = len(pids)
+		}
+
+		iter := d.Collection(usersPath).
+			Where("programs", "array-contains-any", pids[start:end]).
+			Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return nil, err
+			}
+			u := User{}
+			if err := doc.DataTo(&u); err != nil {
+				iter.Stop()
+				return nil, err
+			}
+			u.UID = doc.Ref.ID
+			for _, pid := range u.Programs {
+				if wanted[pid] {
+					owners[pid] = u
+				}
+			}
+		}
+		iter.Stop()
+	}
+	return owners, nil
+}
+
 func (d *DB) StoreProgram(ctx context.Context, p Program) error {
+	p.stamp()
 	if _, err := d.Collection(programsPath).Doc(p.UID).Set(ctx, &p); err != nil {
 		return err
 	}
 	return nil
 }
 
+func (d *DB) InsertProgram(ctx context.Context, p Program) (Program, error) {
+	ref := d.Collection(programsPath).NewDoc()
+	p.UID = ref.ID
+	if _, err := ref.Create(ctx, &p); err != nil {
+		return Program{}, err
+	}
+	return p, nil
+}
+
 func (d *DB) RemoveProgram(ctx context.Context, pid string) error {
 	if _, err := d.Collection(programsPath).Doc(pid).Delete(ctx); err != nil {
 		return err
@@ -43,6 +178,15 @@ func (d *DB) RemoveProgram(ctx context.Context, pid string) error {
 	return nil
 }
 
+func (d *DB) Ping(ctx context.Context) error {
+	iter := d.Collection(usersPath).Limit(1).Documents(ctx)
+	defer iter.Stop()
+	if _, err := iter.Next(); err != nil && err != iterator.Done {
+		return err
+	}
+	return nil
+}
+
 func (d *DB) LoadClass(ctx context.Context, cid string) (Class, error) {
 	doc, err := d.Collection(classesPath).Doc(cid).Get(ctx)
 	if err != nil {
@@ -56,13 +200,156 @@ func (d *DB) LoadClass(ctx context.Context, cid string) (Class, error) {
 	return c, nil
 }
 
+func (d *DB) LoadDiscoverableClasses(ctx context.Context) ([]Class, error) {
+	iter := d.Collection(classesPath).Where("discoverable", "==", true).Documents(ctx)
+	defer iter.Stop()
+
+	classes := make([]Class, 0)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := Class{}
+		if err := doc.DataTo(&c); err != nil {
+			return nil, err
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+func (d *DB) LoadClassByWID(ctx context.Context, wid string) (Class, error) {
+	cid, err := d.GetUIDFromWID(ctx, NormalizeJoinCode(wid), classesAliasPath)
+	if err != nil {
+		return Class{}, err
+	}
+	return d.LoadClass(ctx, cid)
+}
+
 func (d *DB) StoreClass(ctx context.Context, c Class) error {
+	c.stamp()
 	if _, err := d.Collection(classesPath).Doc(c.CID).Set(ctx, &c); err != nil {
 		return err
 	}
 	return nil
 }
 
+func (d *DB) ModifyClass(ctx context.Context, cid string, update func(*Class) error) (Class, error) {
+	var c Class
+	err := d.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := d.Collection(classesPath).Doc(cid)
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		c = Class{}
+		if err := doc.DataTo(&c); err != nil {
+			return err
+		}
+		if err := update(&c); err != nil {
+			return err
+		}
+		c.stamp()
+		return tx.Set(ref, &c)
+	})
+	if err != nil {
+		return Class{}, err
+	}
+	return c, nil
+}
+
+func (d *DB) UpdateClass(ctx context.Context, cid string, u *ClassUpdate) error {
+	update := u.ToFirestoreUpdate()
+	if len(update) == 0 {
+		return nil
+	}
+	_, err := d.Collection(classesPath).Doc(cid).Update(ctx, stamped(update...))
+	return err
+}
+
+func (d *DB) InsertClass(ctx context.Context, c Class) (Class, error) {
+	ref := d.Collection(classesPath).NewDoc()
+	c.CID = ref.ID
+	wid, err := d.MakeAlias(ctx, c.CID, classesAliasPath)
+	if err != nil {
+		return Class{}, err
+	}
+	c.WID = wid
+	c.touch()
+	c.DateCreated = time.Now().UTC().String()
+
+	if _, err := ref.Create(ctx, &c); err != nil {
+		return Class{}, err
+	}
+	return c, nil
+}
+
+func (d *DB) InsertClasses(ctx context.Context, classes []Class) ([]Class, error) {
+	// each class takes two writes: the class itself, and
+	// its creator's list of classes.
+	const classesPerBatch = maxBatchWrites / 2
+
+	// classes are only added to created once their batch is
+	// committed. If a batch fails, the aliases made for it are
+	// removed, so that they do not point at missing classes.
+	created := make([]Class, 0, len(classes))
+	batch, pending := d.Batch(), []Class{}
+	commit := func() error {
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+		created = append(created, pending...)
+		batch, pending = d.Batch(), []Class{}
+		return nil
+	}
+	rollback := func(err error) ([]Class, error) {
+		aliases := d.Batch()
+		for _, c := range pending {
+			aliases.Delete(d.Collection(classesAliasPath).Doc(c.WID))
+		}
+		if len(pending) > 0 {
+			if _, rerr := aliases.Commit(ctx); rerr != nil {
+				return created, fmt.Errorf("%w (failed to remove aliases: %v)", err, rerr)
+			}
+		}
+		return created, err
+	}
+
+	for _, c := range classes {
+		ref := d.Collection(classesPath).NewDoc()
+		c.CID = ref.ID
+		wid, err := d.MakeAlias(ctx, c.CID, classesAliasPath)
+		if err != nil {
+			return rollback(err)
+		}
+		c.WID = wid
+		c.touch()
+		c.DateCreated = time.Now().UTC().String()
+
+		batch.Create(ref, &c)
+		batch.Update(d.Collection(usersPath).Doc(c.Creator), []firestore.Update{
+			{Path: "classes", Value: firestore.ArrayUnion(c.CID)},
+		})
+		pending = append(pending, c)
+		if len(pending) == classesPerBatch {
+			if err := commit(); err != nil {
+				return rollback(err)
+			}
+		}
+	}
+
+	if len(pending) > 0 {
+		if err := commit(); err != nil {
+			return rollback(err)
+		}
+	}
+	return created, nil
+}
+
 func (d *DB) DeleteClass(ctx context.Context, cid string) error {
 	if _, err := d.Collection(classesPath).Doc(cid).Delete(ctx); err != nil {
 		return err
@@ -71,6 +358,68 @@ func (d *DB) DeleteClass(ctx context.Context, cid string) error {
 	return nil
 }
 
+// checkMove returns why the program with the given pid cannot
+// be moved from src to dst, or nil if it can.
+func checkMove(src, dst *Class, pid string) error {
+	switch {
+	case !src.HasProgram(pid):
+		return ErrProgramNotInClass
+	case dst.HasProgram(pid):
+		return ErrProgramInClass
+	case !dst.HasRoomFor(1):
+		return ErrClassFull
+	}
+	return nil
+}
+
+func (d *DB) MoveClassProgram(ctx context.Context, pid, from, to string) error {
+	fromRef := d.Collection(classesPath).Doc(from)
+	toRef := d.Collection(classesPath).Doc(to)
+	progRef := d.Collection(programsPath).Doc(pid)
+
+	return d.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		fromSnap, err := tx.Get(fromRef)
+		if err != nil {
+			return err
+		}
+		src := Class{}
+		if err := fromSnap.DataTo(&src); err != nil {
+			return err
+		}
+		toSnap, err := tx.Get(toRef)
+		if err != nil {
+			return err
+		}
+		dst := Class{}
+		if err := toSnap.DataTo(&dst); err != nil {
+			return err
+		}
+		if err := checkMove(&src, &dst, pid); err != nil {
+			return err
+		}
+		src.RemoveProgram(pid)
+		dst.AddProgram(pid)
+
+		if err := tx.Update(fromRef, stamped(
+			firestore.Update{Path: "programs", Value: firestore.ArrayRemove(pid)},
+			firestore.Update{Path: "stats", Value: src.Stats},
+		)); err != nil {
+			return err
+		}
+		if err := tx.Update(toRef, stamped(
+			firestore.Update{Path: "programs", Value: firestore.ArrayUnion(pid)},
+			firestore.Update{Path: "stats", Value: dst.Stats},
+		)); err != nil {
+			return err
+		}
+
+		// keep the program's class association in sync.
+		return tx.Update(progRef, stamped(
+			firestore.Update{Path: "WID", Value: dst.WID},
+		))
+	})
+}
+
 func (d *DB) LoadUser(ctx context.Context, uid string) (User, error) {
 	doc, err := d.Collection(usersPath).Doc(uid).Get(ctx)
 	if err != nil {
@@ -98,6 +447,19 @@ func (d *DB) DeleteUser(ctx context.Context, uid string) error {
 	return nil
 }
 
+func (d *DB) DisplayNameExists(ctx context.Context, name string) (bool, error) {
+	iter := d.Collection(usersPath).Where("displayNameKey", "==", normalizeDisplayName(name)).Limit(1).Documents(ctx)
+	defer iter.Stop()
+
+	if _, err := iter.Next(); err != nil {
+		if err == iterator.Done {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // Open returns a pointer to a new database client based on
 // JSON credentials given by the environment variable.
 // Returns an error if it fails at any point.
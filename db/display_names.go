@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+func (d *DB) BackfillDisplayNameKeys(ctx context.Context) (int, error) {
+	// read a page at a time, so that each page's fixes fit
+	// in a single batch.
+	fixed := 0
+	var last *firestore.DocumentSnapshot
+	for {
+		q := d.Collection(usersPath).OrderBy(firestore.DocumentID, firestore.Asc).Select("displayName", "displayNameKey").Limit(maxBatchWrites)
+		if last != nil {
+			q = q.StartAfter(last)
+		}
+
+		iter := q.Documents(ctx)
+		batch, pending, read := d.Batch(), 0, 0
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return fixed, err
+			}
+			last, read = doc, read+1
+
+			var data struct {
+				DisplayName    string `firestore:"displayName"`
+				DisplayNameKey string `firestore:"displayNameKey"`
+			}
+			if err := doc.DataTo(&data); err != nil {
+				continue
+			}
+			if key := normalizeDisplayName(data.DisplayName); key != data.DisplayNameKey {
+				batch.Update(doc.Ref, []firestore.Update{{Path: "displayNameKey", Value: key}})
+				pending++
+			}
+		}
+		iter.Stop()
+
+		if pending > 0 {
+			if _, err := batch.Commit(ctx); err != nil {
+				return fixed, err
+			}
+			fixed += pending
+		}
+		if read < maxBatchWrites {
+			return fixed, nil
+		}
+	}
+}
+
+func (d *MockDB) BackfillDisplayNameKeys(_ context.Context) (int, error) {
+	if err := d.fail("BackfillDisplayNameKeys"); err != nil {
+		return 0, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fixed := 0
+	for uid, doc := range d.db[usersPath] {
+		u := doc.(User)
+		if key := normalizeDisplayName(u.DisplayName); key != u.DisplayNameKey {
+			u.DisplayNameKey = key
+			d.db[usersPath][uid] = u
+			fixed++
+		}
+	}
+	return fixed, nil
+}
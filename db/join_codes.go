@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
+)
+
+// JoinCodeCollisions reports the join codes shared by more than
+// one class.
+type JoinCodeCollisions struct {
+	// Scanned is the number of classes checked.
+	Scanned int `json:"scanned"`
+	// Collisions maps each shared join code to the cids of the
+	// classes sharing it, in order.
+	Collisions map[string][]string `json:"collisions"`
+	// Rotated maps the cids of classes given a new join code
+	// to that code.
+	Rotated map[string]string `json:"rotated"`
+}
+
+// NormalizeJoinCode returns the form of a join code that
+// classes are looked up by. Join codes are made of lowercase
+// words, so a code typed in any case finds the same class.
+func NormalizeJoinCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// findJoinCodeCollisions groups the given cids by their wid,
+// keeping only the groups with more than one class.
+func findJoinCodeCollisions(wids map[string]string) JoinCodeCollisions {
+	r := JoinCodeCollisions{
+		Scanned:    len(wids),
+		Collisions: make(map[string][]string),
+		Rotated:    make(map[string]string),
+	}
+
+	groups := make(map[string][]string)
+	for cid, wid := range wids {
+		if wid != "" {
+			groups[wid] = append(groups[wid], cid)
+		}
+	}
+	for wid, cids := range groups {
+		if len(cids) > 1 {
+			sort.Strings(cids)
+			r.Collisions[wid] = cids
+		}
+	}
+	return r
+}
+
+// rotated returns the classes in a collision that should get a
+// new join code, leaving out keep, or the first class if keep is
+// not among them.
+func rotated(cids []string, keep string) []string {
+	for i, cid := range cids {
+		if cid == keep {
+			return append(append([]string{}, cids[:i]...), cids[i+1:]...)
+		}
+	}
+	return cids[1:]
+}
+
+func (d *DB) FindJoinCodeCollisions(ctx context.Context, fix bool) (JoinCodeCollisions, error) {
+	wids := make(map[string]string)
+	iter := d.Collection(classesPath).Select("WID").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return JoinCodeCollisions{}, err
+		}
+
+		var data struct {
+			WID string `firestore:"WID"`
+		}
+		if err := doc.DataTo(&data); err != nil {
+			return JoinCodeCollisions{}, err
+		}
+		wids[doc.Ref.ID] = data.WID
+	}
+
+	r := findJoinCodeCollisions(wids)
+	if !fix {
+		return r, nil
+	}
+
+	for wid, cids := range r.Collisions {
+		// the class that the join code resolves to keeps it.
+		keep, _ := d.GetUIDFromWID(ctx, wid, classesAliasPath)
+		for _, cid := range rotated(cids, keep) {
+			next, err := d.MakeAlias(ctx, cid, classesAliasPath)
+			if err != nil {
+				return r, err
+			}
+			if err := d.rotateJoinCode(ctx, cid, wid, next); err != nil {
+				return r, err
+			}
+			r.Rotated[cid] = next
+		}
+	}
+	return r, nil
+}
+
+// rotateJoinCode gives the class with the given cid the join
+// code next, along with each of its programs still associated
+// to the old one. The class is updated in the same batch as its
+// first programs.
+func (d *DB) rotateJoinCode(ctx context.Context, cid, old, next string) error {
+	class, err := d.LoadClass(ctx, cid)
+	if err != nil {
+		return err
+	}
+	programs, err := d.LoadPrograms(ctx, class.Programs)
+	if err != nil {
+		return err
+	}
+
+	batch, pending := d.Batch(), 1
+	batch.Update(d.Collection(classesPath).Doc(cid), stamped(firestore.Update{Path: "WID", Value: next}))
+	for _, p := range programs {
+		if p.WID != old {
+			continue
+		}
+		batch.Update(d.Collection(programsPath).Doc(p.UID), stamped(firestore.Update{Path: "WID", Value: next}))
+		if pending++; pending == maxBatchWrites {
+			if _, err := batch.Commit(ctx); err != nil {
+				return err
+			}
+			batch, pending = d.Batch(), 0
+		}
+	}
+	if pending > 0 {
+		_, err = batch.Commit(ctx)
+	}
+	return err
+}
+
+func (d *MockDB) FindJoinCodeCollisions(ctx context.Context, fix bool) (JoinCodeCollisions, error) {
+	if err := d.fail("FindJoinCodeCollisions"); err != nil {
+		return JoinCodeCollisions{}, err
+	}
+	wids := make(map[string]string)
+	d.mu.RLock()
+	for cid, doc := range d.db[classesPath] {
+		wids[cid] = doc.(Class).WID
+	}
+	d.mu.RUnlock()
+
+	r := findJoinCodeCollisions(wids)
+	if !fix {
+		return r, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for wid, cids := range r.Collisions {
+		for _, cid := range rotated(cids, "") {
+			next := uuid.New().String()
+			class := d.db[classesPath][cid].(Class)
+			class.WID = next
+			class.stamp()
+			d.db[classesPath][cid] = class
+			for _, pid := range class.Programs {
+				p, ok := d.db[programsPath][pid].(Program)
+				if !ok || p.WID != wid {
+					continue
+				}
+				p.WID = next
+				p.stamp()
+				d.db[programsPath][pid] = p
+			}
+			r.Rotated[cid] = next
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// LanguageAudit reports the programs found with a missing or
+// unknown language.
+type LanguageAudit struct {
+	// Scanned is the number of programs checked.
+	Scanned int `json:"scanned"`
+	// Invalid maps the pids of offending programs to the
+	// language they had.
+	Invalid map[string]string `json:"invalid"`
+	// Fixed holds the pids of offending programs whose
+	// language was replaced.
+	Fixed []string `json:"fixed"`
+}
+
+func newLanguageAudit() LanguageAudit {
+	return LanguageAudit{
+		Invalid: make(map[string]string),
+		Fixed:   []string{},
+	}
+}
+
+// check records the program if its language is invalid,
+// returning whether it should be fixed.
+func (a *LanguageAudit) check(pid, language, fix string) bool {
+	a.Scanned++
+	if _, err := LanguageCode(language); err == nil {
+		return false
+	}
+	a.Invalid[pid] = language
+	if fix == "" {
+		return false
+	}
+	a.Fixed = append(a.Fixed, pid)
+	return true
+}
+
+func (d *DB) AuditProgramLanguages(ctx context.Context, fix string) (LanguageAudit, error) {
+	if fix != "" {
+		if _, err := LanguageCode(fix); err != nil {
+			return LanguageAudit{}, err
+		}
+	}
+
+	// read a page at a time, so that each page's fixes fit
+	// in a single batch.
+	a := newLanguageAudit()
+	var last *firestore.DocumentSnapshot
+	for {
+		q := d.Collection(programsPath).OrderBy(firestore.DocumentID, firestore.Asc).Select("language").Limit(maxBatchWrites)
+		if last != nil {
+			q = q.StartAfter(last)
+		}
+
+		iter := q.Documents(ctx)
+		batch, pending, read := d.Batch(), 0, 0
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return a, err
+			}
+			last, read = doc, read+1
+
+			var data struct {
+				Language string `firestore:"language"`
+			}
+			if err := doc.DataTo(&data); err != nil {
+				// a language of the wrong type is as bad as a missing one.
+				data.Language = ""
+			}
+			if a.check(doc.Ref.ID, data.Language, fix) {
+				batch.Update(doc.Ref, stamped(firestore.Update{Path: "language", Value: fix}))
+				pending++
+			}
+		}
+		iter.Stop()
+
+		if pending > 0 {
+			if _, err := batch.Commit(ctx); err != nil {
+				return a, err
+			}
+		}
+		if read < maxBatchWrites {
+			return a, nil
+		}
+	}
+}
+
+func (d *MockDB) AuditProgramLanguages(_ context.Context, fix string) (LanguageAudit, error) {
+	if err := d.fail("AuditProgramLanguages"); err != nil {
+		return LanguageAudit{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if fix != "" {
+		if _, err := LanguageCode(fix); err != nil {
+			return LanguageAudit{}, err
+		}
+	}
+
+	a := newLanguageAudit()
+	for pid, doc := range d.db[programsPath] {
+		p := doc.(Program)
+		if a.check(pid, p.Language, fix) {
+			p.Language = fix
+			p.stamp()
+			d.db[programsPath][pid] = p
+		}
+	}
+	return a, nil
+}
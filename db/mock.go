@@ -3,14 +3,54 @@ package db
 import (
 	"context"
 	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// MockDB implements the TLADB interface in memory. It is safe
+// for concurrent use.
 type MockDB struct {
+	// mu guards db and FailOn.
+	mu sync.RWMutex
+
 	// "Users, Programs, Class" collection
 	db map[string]map[string]interface{}
+
+	// FailOn holds the errors that methods, keyed by name,
+	// are forced to return instead of doing their work.
+	FailOn map[string]error
+}
+
+// SetFailure forces the method named op to return err. A nil
+// err clears the failure.
+func (d *MockDB) SetFailure(op string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		delete(d.FailOn, op)
+		return
+	}
+	d.FailOn[op] = err
+}
+
+// fail returns the error the method named op is forced to
+// return, if any.
+func (d *MockDB) fail(op string) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.FailOn[op]
 }
 
 func (d *MockDB) LoadProgram(_ context.Context, pid string) (Program, error) {
+	if err := d.fail("LoadProgram"); err != nil {
+		return Program{}, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	p, ok := d.db[programsPath][pid].(Program)
 	if !ok {
 		return Program{}, errors.New("program has not been created")
@@ -19,16 +59,103 @@ func (d *MockDB) LoadProgram(_ context.Context, pid string) (Program, error) {
 }
 
 func (d *MockDB) StoreProgram(_ context.Context, p Program) error {
+	if err := d.fail("StoreProgram"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p.stamp()
 	d.db[programsPath][p.UID] = p
 	return nil
 }
 
+func (d *MockDB) InsertProgram(_ context.Context, p Program) (Program, error) {
+	if err := d.fail("InsertProgram"); err != nil {
+		return Program{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p.UID = uuid.New().String()
+	d.db[programsPath][p.UID] = p
+	return p, nil
+}
+
+func (d *MockDB) LoadPrograms(_ context.Context, pids []string) ([]Program, error) {
+	if err := d.fail("LoadPrograms"); err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	programs := make([]Program, 0, len(pids))
+	for _, pid := range pids {
+		if p, ok := d.db[programsPath][pid].(Program); ok {
+			programs = append(programs, p)
+		}
+	}
+	return programs, nil
+}
+
+func (d *MockDB) LoadProgramActivity(_ context.Context, pids []string) ([]ProgramActivity, error) {
+	if err := d.fail("LoadProgramActivity"); err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	activity := make([]ProgramActivity, 0, len(pids))
+	for _, pid := range pids {
+		if p, ok := d.db[programsPath][pid].(Program); ok {
+			activity = append(activity, ProgramActivity{
+				PID:         pid,
+				DateCreated: p.DateCreated,
+				SavedAt:     p.SavedAt,
+				UpdatedAt:   p.UpdatedAt,
+			})
+		}
+	}
+	return activity, nil
+}
+
+func (d *MockDB) LoadProgramOwners(_ context.Context, pids []string) (map[string]User, error) {
+	if err := d.fail("LoadProgramOwners"); err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	owners := make(map[string]User)
+	for _, doc := range d.db[usersPath] {
+		u := doc.(User)
+		for _, owned := range u.Programs {
+			for _, pid := range pids {
+				if owned == pid {
+					owners[pid] = u
+				}
+			}
+		}
+	}
+	return owners, nil
+}
+
 func (d *MockDB) RemoveProgram(_ context.Context, pid string) error {
+	if err := d.fail("RemoveProgram"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	delete(d.db[programsPath], pid)
 	return nil
 }
 
-func (d *MockDB) LoadClass(_ context.Context, cid string) (c Class, err error) {
+func (d *MockDB) LoadClass(_ context.Context, cid string) (Class, error) {
+	if err := d.fail("LoadClass"); err != nil {
+		return Class{}, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.loadClass(cid)
+}
+
+// loadClass is LoadClass for callers already holding the lock.
+func (d *MockDB) loadClass(cid string) (c Class, err error) {
 	c, ok := d.db[classesPath][cid].(Class)
 	if !ok {
 		err = errors.New("invalid class ID")
@@ -36,17 +163,196 @@ func (d *MockDB) LoadClass(_ context.Context, cid string) (c Class, err error) {
 	return
 }
 
+func (d *MockDB) LoadDiscoverableClasses(_ context.Context) ([]Class, error) {
+	if err := d.fail("LoadDiscoverableClasses"); err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	classes := make([]Class, 0)
+	for _, c := range d.db[classesPath] {
+		if class := c.(Class); class.Discoverable {
+			classes = append(classes, class)
+		}
+	}
+	return classes, nil
+}
+
+func (d *MockDB) LoadClassByWID(_ context.Context, wid string) (Class, error) {
+	if err := d.fail("LoadClassByWID"); err != nil {
+		return Class{}, err
+	}
+	wid = NormalizeJoinCode(wid)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, c := range d.db[classesPath] {
+		if class := c.(Class); class.WID == wid {
+			return class, nil
+		}
+	}
+	return Class{}, errors.New("invalid class WID")
+}
+
 func (d *MockDB) StoreClass(_ context.Context, c Class) error {
+	if err := d.fail("StoreClass"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c.stamp()
 	d.db[classesPath][c.CID] = c
 	return nil
 }
 
+func (d *MockDB) ModifyClass(_ context.Context, cid string, update func(*Class) error) (Class, error) {
+	if err := d.fail("ModifyClass"); err != nil {
+		return Class{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c, err := d.loadClass(cid)
+	if err != nil {
+		return Class{}, err
+	}
+	if err := update(&c); err != nil {
+		return Class{}, err
+	}
+	c.stamp()
+	d.db[classesPath][cid] = c
+	return c, nil
+}
+
+func (d *MockDB) UpdateClass(_ context.Context, cid string, u *ClassUpdate) error {
+	if err := d.fail("UpdateClass"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	class, err := d.loadClass(cid)
+	if err != nil {
+		return err
+	}
+	class.merge(u)
+	class.stamp()
+	d.db[classesPath][cid] = class
+	return nil
+}
+
+func (d *MockDB) InsertClass(_ context.Context, c Class) (Class, error) {
+	if err := d.fail("InsertClass"); err != nil {
+		return Class{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.insertClass(c), nil
+}
+
+// insertClass is InsertClass for callers already holding the
+// lock.
+func (d *MockDB) insertClass(c Class) Class {
+	c.CID = uuid.New().String()
+	c.WID = uuid.New().String()
+	c.touch()
+	c.DateCreated = time.Now().UTC().String()
+	d.db[classesPath][c.CID] = c
+	return c
+}
+
+func (d *MockDB) InsertClasses(_ context.Context, classes []Class) ([]Class, error) {
+	if err := d.fail("InsertClasses"); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	created := make([]Class, 0, len(classes))
+	for _, c := range classes {
+		u, err := d.loadUser(c.Creator)
+		if err != nil {
+			return created, err
+		}
+		c = d.insertClass(c)
+		u.Classes = append(u.Classes, c.CID)
+		d.db[usersPath][u.UID] = u
+		created = append(created, c)
+	}
+	return created, nil
+}
+
 func (d *MockDB) DeleteClass(_ context.Context, cid string) error {
+	if err := d.fail("DeleteClass"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	delete(d.db[classesPath], cid)
 	return nil
 }
 
-func (d *MockDB) LoadUser(_ context.Context, uid string) (u User, err error) {
+func (d *MockDB) MoveClassProgram(_ context.Context, pid, from, to string) error {
+	if err := d.fail("MoveClassProgram"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	src, ok := d.db[classesPath][from].(Class)
+	if !ok {
+		return errors.New("invalid class ID")
+	}
+	dst, ok := d.db[classesPath][to].(Class)
+	if !ok {
+		return errors.New("invalid class ID")
+	}
+	if err := checkMove(&src, &dst, pid); err != nil {
+		return err
+	}
+	// like Firestore, fail the whole move if the program
+	// document does not exist.
+	p, ok := d.db[programsPath][pid].(Program)
+	if !ok {
+		return status.Error(codes.NotFound, "program has not been created")
+	}
+
+	src.RemoveProgram(pid)
+	dst.AddProgram(pid)
+	src.stamp()
+	dst.stamp()
+	d.db[classesPath][from] = src
+	d.db[classesPath][to] = dst
+
+	p.WID = dst.WID
+	p.stamp()
+	d.db[programsPath][pid] = p
+	return nil
+}
+
+func (d *MockDB) RemoveProgramFromClass(_ context.Context, cid string, pid string) error {
+	if err := d.fail("RemoveProgramFromClass"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	class, err := d.loadClass(cid)
+	if err != nil {
+		return err
+	}
+	if class.RemoveProgram(pid) {
+		class.stamp()
+		d.db[classesPath][cid] = class
+	}
+	return nil
+}
+
+func (d *MockDB) LoadUser(_ context.Context, uid string) (User, error) {
+	if err := d.fail("LoadUser"); err != nil {
+		return User{}, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.loadUser(uid)
+}
+
+// loadUser is LoadUser for callers already holding the lock.
+func (d *MockDB) loadUser(uid string) (u User, err error) {
 	u, ok := d.db[usersPath][uid].(User)
 	if !ok {
 		err = errors.New("invalid user ID")
@@ -55,20 +361,113 @@ func (d *MockDB) LoadUser(_ context.Context, uid string) (u User, err error) {
 }
 
 func (d *MockDB) StoreUser(_ context.Context, u User) error {
+	if err := d.fail("StoreUser"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	d.db[usersPath][u.UID] = u
 	return nil
 }
 
 func (d *MockDB) DeleteUser(_ context.Context, uid string) error {
+	if err := d.fail("DeleteUser"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	delete(d.db[usersPath], uid)
 	return nil
 }
 
+func (d *MockDB) DisplayNameExists(_ context.Context, name string) (bool, error) {
+	if err := d.fail("DisplayNameExists"); err != nil {
+		return false, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	// like Firestore, only the stored key is compared, so that
+	// users without one are not found.
+	key := normalizeDisplayName(name)
+	for _, u := range d.db[usersPath] {
+		if u.(User).DisplayNameKey == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (d *MockDB) Ping(_ context.Context) error {
+	if err := d.fail("Ping"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Transact runs fn against a copy of the MockDB, replacing
+// the contents of the MockDB with those of the copy only if
+// fn succeeds. Other operations on the MockDB wait until the
+// transaction is done, so fn must only use the given TLADB.
+func (d *MockDB) Transact(_ context.Context, fn func(tx TLADB) error) error {
+	if err := d.fail("Transact"); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx := &MockDB{
+		db:     make(map[string]map[string]interface{}, len(d.db)),
+		FailOn: make(map[string]error, len(d.FailOn)),
+	}
+	for path, docs := range d.db {
+		tx.db[path] = make(map[string]interface{}, len(docs))
+		for id, doc := range docs {
+			tx.db[path][id] = doc
+		}
+	}
+	for op, err := range d.FailOn {
+		tx.FailOn[op] = err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	d.db = tx.db
+	return nil
+}
+
 // Creates a new MockDB.
 func OpenMock() *MockDB {
-	m := MockDB{db: make(map[string]map[string]interface{})}
+	m := MockDB{
+		db:     make(map[string]map[string]interface{}),
+		FailOn: make(map[string]error),
+	}
 	m.db[usersPath] = make(map[string]interface{})
 	m.db[programsPath] = make(map[string]interface{})
 	m.db[classesPath] = make(map[string]interface{})
 	return &m
 }
+
+// OpenMockWith creates a new MockDB holding the given users,
+// programs, and classes.
+func OpenMockWith(users []User, programs []Program, classes []Class) *MockDB {
+	m := OpenMock()
+	for _, u := range users {
+		m.db[usersPath][u.UID] = u
+	}
+	for _, p := range programs {
+		m.db[programsPath][p.UID] = p
+	}
+	for _, c := range classes {
+		m.db[classesPath][c.CID] = c
+	}
+	return m
+}
+
+// Snapshot returns how many users, programs, and classes the
+// MockDB holds.
+func (d *MockDB) Snapshot() (users, programs, classes int) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.db[usersPath]), len(d.db[programsPath]), len(d.db[classesPath])
+}
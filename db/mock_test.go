@@ -2,11 +2,17 @@ package db_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/uclaacm/teach-la-go-backend/db"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestMockUser(t *testing.T) {
@@ -37,6 +43,41 @@ func TestMockUser(t *testing.T) {
 		}))
 		assert.NoError(t, d.DeleteUser(context.Background(), "test"))
 	})
+	t.Run("displayNameTaken", func(t *testing.T) {
+		d := db.OpenMock()
+		// a user stored before keys were kept has none, and is
+		// only found once the keys are backfilled.
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:         "test",
+			DisplayName: "Joe Bruin",
+		}))
+		taken, err := d.DisplayNameExists(context.Background(), "  joe BRUIN ")
+		assert.NoError(t, err)
+		assert.False(t, taken)
+
+		fixed, err := d.BackfillDisplayNameKeys(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, fixed)
+		taken, err = d.DisplayNameExists(context.Background(), "  joe BRUIN ")
+		assert.NoError(t, err)
+		assert.True(t, taken)
+
+		// keys already up to date are left alone.
+		fixed, err = d.BackfillDisplayNameKeys(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, fixed)
+	})
+	t.Run("displayNameFree", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:            "test",
+			DisplayName:    "Joe Bruin",
+			DisplayNameKey: "joe bruin",
+		}))
+		taken, err := d.DisplayNameExists(context.Background(), "Josephine Bruin")
+		assert.NoError(t, err)
+		assert.False(t, taken)
+	})
 }
 
 func TestMockProgram(t *testing.T) {
@@ -60,6 +101,27 @@ func TestMockProgram(t *testing.T) {
 		_, err := d.LoadProgram(context.Background(), "invalid")
 		assert.Error(t, err)
 	})
+	t.Run("insert", func(t *testing.T) {
+		d := db.OpenMock()
+		p, err := d.InsertProgram(context.Background(), db.Program{Name: "test"})
+		require.NoError(t, err)
+		assert.NotEmpty(t, p.UID)
+
+		loaded, err := d.LoadProgram(context.Background(), p.UID)
+		assert.NoError(t, err)
+		assert.Equal(t, "test", loaded.Name)
+	})
+	t.Run("loadMany", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "a"}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "b"}))
+
+		programs, err := d.LoadPrograms(context.Background(), []string{"b", "missing", "a"})
+		require.NoError(t, err)
+		require.Len(t, programs, 2)
+		assert.Equal(t, "b", programs[0].UID)
+		assert.Equal(t, "a", programs[1].UID)
+	})
 	// Add tests if there is a DeleteProgram
 }
 
@@ -84,5 +146,322 @@ func TestMockClass(t *testing.T) {
 		_, err := d.LoadClass(context.Background(), "invalid")
 		assert.Error(t, err)
 	})
+	t.Run("moveProgram", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:      "from",
+			Programs: []string{"test"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID: "to",
+		}))
+		// like Firestore, moving a program without a document
+		// fails and changes nothing.
+		err := d.MoveClassProgram(context.Background(), "test", "from", "to")
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "test"}))
+		require.NoError(t, d.MoveClassProgram(context.Background(), "test", "from", "to"))
+		assert.Equal(t, db.ErrProgramInClass, d.MoveClassProgram(context.Background(), "test", "to", "to"))
+		assert.Equal(t, db.ErrProgramNotInClass, d.MoveClassProgram(context.Background(), "test", "from", "to"))
+
+		from, err := d.LoadClass(context.Background(), "from")
+		require.NoError(t, err)
+		assert.Empty(t, from.Programs)
+		to, err := d.LoadClass(context.Background(), "to")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"test"}, to.Programs)
+		assert.Equal(t, 0, from.Stats.Programs)
+		assert.Equal(t, 1, to.Stats.Programs)
+	})
+	t.Run("modify", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID: "test",
+		}))
+		updated, err := d.ModifyClass(context.Background(), "test", func(c *db.Class) error {
+			c.Name = "renamed"
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "renamed", updated.Name)
+
+		_, err = d.ModifyClass(context.Background(), "test", func(c *db.Class) error {
+			c.Name = "discarded"
+			return errors.New("abort")
+		})
+		assert.Error(t, err)
+		c, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "renamed", c.Name)
+	})
+	t.Run("update", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Name:        "old",
+			Thumbnail:   1,
+			Description: "kept",
+			Members:     []string{"a"},
+		}))
+		require.NoError(t, d.UpdateClass(context.Background(), "test", &db.ClassUpdate{Class: db.Class{
+			CID:       "ignored",
+			Name:      "new",
+			Thumbnail: 2,
+		}}))
+
+		c, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "test", c.CID)
+		assert.Equal(t, "new", c.Name)
+		assert.EqualValues(t, 2, c.Thumbnail)
+		assert.Equal(t, "kept", c.Description)
+		assert.Equal(t, []string{"a"}, c.Members)
+
+		assert.Error(t, d.UpdateClass(context.Background(), "missing", &db.ClassUpdate{Class: db.Class{Name: "new"}}))
+	})
+	t.Run("removeProgram", func(t *testing.T) {
+		d := db.OpenMock()
+		c := db.Class{CID: "test", Programs: []string{"a", "b"}}
+		c.RebuildStats()
+		require.NoError(t, d.StoreClass(context.Background(), c))
+
+		require.NoError(t, d.RemoveProgramFromClass(context.Background(), "test", "a"))
+		require.NoError(t, d.RemoveProgramFromClass(context.Background(), "test", "missing"))
+		c, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, c.Programs)
+		assert.Equal(t, 1, c.Stats.Programs)
+
+		assert.Error(t, d.RemoveProgramFromClass(context.Background(), "missing", "b"))
+	})
 	// Add tests if there is a DeleteClass
 }
+
+func TestOpenMockWith(t *testing.T) {
+	d := db.OpenMockWith(
+		[]db.User{{UID: "a"}, {UID: "b"}},
+		[]db.Program{{UID: "p"}},
+		nil,
+	)
+	users, programs, classes := d.Snapshot()
+	assert.Equal(t, 2, users)
+	assert.Equal(t, 1, programs)
+	assert.Equal(t, 0, classes)
+
+	_, err := d.LoadUser(context.Background(), "b")
+	assert.NoError(t, err)
+	_, err = d.LoadProgram(context.Background(), "p")
+	assert.NoError(t, err)
+
+	require.NoError(t, d.StoreClass(context.Background(), db.Class{CID: "c"}))
+	_, _, classes = d.Snapshot()
+	assert.Equal(t, 1, classes)
+}
+
+func TestMockFailure(t *testing.T) {
+	d := db.OpenMock()
+	forced := errors.New("forced")
+	d.SetFailure("StoreUser", forced)
+
+	err := d.StoreUser(context.Background(), db.User{UID: "test"})
+	assert.Equal(t, forced, err)
+	users, _, _ := d.Snapshot()
+	assert.Zero(t, users)
+
+	// other methods are unaffected.
+	assert.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "test"}))
+
+	d.SetFailure("StoreUser", nil)
+	assert.NoError(t, d.StoreUser(context.Background(), db.User{UID: "test"}))
+	users, _, _ = d.Snapshot()
+	assert.Equal(t, 1, users)
+}
+
+func TestMockTimestamps(t *testing.T) {
+	parse := func(t *testing.T, ts string) time.Time {
+		parsed, err := time.Parse(db.TimestampLayout, ts)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	t.Run("class", func(t *testing.T) {
+		ctx := context.Background()
+		d := db.OpenMock()
+		c, err := d.InsertClass(ctx, db.Class{Name: "test"})
+		require.NoError(t, err)
+		assert.NotEmpty(t, c.DateCreated)
+		assert.Empty(t, c.UpdatedAt)
+
+		require.NoError(t, d.UpdateClass(ctx, c.CID, &db.ClassUpdate{Class: db.Class{Name: "renamed"}}))
+		c, err = d.LoadClass(ctx, c.CID)
+		require.NoError(t, err)
+		first := parse(t, c.UpdatedAt)
+		assert.False(t, first.Before(parse(t, c.DateCreated)))
+
+		time.Sleep(time.Millisecond)
+		c, err = d.ModifyClass(ctx, c.CID, func(c *db.Class) error {
+			c.Description = "changed"
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, parse(t, c.UpdatedAt).After(first))
+	})
+	t.Run("program", func(t *testing.T) {
+		ctx := context.Background()
+		d := db.OpenMock()
+		require.NoError(t, d.StoreProgram(ctx, db.Program{UID: "test"}))
+		p, err := d.LoadProgram(ctx, "test")
+		require.NoError(t, err)
+		first := parse(t, p.UpdatedAt)
+
+		time.Sleep(time.Millisecond)
+		p.Name = "changed"
+		require.NoError(t, d.StoreProgram(ctx, p))
+		p, err = d.LoadProgram(ctx, "test")
+		require.NoError(t, err)
+		assert.True(t, parse(t, p.UpdatedAt).After(first))
+		// only Touch records a save.
+		assert.Empty(t, p.SavedAt)
+
+		p.Touch()
+		require.NoError(t, d.StoreProgram(ctx, p))
+		p, err = d.LoadProgram(ctx, "test")
+		require.NoError(t, err)
+		assert.Equal(t, p.SavedAt, p.LastSaved())
+		assert.False(t, parse(t, p.UpdatedAt).Before(parse(t, p.SavedAt)))
+	})
+	t.Run("insert", func(t *testing.T) {
+		// creation only sets DateCreated, for classes and
+		// programs alike.
+		ctx := context.Background()
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(ctx, db.User{UID: "creator"}))
+		classes, err := d.InsertClasses(ctx, []db.Class{{Creator: "creator"}})
+		require.NoError(t, err)
+		assert.NotEmpty(t, classes[0].DateCreated)
+		assert.Empty(t, classes[0].UpdatedAt)
+
+		p, err := d.InsertProgram(ctx, db.Program{DateCreated: time.Now().UTC().String()})
+		require.NoError(t, err)
+		assert.Empty(t, p.UpdatedAt)
+	})
+}
+
+func TestMockInsertClassesPartial(t *testing.T) {
+	ctx := context.Background()
+	d := db.OpenMock()
+	require.NoError(t, d.StoreUser(ctx, db.User{UID: "creator"}))
+
+	created, err := d.InsertClasses(ctx, []db.Class{
+		{Name: "first", Creator: "creator"},
+		{Name: "second", Creator: "missing"},
+		{Name: "third", Creator: "creator"},
+	})
+	assert.Error(t, err)
+	require.Len(t, created, 1)
+	assert.Equal(t, "first", created[0].Name)
+	assert.NotEmpty(t, created[0].CID)
+}
+
+func TestMockTransact(t *testing.T) {
+	join := func(ctx context.Context, tx db.TLADB) error {
+		c, err := tx.LoadClass(ctx, "class")
+		if err != nil {
+			return err
+		}
+		u, err := tx.LoadUser(ctx, "user")
+		if err != nil {
+			return err
+		}
+		c.AddMember(u.UID)
+		u.AddClass(c.CID)
+		if err := tx.StoreClass(ctx, c); err != nil {
+			return err
+		}
+		return tx.StoreUser(ctx, u)
+	}
+	setup := func() *db.MockDB {
+		return db.OpenMockWith(
+			[]db.User{{UID: "user"}},
+			nil,
+			[]db.Class{{CID: "class", Members: []string{}}},
+		)
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		ctx := context.Background()
+		d := setup()
+		require.NoError(t, d.Transact(ctx, func(tx db.TLADB) error {
+			return join(ctx, tx)
+		}))
+
+		c, err := d.LoadClass(ctx, "class")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user"}, c.Members)
+		u, err := d.LoadUser(ctx, "user")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"class"}, u.Classes)
+	})
+	t.Run("rollback", func(t *testing.T) {
+		ctx := context.Background()
+		d := setup()
+		forced := errors.New("forced")
+		d.SetFailure("StoreUser", forced)
+
+		// the class is stored before the user fails to be.
+		err := d.Transact(ctx, func(tx db.TLADB) error {
+			return join(ctx, tx)
+		})
+		assert.Equal(t, forced, err)
+
+		c, err := d.LoadClass(ctx, "class")
+		require.NoError(t, err)
+		assert.Empty(t, c.Members)
+		u, err := d.LoadUser(ctx, "user")
+		require.NoError(t, err)
+		assert.Empty(t, u.Classes)
+	})
+}
+
+func TestMockConcurrency(t *testing.T) {
+	d := db.OpenMock()
+	require.NoError(t, d.StoreClass(context.Background(), db.Class{CID: "class"}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := context.Background()
+			uid := fmt.Sprintf("user%d", i)
+			switch i % 5 {
+			case 0:
+				assert.NoError(t, d.StoreUser(ctx, db.User{UID: uid}))
+			case 1:
+				_, _ = d.LoadUser(ctx, uid)
+				_, _ = d.DisplayNameExists(ctx, uid)
+			case 2:
+				_, err := d.InsertProgram(ctx, db.Program{Name: uid})
+				assert.NoError(t, err)
+			case 3:
+				_, err := d.ModifyClass(ctx, "class", func(c *db.Class) error {
+					c.AddMember(uid)
+					return nil
+				})
+				assert.NoError(t, err)
+			case 4:
+				_, err := d.LoadClass(ctx, "class")
+				assert.NoError(t, err)
+				d.Snapshot()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	users, programs, _ := d.Snapshot()
+	assert.Equal(t, 10, users)
+	assert.Equal(t, 10, programs)
+	c, err := d.LoadClass(context.Background(), "class")
+	require.NoError(t, err)
+	assert.Len(t, c.Members, 10)
+}
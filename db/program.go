@@ -2,7 +2,13 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"cloud.google.com/go/firestore"
 	"github.com/labstack/echo/v4"
@@ -20,7 +26,78 @@ type Program struct {
 	Name        string `firestore:"name" json:"name"`
 	Thumbnail   int64  `firestore:"thumbnail" json:"thumbnail"`
 	UID         string `json:"uid"`
-	WID         string `json:"wid"` // Optional WID of class associated with program
+	WID         string `json:"wid"`                               // Optional WID of class associated with program
+	ForkedFrom  string `firestore:"forkedFrom" json:"forkedFrom"` // Optional PID of the program this was forked from
+
+	// Notes are the owner's annotations on the program.
+	// They are only ever displayed, never executed.
+	Notes string `firestore:"notes" json:"notes"`
+
+	// InstructorOnly programs in a class library, such as
+	// templates, are hidden from students of the class.
+	InstructorOnly bool `firestore:"instructorOnly" json:"instructorOnly"`
+
+	// Version is incremented every time the program is saved,
+	// and SavedAt records when that last happened.
+	Version int64  `firestore:"version" json:"version"`
+	SavedAt string `firestore:"savedAt" json:"savedAt"`
+
+	// UpdatedAt records when the program document was last
+	// stored after it was created, for any reason, such as an
+	// admin remapping its thumbnail. It is kept up to date by
+	// the database layer. Empty means the program has not been
+	// stored since it was created.
+	UpdatedAt string `firestore:"updatedAt" json:"updatedAt"`
+
+	// DeletedAt records when the program was deleted. Deleted
+	// programs are kept so that they can be restored. Empty
+	// means the program is not deleted.
+	DeletedAt string `firestore:"deletedAt" json:"deletedAt,omitempty"`
+}
+
+// ProgramActivity holds just the timestamps of a program, for
+// when its contents are not needed.
+type ProgramActivity struct {
+	PID         string `firestore:"-" json:"pid"`
+	DateCreated string `firestore:"dateCreated" json:"dateCreated"`
+	SavedAt     string `firestore:"savedAt" json:"savedAt"`
+	UpdatedAt   string `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// LastSaved returns when the program was last saved. Programs
+// saved before SavedAt was recorded fall back to UpdatedAt,
+// which only changed on saves until then.
+func (a *ProgramActivity) LastSaved() string {
+	if a.SavedAt != "" {
+		return a.SavedAt
+	}
+	return a.UpdatedAt
+}
+
+// Touch marks the program as saved, and should be called
+// whenever a program's contents are changed. Edits to metadata
+// alone, such as its name or notes, are not saves.
+func (p *Program) Touch() {
+	p.Version++
+	p.SavedAt = time.Now().UTC().String()
+}
+
+// LastSaved returns when the program was last saved, as
+// ProgramActivity.LastSaved does.
+func (p *Program) LastSaved() string {
+	a := ProgramActivity{SavedAt: p.SavedAt, UpdatedAt: p.UpdatedAt}
+	return a.LastSaved()
+}
+
+// stamp records that the program is being stored now.
+func (p *Program) stamp() {
+	p.UpdatedAt = time.Now().UTC().String()
+}
+
+// Deleted returns whether the program has been deleted, but
+// can still be restored.
+func (p *Program) Deleted() bool {
+	return p.DeletedAt != ""
 }
 
 // ToFirestoreUpdate returns the []firestore.Update representation
@@ -43,15 +120,206 @@ func (p *Program) ToFirestoreUpdate() (up []firestore.Update) {
 	return
 }
 
+// ProgramUpdate is a partial Program, as sent to UpdateProgram.
+// InstructorOnly is a pointer so that the flag can be cleared
+// as well as set; it is left unchanged when nil.
+type ProgramUpdate struct {
+	Program
+	InstructorOnly *bool `json:"instructorOnly"`
+}
+
+// ToFirestoreUpdate returns the []firestore.Update representation
+// of this struct, as Program.ToFirestoreUpdate does, along with
+// InstructorOnly if it is set.
+func (p *ProgramUpdate) ToFirestoreUpdate() []firestore.Update {
+	up := p.Program.ToFirestoreUpdate()
+	if p.InstructorOnly != nil {
+		up = append(up, firestore.Update{Path: "instructorOnly", Value: *p.InstructorOnly})
+	}
+	return up
+}
+
+// CanViewProgram returns whether the user with the given uid
+// may see the program. InstructorOnly programs are only visible
+// to their owner and to the instructors of their class; every
+// other program is visible to anyone with its pid.
+func CanViewProgram(ctx context.Context, d TLADB, uid string, p Program) bool {
+	if !p.InstructorOnly {
+		return true
+	}
+	if uid == "" {
+		return false
+	}
+	if u, err := d.LoadUser(ctx, uid); err == nil && u.HasProgram(p.UID) {
+		return true
+	}
+	if p.WID == "" {
+		return false
+	}
+	class, err := d.LoadClassByWID(ctx, p.WID)
+	if err != nil {
+		return false
+	}
+	return class.Creator == uid || class.IsInstructor(uid)
+}
+
+// errCodeTooLarge is returned when a program's code exceeds
+// the size limit that applies to it.
+var errCodeTooLarge = errors.New("program code is too large")
+
+// errNotOwner is returned when a user acts on a program that
+// they do not own.
+var errNotOwner = errors.New("given user does not own program")
+
+// defaultProgramCreateCooldown is how long users must wait
+// between creating programs unless ProgramCreateCooldown is set.
+const defaultProgramCreateCooldown = 3 * time.Second
+
+// programCreations throttles how often each user may create
+// a program.
+var programCreations = httpext.NewThrottle(programCreateCooldown())
+
+// ProgramCreateWait returns how long the user with the given uid
+// must wait before creating another program, or zero if they
+// may create one now.
+func ProgramCreateWait(uid string) time.Duration {
+	return programCreations.Wait(uid)
+}
+
+// RecordProgramCreate starts the cooldown of the user with the
+// given uid, for programs created outside of CreateProgram.
+func RecordProgramCreate(uid string) {
+	programCreations.Record(uid)
+}
+
+// programCreateCooldown returns the configured cooldown between
+// program creations.
+func programCreateCooldown() time.Duration {
+	if ProgramCreateCooldown == "" {
+		return defaultProgramCreateCooldown
+	}
+	cooldown, err := time.ParseDuration(ProgramCreateCooldown)
+	if err != nil {
+		return defaultProgramCreateCooldown
+	}
+	return cooldown
+}
+
+// ProgramError describes every problem found with a program.
+type ProgramError struct {
+	Problems []string
+}
+
+func (e *ProgramError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the name, language, and thumbnail of the
+// program, returning a *ProgramError listing every problem
+// found, or nil if there are none.
+func (p *Program) Validate() error {
+	return p.check(false)
+}
+
+// ValidateUpdate is Validate for a partial program, as sent to
+// update a program. Empty fields are left unchanged by updates,
+// so they are not checked.
+func (p *Program) ValidateUpdate() error {
+	return p.check(true)
+}
+
+// check does the work of Validate and ValidateUpdate, skipping
+// empty fields if partial is set.
+func (p *Program) check(partial bool) error {
+	problems := make([]string, 0)
+	switch {
+	case p.Name == "" && !partial:
+		problems = append(problems, "program name cannot be empty")
+	case utf8.RuneCountInString(p.Name) > MaxProgramNameLength:
+		problems = append(problems, fmt.Sprintf("program name cannot be longer than %d characters", MaxProgramNameLength))
+	}
+	if p.Language != "" || !partial {
+		if _, err := LanguageCode(p.Language); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if !ValidThumbnail(p.Thumbnail) {
+		problems = append(problems, "thumbnail index out of bounds")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ProgramError{Problems: problems}
+}
+
+// ValidateProgram checks a program against the rules that
+// apply when programs are created, returning a description
+// of each problem found. codeLimit is the largest that the
+// program's code may be.
+func ValidateProgram(p Program, codeLimit int) []string {
+	// programs created without a name are named after their
+	// language.
+	if p.Name == "" {
+		p.Name = p.Language
+	}
+
+	problems := make([]string, 0)
+	if err := p.Validate(); err != nil {
+		problems = append(problems, err.(*ProgramError).Problems...)
+	}
+	if len(p.Code) > codeLimit {
+		problems = append(problems, errCodeTooLarge.Error())
+	}
+	return problems
+}
+
+// codeLimit returns the largest the code of the program with
+// the given pid may be, accounting for the limit of the class
+// it belongs to, if any.
+func (d *DB) codeLimit(ctx context.Context, tx *firestore.Transaction, pid string) (int, error) {
+	psnap, err := tx.Get(d.Collection(programsPath).Doc(pid))
+	if err != nil {
+		return 0, err
+	}
+	p := Program{}
+	if err := psnap.DataTo(&p); err != nil {
+		return 0, err
+	}
+	if p.WID == "" {
+		return MaxCodeBytes, nil
+	}
+
+	cid, err := d.GetUIDFromWID(ctx, p.WID, classesAliasPath)
+	if err != nil {
+		return 0, err
+	}
+	csnap, err := tx.Get(d.Collection(classesPath).Doc(cid))
+	if err != nil {
+		return 0, err
+	}
+	class := Class{}
+	if err := csnap.DataTo(&class); err != nil {
+		return 0, err
+	}
+	return class.CodeLimit(), nil
+}
+
 // GetProgram retrieves information about a single program.
+// Deleted programs are only returned if the includeDeleted
+// query parameter is "true". InstructorOnly programs are only
+// returned to the user given by the uid query parameter if
+// they may see it, as decided by CanViewProgram.
 //
-// Query parameters: pid
+// Query parameters: pid, uid, includeDeleted
 //
-// Returns status 200 OK with a marshalled Program struct.
+// Returns status 200 OK with a marshalled Program struct, 403
+// if the user may not see the program, or 404 if the program
+// does not exist or is deleted.
 func (d *DB) GetProgram(c echo.Context) error {
 	pid := c.QueryParam("pid")
 	if pid == "" {
-		return c.String(http.StatusBadRequest, "pid is required")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "pid is required")
 	}
 
 	// attempt to acquire doc.
@@ -59,21 +327,34 @@ func (d *DB) GetProgram(c echo.Context) error {
 	ref := d.Collection(programsPath).Doc(pid)
 	doc, err := ref.Get(c.Request().Context())
 	if err != nil {
-		return c.String(http.StatusNotFound, errors.Wrap(err, "failed to locate program").Error())
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "failed to locate program").Error())
 	}
 	if err := doc.DataTo(&p); err != nil {
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to marshal data").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to marshal data").Error())
+	}
+
+	if p.Deleted() && c.QueryParam("includeDeleted") != "true" {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, "program has been deleted")
 	}
 
 	// update UID field and respond.
 	p.UID = ref.ID
+	if !CanViewProgram(c.Request().Context(), d, c.QueryParam("uid"), p) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "program is only visible to instructors of its class")
+	}
 	return c.JSON(http.StatusOK, &p)
 }
 
 // UpdateProgram expects an array of partial Program structs
-// and a UID of the user they belong to. If the user pointed
+// and a UID of the user they belong to. Only the non-zero
+// fields of each partial program are written, so fields left
+// out of the request keep their values. If the user pointed
 // to by UID does not own the programs passed to update,
-// no programs are updated.
+// no programs are updated and a 403 is returned. The
+// instructorOnly flag is changed whenever it is given, so it
+// can be cleared as well as set. Code larger
+// than MaxCodeBytes, or the limit of the program's class, is
+// rejected.
 //
 // Request Body:
 // {
@@ -81,17 +362,27 @@ func (d *DB) GetProgram(c echo.Context) error {
 //     "programs": [array of partial program objects as indexed in user]
 // }
 //
-// Returns status 200 OK on nominal request.
+// Returns status 200 OK on nominal request, 400 if a program
+// is invalid, 403 if the user does not own every program, or
+// 413 if code is too large.
 func (d *DB) UpdateProgram(c echo.Context) error {
 	var body struct {
-		UID      string             `json:"uid"`
-		Programs map[string]Program `json:"programs"`
+		UID      string                   `json:"uid"`
+		Programs map[string]ProgramUpdate `json:"programs"`
 	}
 	if err := httpext.RequestBodyTo(c.Request(), &body); err != nil {
-		return c.String(http.StatusInternalServerError, "failed to read request body")
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, "failed to read request body")
 	}
 	if body.UID == "" {
-		return c.String(http.StatusBadRequest, "a uid is required")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "a uid is required")
+	}
+	if err := ValidateUID(body.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+	for _, p := range body.Programs {
+		if err := p.ValidateUpdate(); err != nil {
+			return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, err.Error())
+		}
 	}
 
 	err := d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
@@ -114,22 +405,50 @@ func (d *DB) UpdateProgram(c echo.Context) error {
 				}
 			}
 			if !belongsTo {
-				return errors.Errorf("specified program is out of bounds for user %s", body.UID)
+				return errNotOwner
 			}
 
-			// update the program
+			// check the code against the applicable size limit.
+			if p.Code != "" {
+				limit, err := d.codeLimit(ctx, tx, id)
+				if err != nil {
+					return err
+				}
+				if len(p.Code) > limit {
+					return errCodeTooLarge
+				}
+			}
+		}
+
+		for id, p := range body.Programs {
+			// update the program. Only changes to its contents
+			// count as saving it.
 			pref := d.Collection(programsPath).Doc(id)
-			if err := tx.Update(pref, p.ToFirestoreUpdate()); err != nil {
+			update := p.ToFirestoreUpdate()
+			if len(p.Program.ToFirestoreUpdate()) != 0 {
+				update = append(update,
+					firestore.Update{Path: "version", Value: firestore.Increment(1)},
+					firestore.Update{Path: "savedAt", Value: time.Now().UTC().String()},
+				)
+			}
+			update = stamped(update...)
+			if err := tx.Update(pref, update); err != nil {
 				return err
 			}
 		}
 		return nil
 	})
 	if err != nil {
+		if err == errCodeTooLarge {
+			return httpext.Error(c, http.StatusRequestEntityTooLarge, httpext.CodeTooLarge, err.Error())
+		}
+		if err == errNotOwner {
+			return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, err.Error())
+		}
 		if status.Code(err) == codes.NotFound {
-			return c.String(http.StatusNotFound, errors.Wrap(err, "program ID could not be found").Error())
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "program ID could not be found").Error())
 		}
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to write update(s) to database").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to write update(s) to database").Error())
 	}
 
 	return c.String(http.StatusOK, "")
@@ -147,10 +466,15 @@ func (d *DB) UpdateProgram(c echo.Context) error {
 //        language: language string
 //        name: name of the program
 //        code: [optional code for the program]
+//        instructorOnly: [optional, hides the program from students of the class]
 //    }
 // }
 //
-// Returns 201 created on success. TODO: postman docs
+// Users must wait between creating programs; creating one too
+// soon after the last is rejected with 429.
+//
+// Returns 201 created on success, with a Location header
+// pointing at the new program. TODO: postman docs
 func (d *DB) CreateProgram(c echo.Context) error {
 	var requestBody struct {
 		UID  string  `json:"uid"`
@@ -158,20 +482,28 @@ func (d *DB) CreateProgram(c echo.Context) error {
 		Prog Program `json:"program"`
 	}
 	if err := httpext.RequestBodyTo(c.Request(), &requestBody); err != nil {
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if err := ValidateUID(requestBody.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+
+	// throttle users creating programs in quick succession. The
+	// creation is only recorded once it succeeds, so that bad
+	// requests do not lock the user out.
+	if wait := programCreations.Wait(requestBody.UID); wait > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return httpext.Error(c, http.StatusTooManyRequests, httpext.CodeRateLimited, "creating programs too quickly, try again later")
 	}
 
 	// check that language exists.
 	p := defaultProgram(requestBody.Prog.Language)
 	if p.Code == "" {
-		return c.String(http.StatusBadRequest, "language does not exist")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "language does not exist")
 	}
 
-	// thumbnail should be within range.
-	if requestBody.Prog.Thumbnail > thumbnailCount || requestBody.Prog.Thumbnail < 0 {
-		return c.String(http.StatusBadRequest, "thumbnail index out of bounds")
-	}
 	p.Thumbnail = requestBody.Prog.Thumbnail
+	p.InstructorOnly = requestBody.Prog.InstructorOnly
 
 	// add code if provided.
 	if requestBody.Prog.Code != "" {
@@ -182,6 +514,9 @@ func (d *DB) CreateProgram(c echo.Context) error {
 	if requestBody.Prog.Name != "" {
 		p.Name = requestBody.Prog.Name
 	}
+	if err := p.Validate(); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, err.Error())
+	}
 
 	wid := requestBody.WID
 	var cid string
@@ -199,6 +534,15 @@ func (d *DB) CreateProgram(c echo.Context) error {
 		}
 	}
 
+	// code should be within the applicable size limit.
+	limit := MaxCodeBytes
+	if class != nil {
+		limit = class.CodeLimit()
+	}
+	if len(p.Code) > limit {
+		return httpext.Error(c, http.StatusRequestEntityTooLarge, httpext.CodeTooLarge, errCodeTooLarge.Error())
+	}
+
 	// create the program doc.
 	err := d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
 		// create program
@@ -217,9 +561,19 @@ func (d *DB) CreateProgram(c echo.Context) error {
 		u.Programs = append(u.Programs, pRef.ID)
 		if wid != "" {
 			classRef := d.Collection(classesPath).Doc(cid)
-			err := tx.Update(classRef, []firestore.Update{
-				{Path: "programs", Value: firestore.ArrayUnion(pRef.ID)},
-			})
+			csnap, err := tx.Get(classRef)
+			if err != nil {
+				return err
+			}
+			if err := csnap.DataTo(class); err != nil {
+				return err
+			}
+			class.AddProgram(pRef.ID)
+
+			err = tx.Update(classRef, stamped(
+				firestore.Update{Path: "programs", Value: firestore.ArrayUnion(pRef.ID)},
+				firestore.Update{Path: "stats", Value: class.Stats},
+			))
 
 			p.WID = class.WID
 			if err != nil {
@@ -236,15 +590,68 @@ func (d *DB) CreateProgram(c echo.Context) error {
 	})
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			return c.String(http.StatusNotFound, errors.Wrap(err, "failed to find user document").Error())
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, errors.Wrap(err, "failed to find user document").Error())
 		}
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to create program and associate to user or class").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to create program and associate to user or class").Error())
 	}
+	programCreations.Record(requestBody.UID)
 
+	c.Response().Header().Set(echo.HeaderLocation, "/program/get?pid="+p.UID)
 	return c.JSON(http.StatusCreated, p)
 }
 
-// DeleteProgram deletes a program entry from a user.
+// trashProgram marks a program owned by the given user as
+// deleted, leaving it in place so that it can be restored.
+func (d *DB) trashProgram(c echo.Context, uid, pid string) error {
+	err := d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
+		usnap, err := tx.Get(d.Collection(usersPath).Doc(uid))
+		if err != nil {
+			return err
+		}
+		owner := User{}
+		if err := usnap.DataTo(&owner); err != nil {
+			return err
+		}
+
+		belongsTo := false
+		for _, userProg := range owner.Programs {
+			if pid == userProg {
+				belongsTo = true
+				break
+			}
+		}
+		if !belongsTo {
+			return errNotOwner
+		}
+
+		pref := d.Collection(programsPath).Doc(pid)
+		if _, err := tx.Get(pref); err != nil {
+			return err
+		}
+		return tx.Update(pref, stamped(
+			firestore.Update{Path: "deletedAt", Value: time.Now().UTC().String()},
+		))
+	})
+	if err != nil {
+		if err == errNotOwner {
+			return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, err.Error())
+		}
+		if status.Code(err) == codes.NotFound {
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeNotFound, "user or program does not exist")
+		}
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to commit transaction to database").Error())
+	}
+	return c.String(http.StatusOK, "")
+}
+
+// DeleteProgram deletes a program entry from a user. Unless
+// the hard query parameter is "true", the program is only
+// marked as deleted, and can be brought back with
+// handler.RestoreProgram.
+//
+// A hard deletion removes the program for good. The program
+// is also removed from the library of each class of the user
+// that still lists it.
 //
 // Request Body:
 // {
@@ -252,7 +659,11 @@ func (d *DB) CreateProgram(c echo.Context) error {
 //    pid: string
 // }
 //
-// Returns status 200 OK on deletion.
+// Query Parameters:
+//  - hard string: Whether to remove the program for good.
+//
+// Returns status 200 OK on deletion, or 403 if the user does
+// not own the program.
 func (d *DB) DeleteProgram(c echo.Context) error {
 	// acquire parameters via anonymous struct.
 	var req struct {
@@ -260,12 +671,20 @@ func (d *DB) DeleteProgram(c echo.Context) error {
 		PID string `json:"pid"`
 	}
 	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
 	}
 	if req.UID == "" || req.PID == "" {
-		return c.String(http.StatusBadRequest, "uid and idx fields are both required")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and idx fields are both required")
+	}
+	if err := ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+	if c.QueryParam("hard") != "true" {
+		return d.trashProgram(c, req.UID, req.PID)
 	}
 
+	var userDoc User
+	toDelete := ""
 	err := d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
 		// remove program from user list
 		uref := d.Collection(usersPath).Doc(req.UID)
@@ -273,23 +692,23 @@ func (d *DB) DeleteProgram(c echo.Context) error {
 		if err != nil {
 			return err
 		}
-		userDoc := User{}
+		userDoc = User{}
 		if err := uSnap.DataTo(&userDoc); err != nil {
 			return err
 		}
 
 		// get pid to delete then remove the entry
-		idx := 0
+		idx := -1
 		for i, p := range userDoc.Programs {
 			if p == req.PID {
 				idx = i
 				break
 			}
 		}
-		if idx >= len(userDoc.Programs) {
-			return errors.New("invalid PID")
+		if idx < 0 {
+			return errNotOwner
 		}
-		toDelete := userDoc.Programs[idx]
+		toDelete = userDoc.Programs[idx]
 		userDoc.Programs = append(userDoc.Programs[:idx], userDoc.Programs[idx+1:]...)
 
 		pref := d.Collection(programsPath).Doc(toDelete)
@@ -309,9 +728,20 @@ func (d *DB) DeleteProgram(c echo.Context) error {
 				return err
 			}
 			classRef := d.Collection(classesPath).Doc(cid)
-			if err := tx.Update(classRef, []firestore.Update{
-				{Path: "programs", Value: firestore.ArrayRemove(toDelete)},
-			}); err != nil {
+			cSnap, err := tx.Get(classRef)
+			if err != nil {
+				return err
+			}
+			class := Class{}
+			if err := cSnap.DataTo(&class); err != nil {
+				return err
+			}
+			class.RemoveProgram(toDelete)
+
+			if err := tx.Update(classRef, stamped(
+				firestore.Update{Path: "programs", Value: firestore.ArrayRemove(toDelete)},
+				firestore.Update{Path: "stats", Value: class.Stats},
+			)); err != nil {
 				return err
 			}
 		}
@@ -323,74 +753,23 @@ func (d *DB) DeleteProgram(c echo.Context) error {
 		return tx.Delete(pref)
 	})
 	if err != nil {
+		if err == errNotOwner {
+			return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, err.Error())
+		}
 		if status.Code(err) == codes.NotFound {
-			return c.String(http.StatusNotFound, "user or program does not exist")
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeNotFound, "user or program does not exist")
 		}
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to commit transaction to database").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to commit transaction to database").Error())
 	}
 
-	return c.String(http.StatusOK, "")
-}
-
-// ForkProgram forks a program `pid` to the user `uid`.
-//
-// Request Body:
-// {
-//    uid string
-//    pid string
-// }
-//
-// Returns status 201 created on success.
-func (d *DB) ForkProgram(c echo.Context) error {
-	// validate request structure
-	var body struct {
-		UID string `json:"uid"`
-		PID string `json:"pid"`
-	}
-	if err := httpext.RequestBodyTo(c.Request(), &body); err != nil {
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
-	}
-	if body.UID == "" || body.PID == "" {
-		return c.String(http.StatusBadRequest, "uid and pid are both required")
-	}
-
-	forkedProgram := Program{}
-	err := d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
-		uref := d.Collection(usersPath).Doc(body.UID)
-		pref := d.Collection(programsPath).Doc(body.PID)
-		pSnap, err := tx.Get(pref)
-		if err != nil {
-			return err
-		}
-
-		// copy program
-		newProgram := d.Collection(programsPath).NewDoc()
-		if err := tx.Create(newProgram, pSnap); err != nil {
-			return err
-		}
-
-		// TODO: strong potential for code lifting here.
-		userSnap, err := tx.Get(uref)
-		u := User{}
-		if err != nil {
-			return err
-		}
-		if err := userSnap.DataTo(&u); err != nil {
-			return err
-		}
-
-		u.Programs = append(u.Programs, newProgram.ID)
-		if err := tx.Set(uref, u.ToFirestoreUpdate()); err != nil {
-			return err
+	// other classes of the user may still list the program, such
+	// as ones it was moved out of. RemoveProgramFromClass leaves
+	// the classes that do not list it untouched.
+	for _, cid := range userDoc.Classes {
+		if err := d.RemoveProgramFromClass(c.Request().Context(), cid, toDelete); err != nil && status.Code(err) != codes.NotFound {
+			c.Logger().Warnf("Failed to remove deleted program with pid `%s` from class with cid `%s`: %v", toDelete, cid, err)
 		}
-		return pSnap.DataTo(&forkedProgram)
-	})
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			return c.String(http.StatusNotFound, "could not find the program or user")
-		}
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to fork program").Error())
 	}
 
-	return c.JSON(http.StatusCreated, forkedProgram)
+	return c.String(http.StatusOK, "")
 }
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -71,6 +72,88 @@ func TestGetProgram(t *testing.T) {
 	})
 }
 
+func TestProgramToFirestoreUpdate(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		p := Program{}
+		assert.Empty(t, p.ToFirestoreUpdate())
+	})
+	t.Run("OmittedFieldsSurvive", func(t *testing.T) {
+		p := Program{Name: "renamed"}
+		update := p.ToFirestoreUpdate()
+		require.Len(t, update, 1)
+		assert.Equal(t, "name", update[0].Path)
+		assert.Equal(t, "renamed", update[0].Value)
+	})
+	t.Run("AllFields", func(t *testing.T) {
+		p := Program{Code: "print()", Language: "python", Name: "name", Thumbnail: 2}
+		paths := make([]string, 0)
+		for _, u := range p.ToFirestoreUpdate() {
+			paths = append(paths, u.Path)
+		}
+		assert.Equal(t, []string{"code", "language", "name", "thumbnail"}, paths)
+	})
+}
+
+func TestProgramUpdateInstructorOnly(t *testing.T) {
+	paths := func(p ProgramUpdate) map[string]interface{} {
+		m := make(map[string]interface{})
+		for _, u := range p.ToFirestoreUpdate() {
+			m[u.Path] = u.Value
+		}
+		return m
+	}
+
+	// the flag is left alone unless it is given, and can be
+	// cleared as well as set.
+	p := ProgramUpdate{}
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "renamed"}`), &p))
+	assert.Equal(t, map[string]interface{}{"name": "renamed"}, paths(p))
+	require.NoError(t, json.Unmarshal([]byte(`{"instructorOnly": true}`), &p))
+	assert.Equal(t, true, paths(p)["instructorOnly"])
+	require.NoError(t, json.Unmarshal([]byte(`{"instructorOnly": false}`), &p))
+	assert.Equal(t, false, paths(p)["instructorOnly"])
+}
+
+func TestProgramValidate(t *testing.T) {
+	valid := Program{Name: "turtles", Language: "python", Thumbnail: 3}
+	tests := []struct {
+		name     string
+		edit     func(*Program)
+		problems int
+	}{
+		{"Valid", func(p *Program) {}, 0},
+		{"EmptyName", func(p *Program) { p.Name = "" }, 1},
+		{"LongName", func(p *Program) { p.Name = strings.Repeat("é", MaxProgramNameLength+1) }, 1},
+		{"LongestName", func(p *Program) { p.Name = strings.Repeat("é", MaxProgramNameLength) }, 0},
+		{"MissingLanguage", func(p *Program) { p.Language = "" }, 1},
+		{"UnknownLanguage", func(p *Program) { p.Language = "cobol" }, 1},
+		{"NegativeThumbnail", func(p *Program) { p.Thumbnail = -1 }, 1},
+		{"LargeThumbnail", func(p *Program) { p.Thumbnail = thumbnailCount }, 1},
+		{"Everything", func(p *Program) { *p = Program{Thumbnail: -1} }, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := valid
+			test.edit(&p)
+			err := p.Validate()
+			if test.problems == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			perr, ok := err.(*ProgramError)
+			require.True(t, ok, err)
+			assert.Len(t, perr.Problems, test.problems)
+		})
+	}
+
+	t.Run("Update", func(t *testing.T) {
+		assert.NoError(t, (&Program{}).ValidateUpdate())
+		assert.NoError(t, (&Program{Code: "print('hi')"}).ValidateUpdate())
+		assert.Error(t, (&Program{Language: "cobol"}).ValidateUpdate())
+		assert.Error(t, (&Program{Name: strings.Repeat("a", MaxProgramNameLength+1)}).ValidateUpdate())
+	})
+}
+
 func TestUpdateProgram(t *testing.T) {
 	d, err := Open(context.Background(), os.Getenv("TLACFG"))
 	require.NoError(t, err)
@@ -111,6 +194,19 @@ func TestUpdateProgram(t *testing.T) {
 			assert.Equal(t, http.StatusInternalServerError, rec.Code)
 		}
 	})
+	t.Run("NotOwner", func(t *testing.T) {
+		userDoc, err := d.Collection(usersPath).DocumentRefs(context.Background()).Next()
+		require.NoError(t, err)
+
+		body := fmt.Sprintf(`{"uid": %q, "programs": {"not-their-program": {"name": "tampered"}}}`, userDoc.ID)
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, d.UpdateProgram(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
 	// TODO: more rigorous integration tests
 }
 
@@ -144,6 +240,10 @@ func TestCreateProgram(t *testing.T) {
 		if assert.NoError(t, d.CreateProgram(c)) {
 			assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
 			assert.NotEmpty(t, rec.Result().Body)
+
+			p := Program{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+			assert.Equal(t, "/program/get?pid="+p.UID, rec.Header().Get(echo.HeaderLocation))
 		}
 	})
 }
@@ -184,19 +284,84 @@ func TestDeleteProgram(t *testing.T) {
 		b, err := json.Marshal(&request)
 		require.NoError(t, err)
 
-		// try to delete it
+		// a plain delete only marks the program as deleted.
 		req, rec := httptest.NewRequest(http.MethodDelete, "/", strings.NewReader(string(b))), httptest.NewRecorder()
 		c := echo.New().NewContext(req, rec)
 		if assert.NoError(t, d.DeleteProgram(c)) {
 			assert.Equal(t, http.StatusOK, rec.Code)
 
+			p, err := d.LoadProgram(context.Background(), request.PID)
+			require.NoError(t, err)
+			assert.True(t, p.Deleted())
+
+			req, rec := httptest.NewRequest(http.MethodGet, "/?pid="+request.PID, nil), httptest.NewRecorder()
+			require.NoError(t, d.GetProgram(echo.New().NewContext(req, rec)))
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+
+			req, rec = httptest.NewRequest(http.MethodGet, "/?includeDeleted=true&pid="+request.PID, nil), httptest.NewRecorder()
+			require.NoError(t, d.GetProgram(echo.New().NewContext(req, rec)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+
+		// a hard delete removes it for good.
+		req, rec = httptest.NewRequest(http.MethodDelete, "/?hard=true", strings.NewReader(string(b))), httptest.NewRecorder()
+		c = echo.New().NewContext(req, rec)
+		if assert.NoError(t, d.DeleteProgram(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+
 			// check that the program actually was deleted
 			_, err := programToDelete.Get(context.Background())
 			assert.Equal(t, codes.NotFound, status.Code(err))
 		}
 	})
+	t.Run("NotOwner", func(t *testing.T) {
+		// a pid the user does not own must not delete any of
+		// their programs.
+		uid := "delete-not-owner"
+		require.NoError(t, d.StoreUser(context.Background(), User{UID: uid, DisplayName: "not the owner"}))
+		defer d.DeleteUser(context.Background(), uid)
+
+		body := `{"uid": "` + uid + `", "pid": "not-their-program"}`
+		req, rec := httptest.NewRequest(http.MethodDelete, "/?hard=true", strings.NewReader(body)), httptest.NewRecorder()
+		if assert.NoError(t, d.DeleteProgram(echo.New().NewContext(req, rec))) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
 }
 
-func TestForkProgram(t *testing.T) {
-	// TODO
+func TestUpdateProgramLanguage(t *testing.T) {
+	// unknown languages are rejected before touching the
+	// database, so no connection is needed.
+	d := &DB{}
+	body := `{"uid": "test", "programs": {"pid": {"language": "cobol"}}}`
+	req, rec := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body)), httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	require.NoError(t, d.UpdateProgram(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "cobol")
+}
+
+func TestCreateProgramCooldown(t *testing.T) {
+	// requests with an unknown language are rejected before
+	// touching the database, so no connection is needed.
+	d := &DB{}
+	create := func() *httptest.ResponseRecorder {
+		body := `{"uid": "cooldown", "program": {"language": "not a language"}}`
+		req, rec := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, d.CreateProgram(c))
+		return rec
+	}
+
+	// rejected requests do not use up the cooldown.
+	rec := create()
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = create()
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// a successful creation does.
+	programCreations.Record("cooldown")
+	rec = create()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
 }
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+var errNoThumbnails = errors.New("collection does not have thumbnails")
+
+// ThumbnailRemap reports the outcome of remapping the
+// thumbnails of a collection.
+type ThumbnailRemap struct {
+	// Updated holds the IDs of documents whose thumbnail changed.
+	Updated []string `json:"updated"`
+	// Rejected maps the IDs of documents that could not be
+	// remapped to the reason why.
+	Rejected map[string]string `json:"rejected"`
+}
+
+func newThumbnailRemap() ThumbnailRemap {
+	return ThumbnailRemap{
+		Updated:  []string{},
+		Rejected: make(map[string]string),
+	}
+}
+
+// remap returns the thumbnail that the document with the given
+// id should have after applying mapping, and whether it needs
+// to be updated. Out of range results are recorded as rejected.
+func (r *ThumbnailRemap) remap(id string, thumbnail int64, mapping map[int64]int64) (int64, bool) {
+	next, ok := mapping[thumbnail]
+	if !ok || next == thumbnail {
+		return thumbnail, false
+	}
+	if !ValidThumbnail(next) {
+		r.Rejected[id] = errors.Errorf("thumbnail %d is out of range", next).Error()
+		return thumbnail, false
+	}
+
+	r.Updated = append(r.Updated, id)
+	return next, true
+}
+
+func (d *DB) RemapThumbnails(ctx context.Context, collection string, mapping map[int64]int64) (ThumbnailRemap, error) {
+	if collection != programsPath && collection != classesPath {
+		return ThumbnailRemap{}, errNoThumbnails
+	}
+
+	r := newThumbnailRemap()
+	iter := d.Collection(collection).Documents(ctx)
+	defer iter.Stop()
+
+	batch, pending := d.Batch(), 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return r, err
+		}
+
+		var data struct {
+			Thumbnail int64 `firestore:"thumbnail"`
+		}
+		if err := doc.DataTo(&data); err != nil {
+			r.Rejected[doc.Ref.ID] = err.Error()
+			continue
+		}
+		thumbnail, ok := r.remap(doc.Ref.ID, data.Thumbnail, mapping)
+		if !ok {
+			continue
+		}
+
+		batch.Update(doc.Ref, stamped(firestore.Update{Path: "thumbnail", Value: thumbnail}))
+		if pending++; pending == maxBatchWrites {
+			if _, err := batch.Commit(ctx); err != nil {
+				return r, err
+			}
+			batch, pending = d.Batch(), 0
+		}
+	}
+
+	if pending > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+func (d *MockDB) RemapThumbnails(_ context.Context, collection string, mapping map[int64]int64) (ThumbnailRemap, error) {
+	if err := d.fail("RemapThumbnails"); err != nil {
+		return ThumbnailRemap{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if collection != programsPath && collection != classesPath {
+		return ThumbnailRemap{}, errNoThumbnails
+	}
+
+	r := newThumbnailRemap()
+	for id, doc := range d.db[collection] {
+		switch v := doc.(type) {
+		case Program:
+			if thumbnail, ok := r.remap(id, v.Thumbnail, mapping); ok {
+				v.Thumbnail = thumbnail
+				v.stamp()
+				d.db[collection][id] = v
+			}
+		case Class:
+			if thumbnail, ok := r.remap(id, v.Thumbnail, mapping); ok {
+				v.Thumbnail = thumbnail
+				v.stamp()
+				d.db[collection][id] = v
+			}
+		}
+	}
+	return r, nil
+}
@@ -18,16 +18,97 @@ type DBContext struct {
 // Atomicity of operations on a TLADB are
 // implementation-dependent.
 type TLADB interface {
+	// Ping makes a cheap read to check that the database can
+	// be reached.
+	Ping(context.Context) error
+	// Transact runs fn against a TLADB whose writes are
+	// applied together once fn returns, and discarded if fn
+	// returns an error.
+	Transact(ctx context.Context, fn func(tx TLADB) error) error
+
 	LoadProgram(context.Context, string) (Program, error)
 	StoreProgram(context.Context, Program) error
+	// InsertProgram stores the program under a newly
+	// generated pid, returning the program with its pid set.
+	InsertProgram(context.Context, Program) (Program, error)
 	// Rename to DeleteProgram after moving API handler out of db/program.go
 	RemoveProgram(context.Context, string) error
+	// LoadPrograms loads the programs with the given pids in a
+	// single read, in the order given, skipping any that do
+	// not exist.
+	LoadPrograms(ctx context.Context, pids []string) ([]Program, error)
+	// LoadProgramActivity loads the timestamps of the programs
+	// with the given pids, skipping any that do not exist.
+	LoadProgramActivity(ctx context.Context, pids []string) ([]ProgramActivity, error)
+	// LoadProgramOwners loads the users owning the programs
+	// with the given pids, keyed by pid. Programs without an
+	// owner are left out.
+	LoadProgramOwners(ctx context.Context, pids []string) (map[string]User, error)
 
 	LoadClass(context.Context, string) (Class, error)
+	// LoadDiscoverableClasses loads every discoverable class.
+	LoadDiscoverableClasses(context.Context) ([]Class, error)
+	// LoadClassPage loads at most limit classes, ordered by
+	// cid, starting after the page that cursor points past. It
+	// returns the cursor of the next page, or "" if there are no
+	// more classes. An empty cursor starts from the first page.
+	LoadClassPage(ctx context.Context, cursor string, limit int) ([]Class, string, error)
+	// LoadClassByWID loads the class with the given wid,
+	// ignoring case. A class's wid is its join code, so this
+	// is also how classes are looked up by join code; there is
+	// intentionally no separate JoinCode field to keep in sync.
+	LoadClassByWID(ctx context.Context, wid string) (Class, error)
 	StoreClass(context.Context, Class) error
+	// ModifyClass atomically applies update to the class with
+	// the given cid and stores the result, unless update
+	// returns an error. It returns the updated class.
+	ModifyClass(ctx context.Context, cid string, update func(*Class) error) (Class, error)
+	// UpdateClass sets the fields set by u on the class with
+	// the given cid, keeping its stats up to date.
+	UpdateClass(ctx context.Context, cid string, u *ClassUpdate) error
+	// InsertClass stores the class under a newly generated
+	// cid and wid, returning the class with both set.
+	InsertClass(context.Context, Class) (Class, error)
+	// InsertClasses inserts each class as InsertClass does,
+	// in batches, and adds each to its creator's classes. On
+	// error, the classes that were created before it are still
+	// returned, in order.
+	InsertClasses(context.Context, []Class) ([]Class, error)
 	DeleteClass(context.Context, string) error
+	// MoveClassProgram moves the program with the given pid
+	// from the library of one class to another. It returns
+	// ErrProgramNotInClass, ErrProgramInClass, or ErrClassFull
+	// if the classes, as read in the same transaction, do not
+	// allow the move.
+	MoveClassProgram(ctx context.Context, pid, from, to string) error
+	// RemoveProgramFromClass removes the program with the given
+	// pid from the library of a class, if it is there.
+	RemoveProgramFromClass(ctx context.Context, cid string, pid string) error
 
 	LoadUser(context.Context, string) (User, error)
 	StoreUser(context.Context, User) error
 	DeleteUser(context.Context, string) error
+	// DisplayNameExists returns whether a user has the given
+	// display name, ignoring case and surrounding whitespace.
+	// Only users with a display name key are considered.
+	DisplayNameExists(ctx context.Context, name string) (bool, error)
+	// BackfillDisplayNameKeys sets the display name key of
+	// every user whose key is missing or out of date, such as
+	// users created before keys were kept, returning how many
+	// users were updated.
+	BackfillDisplayNameKeys(ctx context.Context) (int, error)
+
+	// RemapThumbnails replaces the thumbnails of documents in
+	// the given collection according to mapping, reporting
+	// which documents were updated or rejected.
+	RemapThumbnails(ctx context.Context, collection string, mapping map[int64]int64) (ThumbnailRemap, error)
+	// AuditProgramLanguages reports every program whose
+	// language is missing or unknown. If fix is a language,
+	// their language is replaced with it.
+	AuditProgramLanguages(ctx context.Context, fix string) (LanguageAudit, error)
+	// FindJoinCodeCollisions reports every join code shared by
+	// more than one class. If fix is set, all but one class in
+	// each collision, preferably the one the code resolves to,
+	// are given a new join code, as are their programs.
+	FindJoinCodeCollisions(ctx context.Context, fix bool) (JoinCodeCollisions, error)
 }
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// txDB is a TLADB whose program, class, and user reads and
+// writes go through a Firestore transaction. Every other
+// operation falls through to the underlying DB, outside of
+// the transaction.
+//
+// As with any Firestore transaction, all reads must be made
+// before the first write.
+type txDB struct {
+	*DB
+	tx *firestore.Transaction
+}
+
+// Transact runs fn in a Firestore transaction, so that the
+// loads and stores it makes on the given TLADB are applied
+// together or not at all. If fn returns an error, none of
+// its writes are applied. fn may be run more than once if
+// the transaction contends with another.
+//
+// It is not named RunTransaction so as not to shadow the
+// method of the embedded Firestore client.
+func (d *DB) Transact(ctx context.Context, fn func(tx TLADB) error) error {
+	return d.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		return fn(&txDB{DB: d, tx: tx})
+	})
+}
+
+func (t *txDB) LoadProgram(_ context.Context, pid string) (Program, error) {
+	doc, err := t.tx.Get(t.Collection(programsPath).Doc(pid))
+	if err != nil {
+		return Program{}, err
+	}
+
+	p := Program{}
+	if err := doc.DataTo(&p); err != nil {
+		return Program{}, err
+	}
+	p.UID = doc.Ref.ID
+	return p, nil
+}
+
+func (t *txDB) InsertProgram(_ context.Context, p Program) (Program, error) {
+	ref := t.Collection(programsPath).NewDoc()
+	p.UID = ref.ID
+	if err := t.tx.Create(ref, &p); err != nil {
+		return Program{}, err
+	}
+	return p, nil
+}
+
+func (t *txDB) StoreProgram(_ context.Context, p Program) error {
+	p.stamp()
+	return t.tx.Set(t.Collection(programsPath).Doc(p.UID), &p)
+}
+
+func (t *txDB) RemoveProgram(_ context.Context, pid string) error {
+	return t.tx.Delete(t.Collection(programsPath).Doc(pid))
+}
+
+func (t *txDB) LoadClass(_ context.Context, cid string) (Class, error) {
+	doc, err := t.tx.Get(t.Collection(classesPath).Doc(cid))
+	if err != nil {
+		return Class{}, err
+	}
+
+	c := Class{}
+	if err := doc.DataTo(&c); err != nil {
+		return Class{}, err
+	}
+	return c, nil
+}
+
+// InsertClass creates the class and its alias in the
+// transaction. Only the wid counter is advanced outside of it,
+// so a failed transaction leaves an unused wid at worst.
+func (t *txDB) InsertClass(ctx context.Context, c Class) (Class, error) {
+	ref := t.Collection(classesPath).NewDoc()
+	c.CID = ref.ID
+	wid, err := t.nextWID(ctx, classesAliasPath)
+	if err != nil {
+		return Class{}, err
+	}
+	c.WID = wid
+	c.touch()
+	c.DateCreated = time.Now().UTC().String()
+
+	if err := t.tx.Set(t.Collection(classesAliasPath).Doc(wid), map[string]interface{}{
+		"target": c.CID,
+	}); err != nil {
+		return Class{}, err
+	}
+	if err := t.tx.Create(ref, &c); err != nil {
+		return Class{}, err
+	}
+	return c, nil
+}
+
+func (t *txDB) StoreClass(_ context.Context, c Class) error {
+	c.stamp()
+	return t.tx.Set(t.Collection(classesPath).Doc(c.CID), &c)
+}
+
+func (t *txDB) DeleteClass(_ context.Context, cid string) error {
+	return t.tx.Delete(t.Collection(classesPath).Doc(cid))
+}
+
+func (t *txDB) LoadUser(_ context.Context, uid string) (User, error) {
+	doc, err := t.tx.Get(t.Collection(usersPath).Doc(uid))
+	if err != nil {
+		return User{}, err
+	}
+
+	u := User{}
+	if err := doc.DataTo(&u); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+func (t *txDB) StoreUser(_ context.Context, u User) error {
+	return t.tx.Set(t.Collection(usersPath).Doc(u.UID), &u)
+}
+
+func (t *txDB) DeleteUser(_ context.Context, uid string) error {
+	return t.tx.Delete(t.Collection(usersPath).Doc(uid))
+}
@@ -3,7 +3,9 @@ package db
 import (
 	"context"
 	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/uclaacm/teach-la-go-backend/httpext"
@@ -25,21 +27,166 @@ type User struct {
 	Programs          []string `firestore:"programs" json:"programs"`
 	UID               string   `json:"uid"`
 	DeveloperAcc      bool     `firestore:"developerAcc" json:"developerAcc"`
+
+	// Admin users may use administrative handlers. It is
+	// never set through the API, only directly in the database.
+	Admin bool `firestore:"admin" json:"admin"`
+
+	// DisplayNameKey is the normalized form of DisplayName,
+	// kept so that display names can be looked up regardless
+	// of case and surrounding whitespace.
+	DisplayNameKey string `firestore:"displayNameKey" json:"-"`
+
+	// Timezone is the IANA name of the zone the user lives
+	// in. Empty means UTC.
+	Timezone string `firestore:"timezone" json:"timezone"`
+
+	// NotificationPrefs holds which notifications the user
+	// wants. Nil means the user has never set them, and the
+	// defaults apply.
+	NotificationPrefs *NotificationPrefs `firestore:"notificationPrefs" json:"notificationPrefs"`
 }
 
-// ToFirestoreUpdate returns the database update
-// representation of its UserData struct.
-func (u *User) ToFirestoreUpdate() []firestore.Update {
-	f := []firestore.Update{
-		{Path: "mostRecentProgram", Value: u.MostRecentProgram},
+// NotificationPrefs holds whether a user wants to be emailed
+// about each kind of event.
+type NotificationPrefs struct {
+	// ClassInvite is whether to email the user when they are
+	// invited to a class. Defaults to true.
+	ClassInvite bool `firestore:"classInvite" json:"classInvite"`
+	// Comment is whether to email the user when someone
+	// comments on one of their programs. Defaults to true.
+	Comment bool `firestore:"comment" json:"comment"`
+	// Deadline is whether to email the user when a deadline
+	// in one of their classes is near. Defaults to true.
+	Deadline bool `firestore:"deadline" json:"deadline"`
+}
+
+// DefaultNotificationPrefs returns the preferences of a user
+// who has not set any.
+func DefaultNotificationPrefs() NotificationPrefs {
+	return NotificationPrefs{
+		ClassInvite: true,
+		Comment:     true,
+		Deadline:    true,
 	}
+}
+
+// Notifications returns the notification preferences of the
+// user, falling back to the defaults if they are unset.
+func (u *User) Notifications() NotificationPrefs {
+	if u.NotificationPrefs == nil {
+		return DefaultNotificationPrefs()
+	}
+	return *u.NotificationPrefs
+}
+
+// Set sets the preference with the given JSON key, returning
+// an error if the key is unknown.
+func (p *NotificationPrefs) Set(key string, on bool) error {
+	switch key {
+	case "classInvite":
+		p.ClassInvite = on
+	case "comment":
+		p.Comment = on
+	case "deadline":
+		p.Deadline = on
+	default:
+		return errors.Errorf("unknown notification preference %q", key)
+	}
+	return nil
+}
+
+// Location returns the time zone of the user, falling back
+// to UTC if it is unset or unknown.
+func (u *User) Location() *time.Location {
+	return location(u.Timezone)
+}
+
+// MaxUIDLength is the length of the longest valid UID.
+const MaxUIDLength = 128
 
+// uidPattern matches the characters valid in a UID.
+var uidPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidateUID returns an error describing why uid is not a
+// valid UID, or nil if it is. UIDs are used as document IDs,
+// so only letters, digits, '_' and '-' are allowed.
+func ValidateUID(uid string) error {
 	switch {
-	case u.DisplayName != "":
+	case uid == "":
+		return errors.New("uid is required")
+	case len(uid) > MaxUIDLength:
+		return errors.Errorf("uid must be at most %d characters", MaxUIDLength)
+	case !uidPattern.MatchString(uid):
+		return errors.New("uid may only contain letters, digits, '_' and '-'")
+	}
+	return nil
+}
+
+// normalizeDisplayName returns the form of a display name
+// used for uniqueness checks.
+func normalizeDisplayName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// HasProgram returns whether the user owns the program with
+// the given pid.
+func (u *User) HasProgram(pid string) bool {
+	for _, p := range u.Programs {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// HasClass returns whether the user is in the class with the
+// given cid.
+func (u *User) HasClass(cid string) bool {
+	for _, c := range u.Classes {
+		if c == cid {
+			return true
+		}
+	}
+	return false
+}
+
+// AddClass adds the class with the given cid to the user's
+// classes, returning whether it was not already there.
+func (u *User) AddClass(cid string) bool {
+	if u.HasClass(cid) {
+		return false
+	}
+	u.Classes = append(u.Classes, cid)
+	return true
+}
+
+// RemoveClass removes the class with the given cid from the
+// user's classes, returning whether it was there.
+func (u *User) RemoveClass(cid string) bool {
+	if !u.HasClass(cid) {
+		return false
+	}
+	u.Classes = without(u.Classes, cid)
+	return true
+}
+
+// ToFirestoreUpdate returns the database update
+// representation of its UserData struct. Only non-empty
+// fields are included.
+func (u *User) ToFirestoreUpdate() []firestore.Update {
+	var f []firestore.Update
+
+	if u.MostRecentProgram != "" {
+		f = append(f, firestore.Update{Path: "mostRecentProgram", Value: u.MostRecentProgram})
+	}
+	if u.DisplayName != "" {
 		f = append(f, firestore.Update{Path: "displayName", Value: u.DisplayName})
-	case u.PhotoName != "":
+	}
+	if u.PhotoName != "" {
 		f = append(f, firestore.Update{Path: "photoName", Value: u.PhotoName})
-	case len(u.Programs) != 0:
+	}
+	if len(u.Programs) != 0 {
 		f = append(f, firestore.Update{Path: "programs", Value: firestore.ArrayUnion(u.Programs)})
 	}
 
@@ -55,7 +202,15 @@ func (u *User) ToFirestoreUpdate() []firestore.Update {
 //     [User object fields]
 // }
 //
-// Returns: Status 200 on success.
+// Only the provided fields are changed. The user's programs
+// and classes have their own handlers, and cannot be changed
+// here. If UniqueDisplayNames is enabled, a display name
+// already taken by another user is rejected. A timezone must
+// be an IANA time zone name.
+//
+// Returns: Status 200 with the marshalled updated user, 400 if
+// programs or classes are given or the timezone is unknown, or
+// 409 if the display name is taken.
 func (d *DB) UpdateUser(c echo.Context) error {
 	// unmarshal request body into an User struct.
 	requestObj := User{}
@@ -68,13 +223,49 @@ func (d *DB) UpdateUser(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "a uid is required")
 	}
 	if len(requestObj.Programs) != 0 {
-		return c.String(http.StatusBadRequest, "program list cannot be updated via /program/update")
+		return c.String(http.StatusBadRequest, "program list cannot be updated via /user/update")
+	}
+	if len(requestObj.Classes) != 0 {
+		return c.String(http.StatusBadRequest, "class list cannot be updated via /user/update")
 	}
 
-	err := d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
-		ref := d.Collection(usersPath).Doc(uid)
-		return tx.Update(ref, requestObj.ToFirestoreUpdate())
-	})
+	if !ValidTimezone(requestObj.Timezone) {
+		return c.String(http.StatusBadRequest, "unknown timezone")
+	}
+
+	update := requestObj.ToFirestoreUpdate()
+	if requestObj.Timezone != "" {
+		update = append(update, firestore.Update{Path: "timezone", Value: requestObj.Timezone})
+	}
+	if requestObj.DisplayName != "" {
+		key := normalizeDisplayName(requestObj.DisplayName)
+		if UniqueDisplayNames == "true" {
+			current, err := d.LoadUser(c.Request().Context(), uid)
+			if err != nil {
+				if status.Code(err) == codes.NotFound {
+					return c.String(http.StatusNotFound, "user could not be found")
+				}
+				return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to load user").Error())
+			}
+			taken, err := d.DisplayNameExists(c.Request().Context(), requestObj.DisplayName)
+			if err != nil {
+				return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to check display name").Error())
+			}
+			if taken && normalizeDisplayName(current.DisplayName) != key {
+				return c.String(http.StatusConflict, "display name is already taken")
+			}
+		}
+		update = append(update, firestore.Update{Path: "displayNameKey", Value: key})
+	}
+
+	// a request that sets nothing leaves the user as it is.
+	var err error
+	if len(update) != 0 {
+		err = d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
+			ref := d.Collection(usersPath).Doc(uid)
+			return tx.Update(ref, update)
+		})
+	}
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return c.String(http.StatusNotFound, "user could not be found")
@@ -82,7 +273,14 @@ func (d *DB) UpdateUser(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to update user data").Error())
 	}
 
-	return c.String(http.StatusOK, "user updated successfully")
+	u, err := d.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return c.String(http.StatusNotFound, "user could not be found")
+		}
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to load updated user").Error())
+	}
+	return c.JSON(http.StatusOK, &u)
 }
 
 // CreateUser creates a new user object corresponding to either
@@ -113,6 +311,7 @@ func (d *DB) CreateUser(c echo.Context) error {
 	// create structures to be used as default data
 	newUser, newProgs := defaultData()
 	newUser.UID = ref.ID
+	newUser.DisplayNameKey = normalizeDisplayName(newUser.DisplayName)
 
 	err := d.RunTransaction(c.Request().Context(), func(ctx context.Context, tx *firestore.Transaction) error {
 		// if the user exists, then we have a problem.
@@ -13,31 +13,79 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func TestValidateUID(t *testing.T) {
+	for _, uid := range []string{"a", "abc123", "Zx_9-q", strings.Repeat("a", MaxUIDLength)} {
+		assert.NoError(t, ValidateUID(uid), uid)
+	}
+	for _, uid := range []string{"", "a/b", "../users", "a b", "a\x00b", "tab\t", strings.Repeat("a", MaxUIDLength+1)} {
+		assert.Error(t, ValidateUID(uid), uid)
+	}
+}
+
+// Malformed UIDs are rejected before the database is touched.
+func TestCreateClassMalformedUID(t *testing.T) {
+	d := &DB{}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"uid": "a/b", "name": "class", "thumbnail": 1}`))
+	rec := httptest.NewRecorder()
+	assert.NoError(t, d.CreateClass(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "INVALID_UID")
+}
+
+// Program and class lists have their own handlers, so
+// updating them is rejected before the database is touched.
+func TestUpdateUserLists(t *testing.T) {
+	d := &DB{}
+	for _, body := range []string{
+		`{"uid": "test", "programs": ["p"]}`,
+		`{"uid": "test", "displayName": "test", "classes": ["c"]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		assert.NoError(t, d.UpdateUser(echo.New().NewContext(req, rec)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
 func TestUserToFirestoreUpdate(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		u := User{UID: "test"}
+		assert.Empty(t, u.ToFirestoreUpdate())
+	})
 	t.Run("MostRecentProgram", func(t *testing.T) {
 		u := User{MostRecentProgram: "someHash"}
 		update := u.ToFirestoreUpdate()
 		assert.Len(t, update, 1)
+		assert.Equal(t, "mostRecentProgram", update[0].Path)
 		assert.Equal(t, "someHash", update[0].Value)
 	})
 	t.Run("DisplayName", func(t *testing.T) {
 		u := User{DisplayName: "test"}
 		update := u.ToFirestoreUpdate()
-		assert.Len(t, update, 2)
-		assert.Equal(t, "mostRecentProgram", update[0].Path)
-		assert.Equal(t, "test", update[1].Value)
+		assert.Len(t, update, 1)
+		assert.Equal(t, "displayName", update[0].Path)
+		assert.Equal(t, "test", update[0].Value)
 	})
 	t.Run("PhotoName", func(t *testing.T) {
 		u := User{PhotoName: "icecream"}
 		update := u.ToFirestoreUpdate()
+		assert.Len(t, update, 1)
+		assert.Equal(t, "icecream", update[0].Value)
+	})
+	t.Run("DisplayNameAndPhotoName", func(t *testing.T) {
+		u := User{DisplayName: "test", PhotoName: "icecream"}
+		update := u.ToFirestoreUpdate()
 		assert.Len(t, update, 2)
+		assert.Equal(t, "displayName", update[0].Path)
+		assert.Equal(t, "test", update[0].Value)
+		assert.Equal(t, "photoName", update[1].Path)
 		assert.Equal(t, "icecream", update[1].Value)
 	})
 	t.Run("Programs", func(t *testing.T) {
 		u := User{Programs: []string{"hash0", "hash1"}}
 		update := u.ToFirestoreUpdate()
-		assert.Len(t, update, 2)
-		assert.Equal(t, "programs", update[1].Path)
+		assert.Len(t, update, 1)
+		assert.Equal(t, "programs", update[0].Path)
 		// TODO: value cannot be easily verified.
 	})
 }
@@ -86,6 +134,7 @@ func TestUpdateUser(t *testing.T) {
 		}
 		u.UID = randomDoc.Ref.ID
 		u.Programs = []string{}
+		u.Classes = nil
 
 		t.Run("DisplayName", func(t *testing.T) {
 			uCopy := u
@@ -101,7 +150,10 @@ func TestUpdateUser(t *testing.T) {
 
 			if assert.NoError(t, d.UpdateUser(c)) {
 				assert.Equal(t, http.StatusOK, rec.Code)
-				// TODO: more tests required.
+
+				updated := User{}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &updated))
+				assert.Equal(t, "test", updated.DisplayName)
 			}
 
 		})
@@ -0,0 +1,437 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/uclaacm/teach-la-go-backend/db"
+	"github.com/uclaacm/teach-la-go-backend/httpext"
+)
+
+// isAdmin returns whether the user with the given uid
+// is an administrator.
+func isAdmin(c *db.DBContext, uid string) bool {
+	u, err := c.LoadUser(c.Request().Context(), uid)
+	return err == nil && u.Admin
+}
+
+// RemapThumbnails replaces the thumbnails of every document
+// in a collection according to a mapping of old thumbnail
+// indices to new ones. Documents whose new thumbnail would be
+// out of range are left untouched and reported.
+//
+// Request Body:
+// {
+//     "uid": string <administrator>
+//     "collection": string <either "programs" or "classes">
+//     "mapping": map[int]int <old thumbnail to new thumbnail>
+// }
+//
+// Returns: Status 200 with the marshalled db.ThumbnailRemap.
+func RemapThumbnails(cc echo.Context) error {
+	var req struct {
+		UID        string          `json:"uid"`
+		Collection string          `json:"collection"`
+		Mapping    map[int64]int64 `json:"mapping"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || len(req.Mapping) == 0 {
+		return c.String(http.StatusBadRequest, "uid and mapping fields are both required")
+	}
+	if req.Collection != "programs" && req.Collection != "classes" {
+		return c.String(http.StatusBadRequest, "collection must be either programs or classes")
+	}
+	if !isAdmin(c, req.UID) {
+		return c.String(http.StatusForbidden, "given user is not an administrator")
+	}
+
+	r, err := c.RemapThumbnails(c.Request().Context(), req.Collection, req.Mapping)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to remap thumbnails").Error())
+	}
+	return c.JSON(http.StatusOK, &r)
+}
+
+// maxClassBatch is the most classes that can be created in a
+// single call to BatchCreateClasses.
+const maxClassBatch = 1000
+
+// classImport is the outcome of importing a single class
+// through BatchCreateClasses. Either CID and WID are set, or
+// Error explains why the class was skipped.
+type classImport struct {
+	Name    string `json:"name"`
+	Creator string `json:"creator"`
+	CID     string `json:"cid,omitempty"`
+	WID     string `json:"wid,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BatchCreateClasses creates many classes at once, such as
+// when a school is onboarded. Each creator becomes the only
+// instructor of their class. Classes with a missing name, a
+// bad thumbnail, or a creator that does not exist are skipped
+// and reported; the rest are created.
+//
+// Request Body:
+// {
+//     "uid": string <administrator>
+//     "classes": [
+//         {
+//             "name": string
+//             "creator": string <uid of the creator>
+//             "thumbnail": int
+//         }
+//     ]
+// }
+//
+// Returns: Status 200 with the result of each class, in order.
+// If creation fails part way, status 206 with the classes that
+// were created and an error for each of the rest.
+func BatchCreateClasses(cc echo.Context) error {
+	var req struct {
+		UID     string `json:"uid"`
+		Classes []struct {
+			Name      string `json:"name"`
+			Creator   string `json:"creator"`
+			Thumbnail int64  `json:"thumbnail"`
+		} `json:"classes"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || len(req.Classes) == 0 {
+		return c.String(http.StatusBadRequest, "uid and classes fields are both required")
+	}
+	if len(req.Classes) > maxClassBatch {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("at most %d classes may be created at once", maxClassBatch))
+	}
+	if !isAdmin(c, req.UID) {
+		return c.String(http.StatusForbidden, "given user is not an administrator")
+	}
+
+	results := make([]classImport, len(req.Classes))
+	valid := make([]db.Class, 0, len(req.Classes))
+	indices := make([]int, 0, len(req.Classes))
+	creators := make(map[string]bool)
+	for i, def := range req.Classes {
+		results[i] = classImport{Name: def.Name, Creator: def.Creator}
+
+		switch {
+		case def.Name == "":
+			results[i].Error = "class name is required"
+			continue
+		case def.Creator == "":
+			results[i].Error = "creator is required"
+			continue
+		case !db.ValidThumbnail(def.Thumbnail):
+			results[i].Error = "bad thumbnail id"
+			continue
+		}
+		exists, ok := creators[def.Creator]
+		if !ok {
+			_, err := c.LoadUser(c.Request().Context(), def.Creator)
+			exists = err == nil
+			creators[def.Creator] = exists
+		}
+		if !exists {
+			results[i].Error = "creator does not exist"
+			continue
+		}
+
+		valid = append(valid, db.Class{
+			Name:        def.Name,
+			Thumbnail:   def.Thumbnail,
+			Creator:     def.Creator,
+			Instructors: []string{def.Creator},
+			Members:     []string{},
+			Programs:    []string{},
+		})
+		indices = append(indices, i)
+	}
+
+	created, err := c.InsertClasses(c.Request().Context(), valid)
+	if err != nil && len(created) == 0 {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to create classes").Error())
+	}
+	for j, class := range created {
+		results[indices[j]].CID = class.CID
+		results[indices[j]].WID = class.WID
+	}
+	c.Logger().Infof("%d classes created in batch by `%s`", len(created), req.UID)
+
+	// classes created before a failure are still reported, so
+	// that they are not lost track of.
+	if err != nil {
+		c.Logger().Warnf("Batch class creation by `%s` failed part way: %v", req.UID, err)
+		for _, i := range indices[len(created):] {
+			results[i].Error = "failed to create class"
+		}
+		return c.JSON(http.StatusPartialContent, &results)
+	}
+	return c.JSON(http.StatusOK, &results)
+}
+
+// AuditProgramLanguages finds every program whose language is
+// missing or unknown. If fix is set, their language is also
+// replaced with db.DefaultProgramLanguage, or python if that is
+// unset.
+//
+// Request Body:
+// {
+//     "uid": string <administrator>
+//     "fix": bool <whether to fix offending programs>
+// }
+//
+// Returns: Status 200 with the marshalled db.LanguageAudit.
+func AuditProgramLanguages(cc echo.Context) error {
+	var req struct {
+		UID string `json:"uid"`
+		Fix bool   `json:"fix"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" {
+		return c.String(http.StatusBadRequest, "uid is required")
+	}
+	if !isAdmin(c, req.UID) {
+		return c.String(http.StatusForbidden, "given user is not an administrator")
+	}
+
+	fix := ""
+	if req.Fix {
+		fix = db.DefaultProgramLanguage
+		if fix == "" {
+			fix = "python"
+		}
+		if _, err := db.LanguageCode(fix); err != nil {
+			return c.String(http.StatusInternalServerError, errors.Wrap(err, "default program language is misconfigured").Error())
+		}
+	}
+
+	a, err := c.AuditProgramLanguages(c.Request().Context(), fix)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to audit program languages").Error())
+	}
+	return c.JSON(http.StatusOK, &a)
+}
+
+// BackfillDisplayNameKeys sets the display name key of every
+// user whose key is missing or out of date. Users created
+// before keys were kept have none, and are not considered when
+// checking whether a display name is taken until this is run.
+//
+// Request Body:
+// {
+//     "uid": string <administrator>
+// }
+//
+// Returns: Status 200 with the number of users updated.
+func BackfillDisplayNameKeys(cc echo.Context) error {
+	var req struct {
+		UID string `json:"uid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" {
+		return c.String(http.StatusBadRequest, "uid is required")
+	}
+	if !isAdmin(c, req.UID) {
+		return c.String(http.StatusForbidden, "given user is not an administrator")
+	}
+
+	fixed, err := c.BackfillDisplayNameKeys(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to backfill display name keys").Error())
+	}
+	c.Logger().Infof("display name keys of %d users backfilled by `%s`", fixed, req.UID)
+
+	resp := struct {
+		Updated int `json:"updated"`
+	}{Updated: fixed}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// FindJoinCodeCollisions finds every join code shared by more
+// than one class, such as those handed out before join codes
+// were unique. If fix is set, every class in a collision but
+// the one the join code resolves to is given a new join code,
+// and its programs are moved to the new code with it.
+//
+// Request Body:
+// {
+//     "uid": string <administrator>
+//     "fix": bool <whether to rotate colliding join codes>
+// }
+//
+// Returns: Status 200 with the marshalled db.JoinCodeCollisions.
+func FindJoinCodeCollisions(cc echo.Context) error {
+	var req struct {
+		UID string `json:"uid"`
+		Fix bool   `json:"fix"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" {
+		return c.String(http.StatusBadRequest, "uid is required")
+	}
+	if !isAdmin(c, req.UID) {
+		return c.String(http.StatusForbidden, "given user is not an administrator")
+	}
+
+	r, err := c.FindJoinCodeCollisions(c.Request().Context(), req.Fix)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to find join code collisions").Error())
+	}
+	if len(r.Rotated) > 0 {
+		c.Logger().Infof("%d join codes rotated by `%s`", len(r.Rotated), req.UID)
+	}
+	return c.JSON(http.StatusOK, &r)
+}
+
+// maxClassPageSize is the most classes ListAllClasses returns
+// at once.
+const maxClassPageSize = 50
+
+// ListAllClasses returns every class a page at a time, ordered
+// by cid, so that administrators can browse them for
+// moderation.
+//
+// Query Parameters:
+//  - uid string: UID of the administrator
+//  - cursor string: nextCursor of the previous page, if any
+//  - limit int: Most classes to return, at most 50 and 50 by
+//    default.
+//
+// Returns: Status 200 with the marshalled page of classes and
+// the cursor of the next page, which is empty on the last page.
+func ListAllClasses(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid := c.QueryParam("uid")
+	if uid == "" {
+		return c.String(http.StatusBadRequest, "uid is required")
+	}
+	limit := maxClassPageSize
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxClassPageSize {
+			return c.String(http.StatusBadRequest, fmt.Sprintf("limit must be an integer from 1 to %d", maxClassPageSize))
+		}
+	}
+	if !isAdmin(c, uid) {
+		return c.String(http.StatusForbidden, "given user is not an administrator")
+	}
+
+	classes, next, err := c.LoadClassPage(c.Request().Context(), c.QueryParam("cursor"), limit)
+	if err != nil {
+		if err == db.ErrInvalidCursor {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to load classes").Error())
+	}
+
+	res := struct {
+		Classes    []db.Class `json:"classes"`
+		NextCursor string     `json:"nextCursor"`
+	}{classes, next}
+	return c.JSON(http.StatusOK, &res)
+}
+
+// maxOwnerBatch is the most programs whose owners can be
+// resolved in a single call to ResolveProgramOwners.
+const maxOwnerBatch = 100
+
+// programOwner is who owns a program, as reported by
+// ResolveProgramOwners. Status is "owned", "orphaned" if the
+// program exists but no user owns it, or "not found".
+type programOwner struct {
+	Status      string `json:"status"`
+	UID         string `json:"uid,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	PhotoName   string `json:"photoName,omitempty"`
+}
+
+// ResolveProgramOwners finds who owns each of a list of
+// programs, for moderation and support.
+//
+// Request Body:
+// {
+//     "uid": string <administrator>
+//     "pids": []string <at most maxOwnerBatch programs>
+// }
+//
+// Returns: Status 200 with a map of each pid to its owner.
+func ResolveProgramOwners(cc echo.Context) error {
+	var req struct {
+		UID  string   `json:"uid"`
+		PIDs []string `json:"pids"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || len(req.PIDs) == 0 {
+		return c.String(http.StatusBadRequest, "uid and pids fields are both required")
+	}
+	if len(req.PIDs) > maxOwnerBatch {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("at most %d programs can be resolved at once", maxOwnerBatch))
+	}
+	if !isAdmin(c, req.UID) {
+		return c.String(http.StatusForbidden, "given user is not an administrator")
+	}
+
+	activity, err := c.LoadProgramActivity(c.Request().Context(), req.PIDs)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to load programs").Error())
+	}
+	owners, err := c.LoadProgramOwners(c.Request().Context(), req.PIDs)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to load program owners").Error())
+	}
+
+	resp := make(map[string]programOwner, len(req.PIDs))
+	for _, pid := range req.PIDs {
+		resp[pid] = programOwner{Status: "not found"}
+	}
+	for _, a := range activity {
+		resp[a.PID] = programOwner{Status: "orphaned"}
+	}
+	for pid, u := range owners {
+		if resp[pid].Status == "not found" {
+			continue
+		}
+		resp[pid] = programOwner{
+			Status:      "owned",
+			UID:         u.UID,
+			DisplayName: u.DisplayName,
+			PhotoName:   u.PhotoName,
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
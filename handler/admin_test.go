@@ -0,0 +1,494 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uclaacm/teach-la-go-backend/db"
+	"github.com/uclaacm/teach-la-go-backend/handler"
+)
+
+func TestRemapThumbnails(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "user"}))
+		for pid, thumbnail := range map[string]int64{"a": 1, "b": 2, "c": 3} {
+			require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+				UID:       pid,
+				Thumbnail: thumbnail,
+			}))
+		}
+		return d
+	}
+	remap := func(d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		assert.NoError(t, handler.RemapThumbnails(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("notAdmin", func(t *testing.T) {
+		d := setup(t)
+		rec := remap(d, `{"uid": "user", "collection": "programs", "mapping": {"1": 10}}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		p, err := d.LoadProgram(context.Background(), "a")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), p.Thumbnail)
+	})
+	t.Run("invalidCollection", func(t *testing.T) {
+		rec := remap(setup(t), `{"uid": "admin", "collection": "users", "mapping": {"1": 10}}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("remap", func(t *testing.T) {
+		d := setup(t)
+		rec := remap(d, `{"uid": "admin", "collection": "programs", "mapping": {"1": 10, "2": 20, "3": 9000}}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		r := db.ThumbnailRemap{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+		assert.ElementsMatch(t, []string{"a", "b"}, r.Updated)
+		assert.Contains(t, r.Rejected, "c")
+
+		for pid, thumbnail := range map[string]int64{"a": 10, "b": 20, "c": 3} {
+			p, err := d.LoadProgram(context.Background(), pid)
+			require.NoError(t, err)
+			assert.Equal(t, thumbnail, p.Thumbnail)
+		}
+	})
+}
+
+func TestBatchCreateClasses(t *testing.T) {
+	type result struct {
+		Name    string `json:"name"`
+		Creator string `json:"creator"`
+		CID     string `json:"cid"`
+		WID     string `json:"wid"`
+		Error   string `json:"error"`
+	}
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "teacher"}))
+		return d
+	}
+	create := func(d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		assert.NoError(t, handler.BatchCreateClasses(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("notAdmin", func(t *testing.T) {
+		rec := create(setup(t), `{"uid": "teacher", "classes": [{"name": "CS 31", "creator": "teacher"}]}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("noClasses", func(t *testing.T) {
+		rec := create(setup(t), `{"uid": "admin", "classes": []}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("mixedCreators", func(t *testing.T) {
+		d := setup(t)
+		rec := create(d, `{"uid": "admin", "classes": [
+			{"name": "CS 31", "creator": "teacher", "thumbnail": 1},
+			{"name": "CS 32", "creator": "nobody", "thumbnail": 2},
+			{"name": "CS 33", "creator": "teacher", "thumbnail": 3},
+			{"name": "CS 35L", "creator": "teacher", "thumbnail": -1}
+		]}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var results []result
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		require.Len(t, results, 4)
+		for _, i := range []int{1, 3} {
+			assert.NotEmpty(t, results[i].Error, results[i].Name)
+			assert.Empty(t, results[i].CID, results[i].Name)
+		}
+
+		teacher, err := d.LoadUser(context.Background(), "teacher")
+		require.NoError(t, err)
+		assert.Len(t, teacher.Classes, 2)
+		for _, i := range []int{0, 2} {
+			r := results[i]
+			assert.Empty(t, r.Error, r.Name)
+			assert.NotEmpty(t, r.WID, r.Name)
+			assert.Contains(t, teacher.Classes, r.CID)
+
+			class, err := d.LoadClass(context.Background(), r.CID)
+			require.NoError(t, err, r.Name)
+			assert.Equal(t, r.Name, class.Name)
+			assert.Equal(t, r.WID, class.WID)
+			assert.Equal(t, []string{"teacher"}, class.Instructors)
+		}
+	})
+	t.Run("partialFailure", func(t *testing.T) {
+		d := setup(t)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"uid": "admin", "classes": [
+			{"name": "CS 31", "creator": "teacher"},
+			{"name": "CS 32", "creator": "teacher"}
+		]}`))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		assert.NoError(t, handler.BatchCreateClasses(&db.DBContext{
+			Context: c,
+			TLADB:   &partialInsert{MockDB: d},
+		}))
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+
+		var results []result
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		require.Len(t, results, 2)
+		assert.NotEmpty(t, results[0].CID)
+		assert.Empty(t, results[0].Error)
+		assert.Empty(t, results[1].CID)
+		assert.NotEmpty(t, results[1].Error)
+	})
+	t.Run("failure", func(t *testing.T) {
+		d := setup(t)
+		d.SetFailure("InsertClasses", fmt.Errorf("unavailable"))
+		rec := create(d, `{"uid": "admin", "classes": [{"name": "CS 31", "creator": "teacher"}]}`)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+// partialInsert creates only the first of the classes it is
+// given before failing, as a failed later batch would.
+type partialInsert struct {
+	*db.MockDB
+}
+
+func (p *partialInsert) InsertClasses(ctx context.Context, classes []db.Class) ([]db.Class, error) {
+	created, err := p.MockDB.InsertClasses(ctx, classes[:1])
+	if err != nil {
+		return created, err
+	}
+	return created, fmt.Errorf("batch failed")
+}
+
+func TestAuditProgramLanguages(t *testing.T) {
+	type audit struct {
+		Scanned int               `json:"scanned"`
+		Invalid map[string]string `json:"invalid"`
+		Fixed   []string          `json:"fixed"`
+	}
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "user"}))
+		for pid, language := range map[string]string{
+			"python":  "python",
+			"html":    "html",
+			"cobol":   "cobol",
+			"missing": "",
+		} {
+			require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: pid, Language: language}))
+		}
+		return d
+	}
+	run := func(t *testing.T, d *db.MockDB, body string) (*httptest.ResponseRecorder, audit) {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.AuditProgramLanguages(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		a := audit{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &a))
+		}
+		return rec, a
+	}
+
+	t.Run("notAdmin", func(t *testing.T) {
+		rec, _ := run(t, setup(t), `{"uid": "user"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("report", func(t *testing.T) {
+		d := setup(t)
+		rec, a := run(t, d, `{"uid": "admin"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 4, a.Scanned)
+		assert.Equal(t, map[string]string{"cobol": "cobol", "missing": ""}, a.Invalid)
+		assert.Empty(t, a.Fixed)
+
+		p, err := d.LoadProgram(context.Background(), "cobol")
+		require.NoError(t, err)
+		assert.Equal(t, "cobol", p.Language)
+	})
+	t.Run("fix", func(t *testing.T) {
+		d := setup(t)
+		rec, a := run(t, d, `{"uid": "admin", "fix": true}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.ElementsMatch(t, []string{"cobol", "missing"}, a.Fixed)
+		for pid, want := range map[string]string{
+			"python":  "python",
+			"html":    "html",
+			"cobol":   "python",
+			"missing": "python",
+		} {
+			p, err := d.LoadProgram(context.Background(), pid)
+			require.NoError(t, err)
+			assert.Equal(t, want, p.Language, pid)
+		}
+	})
+}
+
+func TestFindJoinCodeCollisions(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "user"}))
+		for cid, wid := range map[string]string{
+			"a": "shared",
+			"b": "shared",
+			"c": "shared",
+			"d": "unique",
+		} {
+			require.NoError(t, d.StoreClass(context.Background(), db.Class{CID: cid, WID: wid, Programs: []string{"p" + cid}}))
+			require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "p" + cid, WID: wid}))
+		}
+		return d
+	}
+	run := func(t *testing.T, d *db.MockDB, body string) (*httptest.ResponseRecorder, db.JoinCodeCollisions) {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.FindJoinCodeCollisions(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		r := db.JoinCodeCollisions{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+		}
+		return rec, r
+	}
+	wid := func(t *testing.T, d *db.MockDB, cid string) string {
+		class, err := d.LoadClass(context.Background(), cid)
+		require.NoError(t, err)
+		return class.WID
+	}
+
+	t.Run("notAdmin", func(t *testing.T) {
+		rec, _ := run(t, setup(t), `{"uid": "user"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("report", func(t *testing.T) {
+		d := setup(t)
+		rec, r := run(t, d, `{"uid": "admin"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 4, r.Scanned)
+		assert.Equal(t, map[string][]string{"shared": {"a", "b", "c"}}, r.Collisions)
+		assert.Empty(t, r.Rotated)
+		assert.Equal(t, "shared", wid(t, d, "b"))
+	})
+	t.Run("fix", func(t *testing.T) {
+		d := setup(t)
+		rec, r := run(t, d, `{"uid": "admin", "fix": true}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Len(t, r.Rotated, 2)
+
+		// one class keeps the code, and the rest get their own.
+		assert.Equal(t, "shared", wid(t, d, "a"))
+		assert.Equal(t, "unique", wid(t, d, "d"))
+		for _, cid := range []string{"b", "c"} {
+			assert.Equal(t, r.Rotated[cid], wid(t, d, cid))
+			assert.NotEqual(t, "shared", r.Rotated[cid])
+
+			// the class's programs follow it to the new code.
+			p, err := d.LoadProgram(context.Background(), "p"+cid)
+			require.NoError(t, err)
+			assert.Equal(t, r.Rotated[cid], p.WID)
+		}
+		p, err := d.LoadProgram(context.Background(), "pa")
+		require.NoError(t, err)
+		assert.Equal(t, "shared", p.WID)
+		assert.NotEqual(t, r.Rotated["b"], r.Rotated["c"])
+
+		_, r = run(t, d, `{"uid": "admin"}`)
+		assert.Empty(t, r.Collisions)
+	})
+}
+
+func TestResolveProgramOwners(t *testing.T) {
+	type owner struct {
+		Status      string `json:"status"`
+		UID         string `json:"uid"`
+		DisplayName string `json:"displayName"`
+	}
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:         "owner",
+			DisplayName: "Joe Bruin",
+			Programs:    []string{"owned", "deleted"},
+		}))
+		for _, pid := range []string{"owned", "orphan"} {
+			require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: pid}))
+		}
+		return d
+	}
+	run := func(t *testing.T, d *db.MockDB, body string) (*httptest.ResponseRecorder, map[string]owner) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.ResolveProgramOwners(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		owners := map[string]owner{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &owners))
+		}
+		return rec, owners
+	}
+
+	t.Run("notAdmin", func(t *testing.T) {
+		rec, _ := run(t, setup(t), `{"uid": "owner", "pids": ["owned"]}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("tooMany", func(t *testing.T) {
+		pids := make([]string, 101)
+		for i := range pids {
+			pids[i] = fmt.Sprintf("p%d", i)
+		}
+		body, err := json.Marshal(map[string]interface{}{"uid": "admin", "pids": pids})
+		require.NoError(t, err)
+		rec, _ := run(t, setup(t), string(body))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("mixed", func(t *testing.T) {
+		rec, owners := run(t, setup(t), `{"uid": "admin", "pids": ["owned", "orphan", "deleted", "missing"]}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, map[string]owner{
+			"owned":   {Status: "owned", UID: "owner", DisplayName: "Joe Bruin"},
+			"orphan":  {Status: "orphaned"},
+			"deleted": {Status: "not found"},
+			"missing": {Status: "not found"},
+		}, owners)
+	})
+}
+
+func TestListAllClasses(t *testing.T) {
+	classes := make([]db.Class, 120)
+	for i := range classes {
+		classes[i] = db.Class{CID: fmt.Sprintf("class%03d", i)}
+	}
+	d := db.OpenMockWith([]db.User{{UID: "admin", Admin: true}, {UID: "user"}}, nil, classes)
+
+	type page struct {
+		Classes    []db.Class `json:"classes"`
+		NextCursor string     `json:"nextCursor"`
+	}
+	list := func(t *testing.T, query string) (*httptest.ResponseRecorder, page) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.ListAllClasses(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		p := page{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		}
+		return rec, p
+	}
+
+	t.Run("notAdmin", func(t *testing.T) {
+		rec, _ := list(t, "uid=user")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("badParams", func(t *testing.T) {
+		for _, query := range []string{"", "uid=admin&limit=51", "uid=admin&limit=0", "uid=admin&cursor=%21%21"} {
+			rec, _ := list(t, query)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		}
+	})
+	t.Run("allPages", func(t *testing.T) {
+		seen := []string{}
+		sizes := []int{}
+		query := "uid=admin"
+		for {
+			rec, p := list(t, query)
+			require.Equal(t, http.StatusOK, rec.Code)
+			sizes = append(sizes, len(p.Classes))
+			for _, c := range p.Classes {
+				seen = append(seen, c.CID)
+			}
+			if p.NextCursor == "" {
+				break
+			}
+			query = "uid=admin&cursor=" + p.NextCursor
+		}
+
+		assert.Equal(t, []int{50, 50, 20}, sizes)
+		require.Len(t, seen, len(classes))
+		for i, c := range classes {
+			assert.Equal(t, c.CID, seen[i])
+		}
+	})
+	t.Run("limit", func(t *testing.T) {
+		rec, p := list(t, "uid=admin&limit=7")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Len(t, p.Classes, 7)
+		assert.Equal(t, "class000", p.Classes[0].CID)
+
+		rec, p = list(t, "uid=admin&limit=7&cursor="+p.NextCursor)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "class007", p.Classes[0].CID)
+	})
+}
+
+func TestBackfillDisplayNameKeys(t *testing.T) {
+	d := db.OpenMock()
+	require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+	require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "old", DisplayName: "Joe Bruin"}))
+	run := func(t *testing.T, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.BackfillDisplayNameKeys(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("notAdmin", func(t *testing.T) {
+		rec := run(t, `{"uid": "old"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("backfill", func(t *testing.T) {
+		rec := run(t, `{"uid": "admin"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"updated": 1}`, rec.Body.String())
+
+		taken, err := d.DisplayNameExists(context.Background(), "joe bruin")
+		require.NoError(t, err)
+		assert.True(t, taken)
+	})
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxBodyBytes is the largest request body the server
+// accepts.
+const DefaultMaxBodyBytes = 1 << 20
+
+// MaxBodyBytes returns middleware that rejects requests with a
+// body larger than n bytes with status 413, before the handler
+// reads any of it.
+func MaxBodyBytes(n int64) echo.MiddlewareFunc {
+	return func(nxt echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Body == nil || req.Body == http.NoBody {
+				return nxt(c)
+			}
+			if req.ContentLength > n {
+				return c.String(http.StatusRequestEntityTooLarge, "request body is too large")
+			}
+
+			// read one byte past the limit, so bodies without a
+			// Content-Length are caught too.
+			b, err := ioutil.ReadAll(io.LimitReader(req.Body, n+1))
+			if err != nil {
+				return c.String(http.StatusBadRequest, errors.Wrap(err, "failed to read request body").Error())
+			}
+			if int64(len(b)) > n {
+				return c.String(http.StatusRequestEntityTooLarge, "request body is too large")
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(b))
+			return nxt(c)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handler_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uclaacm/teach-la-go-backend/handler"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	var read string
+	echoBody := func(c echo.Context) error {
+		b, err := ioutil.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		read = string(b)
+		return c.String(http.StatusOK, "")
+	}
+	serve := func(t *testing.T, body string, chunked bool) *httptest.ResponseRecorder {
+		read = ""
+		req := httptest.NewRequest(http.MethodPost, "/program/create", strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.MaxBodyBytes(8)(echoBody)(c))
+		return rec
+	}
+
+	t.Run("underLimit", func(t *testing.T) {
+		rec := serve(t, "12345678", false)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "12345678", read)
+	})
+	t.Run("overLimit", func(t *testing.T) {
+		rec := serve(t, "123456789", false)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Empty(t, read)
+	})
+	t.Run("overLimitUnknownLength", func(t *testing.T) {
+		rec := serve(t, "123456789", true)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Empty(t, read)
+	})
+	t.Run("noBody", func(t *testing.T) {
+		rec := serve(t, "", false)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
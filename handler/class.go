@@ -1,7 +1,16 @@
 package handler
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
@@ -13,7 +22,10 @@ import (
 
 // GetClass takes the UID (either of a member or an instructor)
 // and a CID (wid) as a JSON, and returns an object representing the class.
-// If the given UID is not a member or an instructor, an error is returned.
+// If the given UID is not the creator, a member, or an instructor, a 403
+// is returned. Instructor-only programs, and their pids, are left out
+// of the response for anyone but instructors. Deleted programs are
+// left out of the program data.
 func GetClass(cc echo.Context) error {
 	var (
 		req struct {
@@ -32,38 +44,46 @@ func GetClass(cc echo.Context) error {
 	c := cc.(*db.DBContext)
 
 	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
 	}
 	if req.UID == "" || req.CID == "" {
-		return c.String(http.StatusBadRequest, "uid and cid fields are both required")
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and cid fields are both required")
 	}
 
 	class, err := c.LoadClass(c.Request().Context(), req.CID)
 	if err != nil {
-		return c.String(http.StatusNotFound, err.Error())
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
 	}
 	res.Class = &class
 
-	// Check if the uid exists in the members list or instructor list
-	isIn, isInstructor := false, false
-	for _, m := range class.Members {
-		if m == req.UID {
-			isIn = true
-			break
-		}
-	}
-	for _, i := range class.Instructors {
-		if i == req.UID {
-			isIn, isInstructor = true, true
-			break
-		}
+	if !class.HasAccess(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user not in class")
 	}
+	isInstructor := class.IsInstructor(req.UID) || class.Creator == req.UID
 
 	// Parameters for additional data.
 	withPrograms, withUserData := c.QueryParam("programs"), c.QueryParam("userData")
 
-	if !isIn {
-		return c.String(http.StatusBadRequest, "given user not in class")
+	// Students do not see InstructorOnly programs at all, not
+	// even their pids.
+	if !isInstructor {
+		programs, err := c.LoadPrograms(c.Request().Context(), class.Programs)
+		if err != nil {
+			return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to load class programs").Error())
+		}
+		hidden := make(map[string]bool)
+		for _, p := range programs {
+			if p.InstructorOnly {
+				hidden[p.UID] = true
+			}
+		}
+		visible := make([]string, 0, len(class.Programs))
+		for _, pid := range class.Programs {
+			if !hidden[pid] {
+				visible = append(visible, pid)
+			}
+		}
+		class.Programs = visible
 	}
 
 	// If program data is requested.
@@ -74,6 +94,9 @@ func GetClass(cc echo.Context) error {
 			if err != nil {
 				partial = true
 			}
+			if program.Deleted() {
+				continue
+			}
 			res.ProgramData = append(res.ProgramData, program)
 		}
 	}
@@ -108,45 +131,2256 @@ func GetClass(cc echo.Context) error {
 	}
 }
 
-// DeleteClass takes a wid and deletes it.
-// Any programs associated with the class will also be deleted.
-// Users that are in the class will still contain a reference to this class,
-// thus it is the user's responsibility to remove references to a deleted class.
+// DeleteClass takes a uid and a cid and deletes the class.
+// Only the creator of a class may delete it, or an administrator
+// if the class has no creator, such as because they were erased.
+// Any programs associated with the class will also be deleted,
+// and the class is removed from the class list of each of its
+// members and instructors.
+//
+// Request Body:
+// {
+//     "uid": string <creator of the class>
+//     "cid": string
+// }
+//
+// Returns: Status 200 with the marshalled deleted class.
 func DeleteClass(cc echo.Context) error {
 	var req struct {
+		UID string `json:"uid"`
 		CID string `json:"cid"`
 	}
 	
 	c := cc.(*db.DBContext)
 	
 	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
 	}
-	if req.CID == "" {
-		return c.String(http.StatusBadRequest, "cid is required")
+	if req.UID == "" || req.CID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and cid fields are both required")
 	}
 
 	// Confirm class exists
 	class, err := c.LoadClass(c.Request().Context(), req.CID)
 	if err != nil {
-		return c.String(http.StatusNotFound, err.Error())
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
+	}
+	if req.UID != class.Creator && !(class.Creator == "" && isAdmin(c, req.UID)) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "only the creator of a class may delete it")
 	}
 
 	for _, prog := range class.Programs {
 		if err := c.RemoveProgram(c.Request().Context(), prog); 
 		// if we can't find a program, then it's not a problem.
 		err != nil && status.Code(err) != codes.NotFound {
-			return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to delete class").Error())
+			return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to delete class").Error())
 		}
 	}
 
 	if err := c.DeleteClass(c.Request().Context(), class.CID); err != nil {
 		if status.Code(err) == codes.NotFound {
-			return c.String(http.StatusNotFound, "could not find class")
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+		}
+
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to delete class").Error())
+	}
+
+	// Don't leave users with a reference to the deleted class.
+	for _, uid := range append(append([]string{}, class.Members...), class.Instructors...) {
+		u, err := c.LoadUser(c.Request().Context(), uid)
+		if err != nil {
+			c.Logger().Warnf("Failed to load user with uid `%s` in class with cid `%s`. Class could be corrupted!", uid, class.CID)
+			continue
+		}
+		remaining := make([]string, 0, len(u.Classes))
+		for _, cid := range u.Classes {
+			if cid != class.CID {
+				remaining = append(remaining, cid)
+			}
+		}
+		if len(remaining) == len(u.Classes) {
+			continue
+		}
+		u.Classes = remaining
+		if err := c.StoreUser(c.Request().Context(), u); err != nil {
+			return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to remove class from user").Error())
+		}
+	}
+
+	return c.JSON(http.StatusOK, &class)
+}
+
+// ArchiveClassPrograms moves every program in a class's library
+// into an archive class. The requester must be an instructor of
+// both classes, and the archive class must have room for all of
+// the programs being moved.
+//
+// Request Body:
+// {
+//     "uid": string <instructor of both classes>
+//     "cid": string <class to archive programs from>
+//     "archiveCid": string <class to archive programs into>
+// }
+//
+// Returns: Status 200 with the marshalled archive class, or
+// 409 if the archive class runs out of room part way through,
+// such as because of a concurrent move.
+func ArchiveClassPrograms(cc echo.Context) error {
+	var req struct {
+		UID        string `json:"uid"`
+		CID        string `json:"cid"`
+		ArchiveCID string `json:"archiveCid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" || req.ArchiveCID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid, cid, and archiveCid fields are all required")
+	}
+	if req.CID == req.ArchiveCID {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "cannot archive a class into itself")
+	}
+
+	src, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
+	}
+	dst, err := c.LoadClass(c.Request().Context(), req.ArchiveCID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
+	}
+
+	if !src.IsInstructor(req.UID) || !dst.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of both classes")
+	}
+	if !dst.HasRoomFor(len(src.Programs)) {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "archive class does not have room for all programs")
+	}
+
+	for _, p := range src.Programs {
+		if err := c.MoveClassProgram(c.Request().Context(), p, src.CID, dst.CID); err != nil {
+			if err == db.ErrClassFull {
+				return httpext.Error(c, http.StatusConflict, httpext.CodeConflict, "archive class ran out of room for the programs")
+			}
+			return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to archive program").Error())
+		}
+	}
+
+	dst, err = c.LoadClass(c.Request().Context(), req.ArchiveCID)
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to load archive class").Error())
+	}
+	return c.JSON(http.StatusOK, &dst)
+}
+
+// SetClassCodeLimit sets the largest that the code of programs
+// in a class may be, in bytes. A limit of zero removes the
+// class's limit, leaving only db.MaxCodeBytes in effect.
+//
+// Request Body:
+// {
+//     "uid": string <instructor of the class>
+//     "cid": string
+//     "maxCodeBytes": int
+// }
+//
+// Returns: Status 200 with the marshalled class.
+func SetClassCodeLimit(cc echo.Context) error {
+	var req struct {
+		UID          string `json:"uid"`
+		CID          string `json:"cid"`
+		MaxCodeBytes int    `json:"maxCodeBytes"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and cid fields are both required")
+	}
+	if req.MaxCodeBytes < 0 || req.MaxCodeBytes > db.MaxCodeBytes {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, fmt.Sprintf("code limit must be between 0 and %d bytes", db.MaxCodeBytes))
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
+	}
+	if !class.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	class.MaxAssignmentCodeBytes = req.MaxCodeBytes
+	if err := c.StoreClass(c.Request().Context(), class); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to update class").Error())
+	}
+
+	return c.JSON(http.StatusOK, &class)
+}
+
+// SetClassTimezone sets the time zone a class is held in. The
+// zone must be an IANA time zone name, such as
+// "America/Los_Angeles". An empty zone resets the class to UTC.
+//
+// Request Body:
+// {
+//     "uid": REQUIRED, UID of an instructor of the class
+//     "cid": REQUIRED, CID of the class
+//     "timezone": IANA time zone name
+// }
+//
+// Returns: Status 200 with the marshalled class.
+func SetClassTimezone(cc echo.Context) error {
+	var req struct {
+		UID      string `json:"uid"`
+		CID      string `json:"cid"`
+		Timezone string `json:"timezone"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and cid fields are both required")
+	}
+	if !db.ValidTimezone(req.Timezone) {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, fmt.Sprintf("unknown time zone %q", req.Timezone))
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
+	}
+	if !class.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	class.Timezone = req.Timezone
+	if err := c.StoreClass(c.Request().Context(), class); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to update class").Error())
+	}
+
+	return c.JSON(http.StatusOK, &class)
+}
+
+// RenameClass changes the name of a class. Leading and trailing
+// whitespace is trimmed from the new name, which may not be
+// empty or longer than db.MaxClassNameLength runes.
+//
+// Request Body:
+// {
+//     "uid": REQUIRED, UID of an instructor of the class
+//     "cid": REQUIRED, CID of the class
+//     "name": REQUIRED, new name of the class
+// }
+//
+// Returns: Status 200 with the marshalled class.
+func RenameClass(cc echo.Context) error {
+	var req struct {
+		UID  string `json:"uid"`
+		CID  string `json:"cid"`
+		Name string `json:"name"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and cid fields are both required")
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "class name cannot be empty")
+	}
+	if utf8.RuneCountInString(name) > db.MaxClassNameLength {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, fmt.Sprintf("class name cannot be longer than %d characters", db.MaxClassNameLength))
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
+	}
+	if !class.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	if err := c.UpdateClass(c.Request().Context(), req.CID, &db.ClassUpdate{Class: db.Class{Name: name}}); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to update class").Error())
+	}
+	class.Name = name
+
+	return c.JSON(http.StatusOK, &class)
+}
+
+// GetClassCard returns a compact, public view of a discoverable
+// class for embedding in external pages. Classes that are not
+// discoverable are reported as not found.
+//
+// Query Parameters:
+//  - cid string: CID of the class
+//
+// Returns: Status 200 with the marshalled card.
+func GetClassCard(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	cid := c.QueryParam("cid")
+	if cid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`cid` is a required query parameter.")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil || !class.Discoverable {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+
+	card := struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Thumbnail   int64  `json:"thumbnail"`
+		Members     int    `json:"members"`
+	}{
+		Name:        class.Name,
+		Description: class.Description,
+		Thumbnail:   class.Thumbnail,
+		Members:     len(class.Members),
+	}
+
+	// cards are public and change rarely, so let anyone embed
+	// and cache them.
+	c.Response().Header().Set(echo.HeaderAccessControlAllowOrigin, "*")
+	c.Response().Header().Set("Cache-Control", "public, max-age=3600")
+	return c.JSON(http.StatusOK, &card)
+}
+
+// distribution describes the outcome of distributing a
+// program to a single class member.
+type distribution struct {
+	PID    string `json:"pid,omitempty"`
+	Status string `json:"status"`
+}
+
+// forkInClass returns the pid of the user's fork of the
+// given program that is associated to the class, if any. If
+// no fork is found but some of the user's programs could not
+// be loaded, the error loading them is returned, since one of
+// them may be the fork.
+func forkInClass(ctx context.Context, d db.TLADB, u db.User, pid, wid string) (string, error) {
+	var loadErr error
+	for _, p := range u.Programs {
+		prog, err := d.LoadProgram(ctx, p)
+		if err != nil {
+			loadErr = err
+			continue
+		}
+		if prog.ForkedFrom == pid && prog.WID == wid {
+			return prog.UID, nil
+		}
+	}
+	return "", loadErr
+}
+
+// DistributeToMembers forks a program to each of the given
+// members of a class, associating each fork to the class.
+// Members that already have a fork of the program in the
+// class are skipped, so the request can be safely retried.
+//
+// Request Body:
+// {
+//     "uid": string <instructor of the class>
+//     "cid": string
+//     "pid": string <program to distribute>
+//     "members": []string <UIDs of members to receive a fork>
+// }
+//
+// Returns: Status 200 with a marshalled map of member UIDs to
+// the result of distributing to that member.
+func DistributeToMembers(cc echo.Context) error {
+	var req struct {
+		UID     string   `json:"uid"`
+		CID     string   `json:"cid"`
+		PID     string   `json:"pid"`
+		Members []string `json:"members"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" || req.PID == "" || len(req.Members) == 0 {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid, cid, pid, and members fields are all required")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
+	}
+	if !class.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	instructor, err := c.LoadUser(c.Request().Context(), req.UID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, err.Error())
+	}
+	if !ownsProgram(instructor, req.PID) && !class.HasProgram(req.PID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "program is not owned by the user or in the class library")
+	}
+	src, err := c.LoadProgram(c.Request().Context(), req.PID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, err.Error())
+	}
+
+	// each member's fork is created and added to the member and
+	// the class in its own transaction, so that concurrent
+	// changes to either are not overwritten.
+	ctx := c.Request().Context()
+	results := make(map[string]distribution, len(req.Members))
+	for _, uid := range req.Members {
+		if !class.IsMember(uid) {
+			results[uid] = distribution{Status: "not a member"}
+			continue
+		}
+
+		var res distribution
+		err := c.Transact(ctx, func(tx db.TLADB) error {
+			cls, err := tx.LoadClass(ctx, req.CID)
+			if err != nil {
+				res = distribution{Status: "failed to load class"}
+				return err
+			}
+			u, err := tx.LoadUser(ctx, uid)
+			if err != nil {
+				res = distribution{Status: "user not found"}
+				return err
+			}
+			pid, err := forkInClass(ctx, tx, u, req.PID, cls.WID)
+			if err != nil {
+				res = distribution{Status: "failed to check for an existing fork"}
+				return err
+			}
+			if pid != "" {
+				res = distribution{PID: pid, Status: "already distributed"}
+				return nil
+			}
+			if !cls.HasRoomFor(1) {
+				res = distribution{Status: "class library is full"}
+				return nil
+			}
+
+			fork := src
+			fork.ForkedFrom = req.PID
+			fork.WID = cls.WID
+			fork.DateCreated = time.Now().UTC().String()
+			fork.Version = 0
+			fork.Touch()
+			res = distribution{Status: "failed to fork program"}
+			if fork, err = tx.InsertProgram(ctx, fork); err != nil {
+				return err
+			}
+			u.Programs = append(u.Programs, fork.UID)
+			if err := tx.StoreUser(ctx, u); err != nil {
+				return err
+			}
+			cls.AddProgram(fork.UID)
+			if err := tx.StoreClass(ctx, cls); err != nil {
+				return err
+			}
+			res = distribution{PID: fork.UID, Status: "distributed"}
+			return nil
+		})
+		if err != nil && res.Status == "distributed" {
+			res = distribution{Status: "failed to fork program"}
+		}
+		results[uid] = res
+	}
+
+	return c.JSON(http.StatusOK, &results)
+}
+
+// maxRosterSize is the most students that can be enrolled in
+// a single call to EnrollStudents.
+const maxRosterSize = 200
+
+// EnrollStudents enrolls a roster of students in a class at
+// once, adding each to the class and the class to each. Only
+// instructors of the class may enroll students. Students that
+// are already members are left as they are, so the request can
+// be safely retried. The whole roster is enrolled in a single
+// transaction, so if any write fails, no student is enrolled.
+//
+// Request Body:
+// {
+//     "instructorUid": string <instructor of the class>
+//     "cid": string
+//     "studentUids": []string <UIDs of students to enroll>
+// }
+//
+// Returns: Status 200 with a marshalled map of student UIDs to
+// one of "enrolled", "already enrolled", "not found", or
+// "failed".
+func EnrollStudents(cc echo.Context) error {
+	var req struct {
+		InstructorUID string   `json:"instructorUid"`
+		CID           string   `json:"cid"`
+		StudentUIDs   []string `json:"studentUids"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.InstructorUID == "" || req.CID == "" || len(req.StudentUIDs) == 0 {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "instructorUid, cid, and studentUids fields are all required")
+	}
+	if err := db.ValidateUID(req.InstructorUID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+	if len(req.StudentUIDs) > maxRosterSize {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, fmt.Sprintf("at most %d students may be enrolled at once", maxRosterSize))
+	}
+
+	ctx := c.Request().Context()
+	class, err := c.LoadClass(ctx, req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
+	}
+	if !class.IsInstructor(req.InstructorUID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	// the class and up to maxRosterSize users fit well within
+	// the writes allowed in one transaction.
+	var (
+		results map[string]string
+		users   []db.User
+	)
+	err = c.Transact(ctx, func(tx db.TLADB) error {
+		results = make(map[string]string, len(req.StudentUIDs))
+		users = make([]db.User, 0, len(req.StudentUIDs))
+		class, err := tx.LoadClass(ctx, req.CID)
+		if err != nil {
+			return err
+		}
+
+		// all reads are made before the first write.
+		for _, uid := range req.StudentUIDs {
+			if db.ValidateUID(uid) != nil {
+				results[uid] = "not found"
+				continue
+			}
+			if class.IsMember(uid) {
+				results[uid] = "already enrolled"
+				continue
+			}
+			u, err := tx.LoadUser(ctx, uid)
+			if err != nil {
+				results[uid] = "not found"
+				continue
+			}
+			class.AddMember(uid)
+			users = append(users, u)
+			results[uid] = "enrolled"
 		}
+		if len(users) == 0 {
+			return nil
+		}
+
+		for _, u := range users {
+			u.AddClass(req.CID)
+			if err := tx.StoreUser(ctx, u); err != nil {
+				return err
+			}
+		}
+		return tx.StoreClass(ctx, class)
+	})
+	if err != nil && len(users) == 0 {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to enroll students").Error())
+	}
+	if err != nil {
+		c.Logger().Warnf("Failed to enroll students in `%s`: %v", req.CID, err)
+		for _, u := range users {
+			results[u.UID] = "failed"
+		}
+	}
+
+	return c.JSON(http.StatusOK, &results)
+}
+
+// errInstructorMember is returned by setMember when asked to
+// remove an instructor, who must be demoted first so that they
+// do not keep instructing a class they are not in.
+var errInstructorMember = errors.New("instructors must be demoted before they are removed")
+
+// setMember adds the user with the given uid to the class with
+// the given cid and the class to the user, or removes both if
+// member is false. Both are updated together, so that a failure
+// leaves neither behind. It returns the updated class.
+func setMember(c *db.DBContext, cid, uid string, member bool) (class db.Class, err error) {
+	ctx := c.Request().Context()
+	err = c.Transact(ctx, func(tx db.TLADB) error {
+		cls, err := tx.LoadClass(ctx, cid)
+		if err != nil {
+			return err
+		}
+		u, err := tx.LoadUser(ctx, uid)
+		if err != nil {
+			return err
+		}
+
+		var classChanged, userChanged bool
+		if member {
+			classChanged, userChanged = cls.AddMember(uid), u.AddClass(cid)
+		} else if cls.IsInstructor(uid) {
+			return errInstructorMember
+		} else {
+			classChanged, userChanged = cls.RemoveMember(uid), u.RemoveClass(cid)
+		}
+		if classChanged {
+			if err := tx.StoreClass(ctx, cls); err != nil {
+				return err
+			}
+		}
+		class = cls
+		if userChanged {
+			return tx.StoreUser(ctx, u)
+		}
+		return nil
+	})
+	return
+}
+
+// RemoveStudent lets an instructor remove a member from their
+// class, removing the class from the member as well. The
+// creator of the class cannot be removed, and other instructors
+// must be demoted before they can be.
+//
+// Request Body:
+// {
+//     "instructorUid": string <instructor of the class>
+//     "targetUid": string <member to remove>
+//     "cid": string
+// }
+//
+// Returns: Status 200 with the marshalled updated class, or
+// 403 if the requester is not an instructor or the target is
+// the creator or an instructor.
+func RemoveStudent(cc echo.Context) error {
+	var req struct {
+		InstructorUID string `json:"instructorUid"`
+		TargetUID     string `json:"targetUid"`
+		CID           string `json:"cid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.InstructorUID == "" || req.TargetUID == "" || req.CID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "instructorUid, targetUid, and cid fields are all required")
+	}
+	for _, uid := range []string{req.InstructorUID, req.TargetUID} {
+		if err := db.ValidateUID(uid); err != nil {
+			return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+		}
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, err.Error())
+	}
+	if !class.IsInstructor(req.InstructorUID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+	if req.TargetUID == class.Creator {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "the creator of a class cannot be removed")
+	}
+	if !class.IsMember(req.TargetUID) {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "target user is not a member of the class")
+	}
+
+	if class.IsInstructor(req.TargetUID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, errInstructorMember.Error())
+	}
+
+	class, err = setMember(c, req.CID, req.TargetUID, false)
+	if err == errInstructorMember {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, err.Error())
+	}
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to remove user from class").Error())
+	}
+	return c.JSON(http.StatusOK, &class)
+}
+
+// GetSharedClasses lists the classes that both a viewer and
+// the author of a program belong to, leaving out archived
+// classes.
+//
+// Query Parameters:
+//  - viewer string: UID of the user viewing the program
+//  - author string: UID of the program's author
+//
+// Returns: Status 200 with a marshalled array of ClassSummary.
+func GetSharedClasses(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	viewerUID, authorUID := c.QueryParam("viewer"), c.QueryParam("author")
+	if viewerUID == "" || authorUID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`viewer` and `author` are required query parameters.")
+	}
+
+	viewer, err := c.LoadUser(c.Request().Context(), viewerUID)
+	if err != nil {
+		return httpext.Error(c, http.StatusUnauthorized, httpext.CodeUnauthorized, "viewer is not a known user")
+	}
+	author, err := c.LoadUser(c.Request().Context(), authorUID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+
+	inViewer := make(map[string]bool, len(viewer.Classes))
+	for _, cid := range viewer.Classes {
+		inViewer[cid] = true
+	}
 
-		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to delete class").Error())
+	classes := make([]db.ClassSummary, 0)
+	for _, cid := range author.Classes {
+		if !inViewer[cid] {
+			continue
+		}
+		class, err := c.LoadClass(c.Request().Context(), cid)
+		if err != nil {
+			c.Logger().Warnf("Failed to load class with cid `%s` for user with uid `%s`. User could be corrupted!", cid, authorUID)
+			continue
+		}
+		if !class.Archived {
+			classes = append(classes, class.Summary())
+		}
 	}
 
-	return c.String(http.StatusOK, "")
+	return c.JSON(http.StatusOK, classes)
+}
+
+// GetClassSummary returns the stats of a class, such as its
+// number of members and programs and when it was last active.
+//
+// Query Parameters:
+//  - uid string: UID of a member or instructor of the class
+//  - cid string: CID of the class
+//
+// Returns: Status 200 with the marshalled db.ClassStats.
+func GetClassSummary(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid := c.QueryParam("uid"), c.QueryParam("cid")
+	if uid == "" || cid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` and `cid` are required query parameters.")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.HasAccess(uid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user not in class")
+	}
+
+	return c.JSON(http.StatusOK, &class.Stats)
+}
+
+// RebuildClassSummary recomputes the stats of a class from
+// scratch, repairing them if they have drifted.
+//
+// Request Body:
+// {
+//     "uid": string <instructor of the class>
+//     "cid": string
+// }
+//
+// Returns: Status 200 with the marshalled db.ClassStats.
+func RebuildClassSummary(cc echo.Context) error {
+	var req struct {
+		UID string `json:"uid"`
+		CID string `json:"cid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and cid fields are both required")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	class.RebuildStats()
+	if err := c.StoreClass(c.Request().Context(), class); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to store class").Error())
+	}
+	return c.JSON(http.StatusOK, &class.Stats)
+}
+
+// CopyClassSettings creates a new, empty class with the
+// settings of an existing one. The requester becomes the
+// creator and only instructor of the new class; no members
+// or programs are copied. Surrounding whitespace is trimmed
+// from the name, which must not be empty or longer than
+// db.MaxClassNameLength runes.
+//
+// Request Body:
+// {
+//     "uid": string <instructor of the source class>
+//     "cid": string <class to copy settings from>
+//     "name": string <name of the new class>
+// }
+//
+// Returns: Status 201 with the marshalled new class.
+func CopyClassSettings(cc echo.Context) error {
+	var req struct {
+		UID  string `json:"uid"`
+		CID  string `json:"cid"`
+		Name string `json:"name"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" || req.Name == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid, cid, and name fields are all required")
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "class name cannot be empty")
+	}
+	if utf8.RuneCountInString(name) > db.MaxClassNameLength {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, fmt.Sprintf("class name cannot be longer than %d characters", db.MaxClassNameLength))
+	}
+
+	ctx := c.Request().Context()
+	src, err := c.LoadClass(ctx, req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !src.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+	if _, err := c.LoadUser(ctx, req.UID); err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+
+	var class db.Class
+	err = c.Transact(ctx, func(tx db.TLADB) error {
+		// the user is loaded again so that changes made to it
+		// since are not overwritten.
+		user, err := tx.LoadUser(ctx, req.UID)
+		if err != nil {
+			return err
+		}
+
+		class, err = tx.InsertClass(ctx, db.Class{
+			Name:                   name,
+			Thumbnail:              src.Thumbnail,
+			Description:            src.Description,
+			Discoverable:           src.Discoverable,
+			MaxPrograms:            src.MaxPrograms,
+			MaxAssignmentCodeBytes: src.MaxAssignmentCodeBytes,
+			Timezone:               src.Timezone,
+			Creator:                req.UID,
+			Instructors:            []string{req.UID},
+			Members:                []string{},
+			Programs:               []string{},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create class")
+		}
+
+		user.Classes = append(user.Classes, class.CID)
+		if err := tx.StoreUser(ctx, user); err != nil {
+			return errors.Wrap(err, "failed to add class to user")
+		}
+		return nil
+	})
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to copy class settings").Error())
+	}
+	return c.JSON(http.StatusCreated, &class)
+}
+
+// CopyClass creates a new class from an existing one, so that
+// it can be taught again in a later term. The new class gets
+// the settings of the source class, its name suffixed with
+// " (copy)", and a copy of every program in its library. The
+// requester becomes the creator and only instructor of the new
+// class, and owns the copied programs. No members are copied.
+// Programs in the library that cannot be loaded, or that are
+// deleted, are skipped. The class, the copied programs, and the
+// requester are written together, or not at all.
+//
+// Request Body:
+// {
+//     "uid": string <instructor of the source class>
+//     "cid": string <class to copy>
+// }
+//
+// Returns: Status 201 with the marshalled new class.
+func CopyClass(cc echo.Context) error {
+	var req struct {
+		UID string `json:"uid"`
+		CID string `json:"cid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and cid fields are both required")
+	}
+
+	ctx := c.Request().Context()
+	src, err := c.LoadClass(ctx, req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !src.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+	if _, err := c.LoadUser(ctx, req.UID); err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+
+	programs := make([]db.Program, 0, len(src.Programs))
+	for _, pid := range src.Programs {
+		p, err := c.LoadProgram(ctx, pid)
+		if err != nil {
+			c.Logger().Warnf("Failed to load program with pid `%s` in class with cid `%s`. Class could be corrupted!", pid, src.CID)
+			continue
+		}
+		if !p.Deleted() {
+			programs = append(programs, p)
+		}
+	}
+
+	var class db.Class
+	err = c.Transact(ctx, func(tx db.TLADB) error {
+		// the user is loaded again so that changes made to it
+		// since are not overwritten.
+		user, err := tx.LoadUser(ctx, req.UID)
+		if err != nil {
+			return err
+		}
+
+		class, err = tx.InsertClass(ctx, db.Class{
+			Name:                   copyName(src.Name, db.MaxClassNameLength),
+			Thumbnail:              src.Thumbnail,
+			Description:            src.Description,
+			Discoverable:           src.Discoverable,
+			MaxPrograms:            src.MaxPrograms,
+			MaxAssignmentCodeBytes: src.MaxAssignmentCodeBytes,
+			Timezone:               src.Timezone,
+			Creator:                req.UID,
+			Instructors:            []string{req.UID},
+			Members:                []string{},
+			Programs:               []string{},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create class")
+		}
+
+		for _, p := range programs {
+			cp := db.Program{
+				Code:        p.Code,
+				Language:    p.Language,
+				Name:        p.Name,
+				Thumbnail:   p.Thumbnail,
+				Notes:       p.Notes,
+				WID:         class.WID,
+				ForkedFrom:  p.UID,
+				DateCreated: time.Now().UTC().String(),
+			}
+			cp.Touch()
+			cp, err = tx.InsertProgram(ctx, cp)
+			if err != nil {
+				return errors.Wrap(err, "failed to copy program")
+			}
+			class.AddProgram(cp.UID)
+			user.Programs = append(user.Programs, cp.UID)
+		}
+		if err := tx.StoreClass(ctx, class); err != nil {
+			return errors.Wrap(err, "failed to add programs to class")
+		}
+
+		user.Classes = append(user.Classes, class.CID)
+		if err := tx.StoreUser(ctx, user); err != nil {
+			return errors.Wrap(err, "failed to add class to user")
+		}
+		return nil
+	})
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to copy class").Error())
+	}
+	return c.JSON(http.StatusCreated, &class)
+}
+
+const (
+	// defaultEngagementDays is the window over which class
+	// engagement is computed when none is given.
+	defaultEngagementDays = 7
+
+	// maxEngagementDays is the largest window over which class
+	// engagement can be computed.
+	maxEngagementDays = 365
+)
+
+// since returns whether the timestamp is at or after t.
+// Timestamps that cannot be parsed never are.
+func since(timestamp string, t time.Time) bool {
+	ts, err := time.Parse(db.TimestampLayout, timestamp)
+	return err == nil && !ts.Before(t)
+}
+
+// day returns the date of the timestamp in the given location,
+// or the empty string if it cannot be parsed.
+func day(timestamp string, loc *time.Location) string {
+	ts, err := time.Parse(db.TimestampLayout, timestamp)
+	if err != nil {
+		return ""
+	}
+	return ts.In(loc).Format(dateLayout)
+}
+
+// GetClassEngagement summarizes the activity of the members
+// of a class over the last few days: how many members created
+// or saved a program, how many programs were saved, and how
+// many were created. Only programs in the class are counted.
+// Programs keep no edit history, so a program saved several
+// times in the window counts as a single edit.
+//
+// The timeline counts creations and edits by day, where days
+// are taken in the class's time zone.
+//
+// Query Parameters:
+//  - uid string: UID of an instructor of the class
+//  - cid string: CID of the class
+//  - days int: Length of the window in days, 7 by default.
+//
+// Returns: Status 200 with the marshalled engagement.
+func GetClassEngagement(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid := c.QueryParam("uid"), c.QueryParam("cid")
+	if uid == "" || cid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` and `cid` are required query parameters.")
+	}
+	days := defaultEngagementDays
+	if d := c.QueryParam("days"); d != "" {
+		var err error
+		if days, err = strconv.Atoi(d); err != nil || days < 1 || days > maxEngagementDays {
+			return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, fmt.Sprintf("`days` must be an integer from 1 to %d", maxEngagementDays))
+		}
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(uid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	start := time.Now().UTC().AddDate(0, 0, -days)
+	resp := struct {
+		Days          int `json:"days"`
+		ActiveMembers int `json:"activeMembers"`
+		Edits         int `json:"edits"`
+		NewPrograms   int `json:"newPrograms"`
+
+		Timeline map[string]int `json:"timeline"`
+	}{Days: days, Timeline: make(map[string]int)}
+	loc := class.Location()
+	for _, m := range class.Members {
+		member, err := c.LoadUser(c.Request().Context(), m)
+		if err != nil {
+			c.Logger().Warnf("Failed to load user with uid `%s` in class with cid `%s`. Class could be corrupted!", m, cid)
+			continue
+		}
+
+		active := false
+		for _, pid := range member.Programs {
+			p, err := c.LoadProgram(c.Request().Context(), pid)
+			if err != nil || !inClass(class, p) {
+				continue
+			}
+			if since(p.DateCreated, start) {
+				resp.NewPrograms++
+				resp.Timeline[day(p.DateCreated, loc)]++
+				active = true
+			}
+			if saved := p.LastSaved(); since(saved, start) {
+				resp.Edits++
+				resp.Timeline[day(saved, loc)]++
+				active = true
+			}
+		}
+		if active {
+			resp.ActiveMembers++
+		}
+	}
+
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// dateLayout is the layout of calendar dates in requests.
+const dateLayout = "2006-01-02"
+
+// dayNumber returns the number of days from the Unix epoch to
+// the calendar date of t, in t's location.
+func dayNumber(t time.Time) int {
+	y, m, d := t.Date()
+	return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60))
+}
+
+// languageBucket counts the programs created in each language
+// over the days starting at Start.
+type languageBucket struct {
+	Start  string         `json:"start"`
+	Counts map[string]int `json:"counts"`
+}
+
+// GetClassLanguageTrend counts the programs created in each
+// language by the members of a class, bucketed over a range of
+// dates. Dates are taken in the class's time zone, and both ends
+// of the range are included. Every bucket counts every language,
+// even when no programs were created. Only programs in the class
+// with a known language are counted.
+//
+// Query Parameters:
+//  - uid string: UID of an instructor of the class
+//  - cid string: CID of the class
+//  - from string: first date of the range, as YYYY-MM-DD
+//  - to string: last date of the range, as YYYY-MM-DD
+//  - bucket string: either "day", the default, or "week"
+//
+// Returns: Status 200 with the marshalled buckets, in order.
+func GetClassLanguageTrend(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid := c.QueryParam("uid"), c.QueryParam("cid")
+	if uid == "" || cid == "" || c.QueryParam("from") == "" || c.QueryParam("to") == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid`, `cid`, `from`, and `to` are required query parameters.")
+	}
+	size := 1
+	switch c.QueryParam("bucket") {
+	case "", "day":
+	case "week":
+		size = 7
+	default:
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`bucket` must be either day or week")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(uid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	loc := class.Location()
+	from, err := time.ParseInLocation(dateLayout, c.QueryParam("from"), loc)
+	if err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`from` must be a date such as 2006-01-02")
+	}
+	to, err := time.ParseInLocation(dateLayout, c.QueryParam("to"), loc)
+	if err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`to` must be a date such as 2006-01-02")
+	}
+	first, last := dayNumber(from), dayNumber(to)
+	if last < first || last-first >= maxEngagementDays {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, fmt.Sprintf("the range must be from 1 to %d days long", maxEngagementDays))
+	}
+
+	// zero-fill every bucket up front.
+	languages := db.Languages()
+	trend := make([]languageBucket, 0, (last-first)/size+1)
+	for start := from; dayNumber(start) <= last; start = start.AddDate(0, 0, size) {
+		b := languageBucket{Start: start.Format(dateLayout), Counts: make(map[string]int, len(languages))}
+		for _, l := range languages {
+			b.Counts[l] = 0
+		}
+		trend = append(trend, b)
+	}
+
+	// load each member's programs concurrently, a few at a time.
+	var mu sync.Mutex
+	sem := make(chan struct{}, maxParallelMemberLoads)
+	var wg sync.WaitGroup
+	for _, m := range class.Members {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(m string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			member, err := c.LoadUser(c.Request().Context(), m)
+			if err != nil {
+				c.Logger().Warnf("Failed to load user with uid `%s` in class with cid `%s`. Class could be corrupted!", m, cid)
+				return
+			}
+			for _, pid := range member.Programs {
+				p, err := c.LoadProgram(c.Request().Context(), pid)
+				if err != nil || !inClass(class, p) {
+					continue
+				}
+				if _, err := db.LanguageCode(p.Language); err != nil {
+					continue
+				}
+				created, err := time.Parse(db.TimestampLayout, p.DateCreated)
+				if err != nil {
+					continue
+				}
+				n := dayNumber(created.In(loc))
+				if n < first || n > last {
+					continue
+				}
+				mu.Lock()
+				trend[(n-first)/size].Counts[p.Language]++
+				mu.Unlock()
+			}
+		}(m)
+	}
+	wg.Wait()
+
+	return c.JSON(http.StatusOK, trend)
+}
+
+// instructorProfile is the public profile of an instructor.
+type instructorProfile struct {
+	UID         string `json:"uid"`
+	DisplayName string `json:"displayName"`
+	PhotoName   string `json:"photoName"`
+	Creator     bool   `json:"creator"`
+}
+
+// GetClassInstructors returns the public profiles of the
+// creator and instructors of a class. Instructors that cannot
+// be loaded are left out.
+//
+// Query Parameters:
+//  - uid string: UID of a member of the class
+//  - cid string: CID of the class
+//
+// Returns: Status 200 with a marshalled array of profiles.
+func GetClassInstructors(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid := c.QueryParam("uid"), c.QueryParam("cid")
+	if uid == "" || cid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` and `cid` are required query parameters.")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.HasAccess(uid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user not in class")
+	}
+
+	uids := class.Instructors
+	if class.Creator != "" && !class.IsInstructor(class.Creator) {
+		uids = append([]string{class.Creator}, uids...)
+	}
+
+	// load each profile concurrently, keeping them in order.
+	profiles := make([]*instructorProfile, len(uids))
+	var wg sync.WaitGroup
+	for i, instructor := range uids {
+		wg.Add(1)
+		go func(i int, instructor string) {
+			defer wg.Done()
+			u, err := c.LoadUser(c.Request().Context(), instructor)
+			if err != nil {
+				c.Logger().Warnf("Failed to load instructor with uid `%s` for class with cid `%s`: %v", instructor, cid, err)
+				return
+			}
+			profiles[i] = &instructorProfile{
+				UID:         instructor,
+				DisplayName: u.DisplayName,
+				PhotoName:   u.PhotoName,
+				Creator:     instructor == class.Creator,
+			}
+		}(i, instructor)
+	}
+	wg.Wait()
+
+	resp := make([]instructorProfile, 0, len(profiles))
+	for _, p := range profiles {
+		if p != nil {
+			resp = append(resp, *p)
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// RemoveProgramFromClass removes a program from the library
+// of a class without deleting it, leaving it with its owner.
+//
+// Request Body:
+// {
+//     "uid": string <instructor of the class>
+//     "cid": string
+//     "pid": string <program to remove>
+// }
+//
+// Returns: Status 200 with the marshalled PIDs of the programs
+// left in the class.
+func RemoveProgramFromClass(cc echo.Context) error {
+	var req struct {
+		UID string `json:"uid"`
+		CID string `json:"cid"`
+		PID string `json:"pid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" || req.PID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid, cid, and pid fields are all required")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+	if !class.RemoveProgram(req.PID) {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "program is not in the class")
+	}
+
+	if err := c.StoreClass(c.Request().Context(), class); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to remove program from class").Error())
+	}
+
+	// the program no longer belongs to the class.
+	if p, err := c.LoadProgram(c.Request().Context(), req.PID); err == nil && p.WID == class.WID {
+		p.WID = ""
+		if err := c.StoreProgram(c.Request().Context(), p); err != nil {
+			return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to update program").Error())
+		}
+	}
+
+	return c.JSON(http.StatusOK, class.Programs)
+}
+
+// maxParallelClassLoads bounds the number of classes loaded
+// at once when building the teacher dashboard.
+const maxParallelClassLoads = 8
+
+// GetTeacherDashboard returns a summary of each class that
+// a user instructs, including when it was last active.
+// Classes that the user only attends are left out.
+//
+// Query Parameters:
+//  - uid string: UID of the teacher
+//
+// Returns: Status 200 with a marshalled array of summaries.
+func GetTeacherDashboard(cc echo.Context) error {
+	type classOverview struct {
+		db.ClassSummary
+		LastActivity string `json:"lastActivity"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	uid := c.QueryParam("uid")
+	if uid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` is a required query parameter.")
+	}
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+
+	// load classes concurrently, a few at a time.
+	overviews := make([]*classOverview, len(user.Classes))
+	sem := make(chan struct{}, maxParallelClassLoads)
+	var wg sync.WaitGroup
+	for i, cid := range user.Classes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, cid string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			class, err := c.LoadClass(c.Request().Context(), cid)
+			if err != nil {
+				c.Logger().Warnf("Failed to load class with cid `%s` for user with uid `%s`. User could be corrupted!", cid, uid)
+				return
+			}
+			if class.IsInstructor(uid) {
+				overviews[i] = &classOverview{
+					ClassSummary: class.Summary(),
+					LastActivity: class.Stats.LastActivity,
+				}
+			}
+		}(i, cid)
+	}
+	wg.Wait()
+
+	resp := make([]classOverview, 0, len(overviews))
+	for _, o := range overviews {
+		if o != nil {
+			resp = append(resp, *o)
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// GetUserClasses returns every class a user belongs to, in
+// the order of the user's list of classes. Classes that fail
+// to load are left out and listed as missing instead.
+//
+// Query Parameters:
+//  - uid string: UID of the user
+//
+// Returns: Status 200 with the marshalled classes and the cids
+// of missing ones.
+func GetUserClasses(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid := c.QueryParam("uid")
+	if uid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` is a required query parameter.")
+	}
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+
+	// load classes concurrently, a few at a time.
+	classes := make([]*db.Class, len(user.Classes))
+	sem := make(chan struct{}, maxParallelClassLoads)
+	var wg sync.WaitGroup
+	for i, cid := range user.Classes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, cid string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			class, err := c.LoadClass(c.Request().Context(), cid)
+			if err != nil {
+				c.Logger().Warnf("Failed to load class with cid `%s` for user with uid `%s`. User could be corrupted!", cid, uid)
+				return
+			}
+			classes[i] = &class
+		}(i, cid)
+	}
+	wg.Wait()
+
+	resp := struct {
+		Classes []db.Class `json:"classes"`
+		Missing []string   `json:"missing"`
+	}{
+		Classes: make([]db.Class, 0, len(classes)),
+		Missing: make([]string, 0),
+	}
+	for i, class := range classes {
+		if class == nil {
+			resp.Missing = append(resp.Missing, user.Classes[i])
+			continue
+		}
+		resp.Classes = append(resp.Classes, *class)
+	}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// maxParallelMemberLoads bounds the number of members whose
+// programs are loaded at once.
+const maxParallelMemberLoads = 8
+
+// templateFork is a member's fork of a template program.
+type templateFork struct {
+	UID string `json:"uid"`
+	PID string `json:"pid"`
+}
+
+// GetTemplateForkers partitions the members of a class into
+// those who have a fork of a template program and those who
+// do not, showing at a glance who has started an assignment.
+// Forks of forks of the template count. Members that cannot
+// be loaded are left out.
+//
+// Query Parameters:
+//  - uid string: UID of an instructor of the class
+//  - cid string: CID of the class
+//  - pid string: PID of the template program
+//
+// Returns: Status 200 with the marshalled partition.
+func GetTemplateForkers(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid, pid := c.QueryParam("uid"), c.QueryParam("cid"), c.QueryParam("pid")
+	if uid == "" || cid == "" || pid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid`, `cid`, and `pid` are required query parameters.")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(uid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	// find each member's fork concurrently, a few at a time.
+	forks := make([]string, len(class.Members))
+	loaded := make([]bool, len(class.Members))
+	sem := make(chan struct{}, maxParallelMemberLoads)
+	var wg sync.WaitGroup
+	for i, m := range class.Members {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, m string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			member, err := c.LoadUser(c.Request().Context(), m)
+			if err != nil {
+				c.Logger().Warnf("Failed to load user with uid `%s` in class with cid `%s`. Class could be corrupted!", m, cid)
+				return
+			}
+			loaded[i] = true
+			for _, p := range member.Programs {
+				if p != pid && descendsFrom(c, p, pid) {
+					forks[i] = p
+					return
+				}
+			}
+		}(i, m)
+	}
+	wg.Wait()
+
+	resp := struct {
+		Forked    []templateFork `json:"forked"`
+		NotForked []string       `json:"notForked"`
+	}{
+		Forked:    []templateFork{},
+		NotForked: []string{},
+	}
+	for i, m := range class.Members {
+		switch {
+		case !loaded[i]:
+		case forks[i] != "":
+			resp.Forked = append(resp.Forked, templateFork{UID: m, PID: forks[i]})
+		default:
+			resp.NotForked = append(resp.NotForked, m)
+		}
+	}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// joinCodePattern matches the format of a class join code: a
+// few words separated by commas.
+var joinCodePattern = regexp.MustCompile(`^[A-Za-z]+(,[A-Za-z]+)+$`)
+
+// ResolveJoinCode returns a preview of the class a join code
+// belongs to, without joining it, so that invite links can
+// show the class first. Archived classes no longer accept new
+// members, so their codes are reported as gone.
+//
+// Query Parameters:
+//  - code string: Join code (WID) of the class
+//
+// Returns: Status 200 with the marshalled preview, 404 if no
+// class has the code, or 410 if its class is archived.
+func ResolveJoinCode(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	code := c.QueryParam("code")
+	if code == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`code` is a required query parameter.")
+	}
+	if !joinCodePattern.MatchString(code) {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "malformed join code")
+	}
+
+	class, err := c.LoadClassByWID(c.Request().Context(), code)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if class.Archived {
+		return httpext.Error(c, http.StatusGone, httpext.CodeGone, "class is no longer accepting members")
+	}
+
+	preview := struct {
+		CID         string `json:"cid"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Thumbnail   int64  `json:"thumbnail"`
+		Members     int    `json:"members"`
+	}{
+		CID:         class.CID,
+		Name:        class.Name,
+		Description: class.Description,
+		Thumbnail:   class.Thumbnail,
+		Members:     len(class.Members),
+	}
+	return c.JSON(http.StatusOK, &preview)
+}
+
+// JoinByCode adds a user to the class with the given join
+// code, and the class to the user, so that students can join
+// without knowing the class's CID. Codes are matched ignoring
+// case. Archived classes no longer accept new members.
+//
+// Request Body:
+// {
+//     "uid": string <user joining the class>
+//     "code": string <join code (WID) of the class>
+// }
+//
+// Returns: Status 200 with the marshalled updated class, 404 if
+// no class has the code, 409 if the user is already a member,
+// or 410 if the class is archived.
+func JoinByCode(cc echo.Context) error {
+	var req struct {
+		UID  string `json:"uid"`
+		Code string `json:"code"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.Code == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and code fields are both required")
+	}
+	if err := db.ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+	if !joinCodePattern.MatchString(strings.TrimSpace(req.Code)) {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "malformed join code")
+	}
+
+	class, err := c.LoadClassByWID(c.Request().Context(), req.Code)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if class.Archived {
+		return httpext.Error(c, http.StatusGone, httpext.CodeGone, "class is no longer accepting members")
+	}
+	if class.IsMember(req.UID) {
+		return httpext.Error(c, http.StatusConflict, httpext.CodeConflict, "user is already a member of the class")
+	}
+	if _, err := c.LoadUser(c.Request().Context(), req.UID); err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "user does not exist")
+	}
+
+	class, err = setMember(c, class.CID, req.UID, true)
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to add user to class").Error())
+	}
+	return c.JSON(http.StatusOK, &class)
+}
+
+// maxSampledPrograms is the most programs of a class library
+// looked at to guess which languages the class uses.
+const maxSampledPrograms = 10
+
+// GetRecommendedClasses returns a page of discoverable classes
+// a user is not yet in, best matches first. Classes whose
+// libraries use the languages the user writes in rank higher,
+// followed by larger classes. Only the first few programs of
+// each library are looked at. Archived classes are left out.
+//
+// Query Parameters:
+//  - uid string: UID of the user
+//  - offset int: Index of the first class to return, 0 by default.
+//  - limit int: Most classes to return, 20 by default.
+//
+// Returns: Status 200 with the marshalled page of class
+// summaries and the total number of recommendations.
+func GetRecommendedClasses(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid := c.QueryParam("uid")
+	if uid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` is a required query parameter.")
+	}
+	offset, limit, err := pageParams(c)
+	if err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, err.Error())
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+	languages := make(map[string]bool)
+	for _, pid := range user.Programs {
+		if p, err := c.LoadProgram(c.Request().Context(), pid); err == nil {
+			languages[p.Language] = true
+		}
+	}
+
+	classes, err := c.LoadDiscoverableClasses(c.Request().Context())
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to load classes").Error())
+	}
+
+	type candidate struct {
+		class   db.Class
+		matches int
+	}
+	candidates := make([]candidate, 0, len(classes))
+	for _, class := range classes {
+		if class.Archived || class.IsMember(uid) || class.IsInstructor(uid) {
+			continue
+		}
+		cand := candidate{class: class}
+		for i, pid := range class.Programs {
+			if i == maxSampledPrograms {
+				break
+			}
+			if p, err := c.LoadProgram(c.Request().Context(), pid); err == nil && languages[p.Language] {
+				cand.matches++
+			}
+		}
+		candidates = append(candidates, cand)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.matches != b.matches {
+			return a.matches > b.matches
+		}
+		if len(a.class.Members) != len(b.class.Members) {
+			return len(a.class.Members) > len(b.class.Members)
+		}
+		return a.class.CID < b.class.CID
+	})
+
+	start, end := page(len(candidates), offset, limit)
+	resp := struct {
+		Classes []db.ClassSummary `json:"classes"`
+		Total   int               `json:"total"`
+	}{
+		Classes: make([]db.ClassSummary, 0, end-start),
+		Total:   len(candidates),
+	}
+	for _, cand := range candidates[start:end] {
+		resp.Classes = append(resp.Classes, cand.class.Summary())
+	}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+const (
+	// classStorageTTL is how long the storage footprint of a
+	// class is cached for.
+	classStorageTTL = time.Minute
+
+	// classStorageTimeout bounds how long computing the
+	// storage footprint of a class may take.
+	classStorageTimeout = 10 * time.Second
+)
+
+// classStorage is the storage footprint of a class: the size
+// of the code of each member's programs in the class, and of
+// the rest of the class library.
+type classStorage struct {
+	Total      int            `json:"total"`
+	Library    int            `json:"library"`
+	Members    map[string]int `json:"members"`
+	ComputedAt string         `json:"computedAt"`
+}
+
+// storageCache holds recently computed storage footprints,
+// keyed by cid.
+var storageCache = struct {
+	sync.Mutex
+	entries map[string]classStorage
+}{entries: make(map[string]classStorage)}
+
+// cachedStorage returns the cached storage footprint of the
+// class, if it is recent enough.
+func cachedStorage(cid string, now time.Time) (classStorage, bool) {
+	storageCache.Lock()
+	defer storageCache.Unlock()
+	s, ok := storageCache.entries[cid]
+	if !ok {
+		return classStorage{}, false
+	}
+	computed, err := time.Parse(db.TimestampLayout, s.ComputedAt)
+	if err != nil || now.Sub(computed) >= classStorageTTL {
+		return classStorage{}, false
+	}
+	return s, true
+}
+
+// cacheStorage caches the storage footprint of the class,
+// evicting any entries that have expired.
+func cacheStorage(cid string, s classStorage, now time.Time) {
+	storageCache.Lock()
+	defer storageCache.Unlock()
+	for k, v := range storageCache.entries {
+		if computed, err := time.Parse(db.TimestampLayout, v.ComputedAt); err != nil || now.Sub(computed) >= classStorageTTL {
+			delete(storageCache.entries, k)
+		}
+	}
+	storageCache.entries[cid] = s
+}
+
+// GetClassStorage returns the storage footprint of a class:
+// the size in bytes of the code of each member's programs in
+// the class, of the rest of the class library, and in total.
+// Each program is counted once. Footprints are expensive to
+// compute, so they are cached for a minute.
+//
+// Query Parameters:
+//  - uid string: UID of an instructor of the class
+//  - cid string: CID of the class
+//
+// Returns: Status 200 with the marshalled footprint, or 504 if
+// it took too long to compute.
+func GetClassStorage(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid := c.QueryParam("uid"), c.QueryParam("cid")
+	if uid == "" || cid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` and `cid` are required query parameters.")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(uid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	now := time.Now().UTC()
+	if s, ok := cachedStorage(cid, now); ok {
+		return c.JSON(http.StatusOK, &s)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), classStorageTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	// find the size of each library program in the background.
+	library := make(map[string]int)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, pid := range class.Programs {
+			if ctx.Err() != nil {
+				return
+			}
+			if p, err := c.LoadProgram(ctx, pid); err == nil {
+				library[pid] = len(p.Code)
+			}
+		}
+	}()
+
+	// meanwhile, find the size of each member's programs in
+	// the class concurrently, a few members at a time.
+	owned := make([]map[string]int, len(class.Members))
+	sem := make(chan struct{}, maxParallelMemberLoads)
+	for i, m := range class.Members {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, m string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			member, err := c.LoadUser(ctx, m)
+			if err != nil {
+				c.Logger().Warnf("Failed to load user with uid `%s` in class with cid `%s`. Class could be corrupted!", m, cid)
+				return
+			}
+			owned[i] = make(map[string]int)
+			for _, pid := range member.Programs {
+				if ctx.Err() != nil {
+					return
+				}
+				if p, err := c.LoadProgram(ctx, pid); err == nil && inClass(class, p) {
+					owned[i][pid] = len(p.Code)
+				}
+			}
+		}(i, m)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return httpext.Error(c, http.StatusGatewayTimeout, httpext.CodeTimeout, "timed out computing class storage")
+	}
+
+	// members' programs in the library are counted as theirs.
+	s := classStorage{
+		Members:    make(map[string]int),
+		ComputedAt: now.Format(db.TimestampLayout),
+	}
+	for i, m := range class.Members {
+		if owned[i] == nil {
+			continue
+		}
+		s.Members[m] = 0
+		for pid, n := range owned[i] {
+			s.Members[m] += n
+			s.Total += n
+			delete(library, pid)
+		}
+	}
+	for _, n := range library {
+		s.Library += n
+		s.Total += n
+	}
+	cacheStorage(cid, s, now)
+	return c.JSON(http.StatusOK, &s)
+}
+
+// setInstructor promotes a member of a class to instructor, or
+// demotes an instructor back to a member, on behalf of an
+// instructor or the creator of the class.
+func setInstructor(cc echo.Context, promote bool) error {
+	var req struct {
+		RequesterUID string `json:"requesterUid"`
+		TargetUID    string `json:"targetUid"`
+		CID          string `json:"cid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.RequesterUID == "" || req.TargetUID == "" || req.CID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "requesterUid, targetUid, and cid fields are all required")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(req.RequesterUID) && class.Creator != req.RequesterUID {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+	switch {
+	case promote && !class.IsMember(req.TargetUID):
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "only members of the class can be promoted")
+	case !promote && req.TargetUID == class.Creator:
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "the creator of the class cannot be demoted")
+	case !promote && !class.IsInstructor(req.TargetUID):
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "given user is not an instructor of the class")
+	}
+
+	class, err = c.ModifyClass(c.Request().Context(), req.CID, func(class *db.Class) error {
+		if promote {
+			class.AddInstructor(req.TargetUID)
+		} else {
+			class.RemoveInstructor(req.TargetUID)
+		}
+		return nil
+	})
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to update class").Error())
+	}
+	return c.JSON(http.StatusOK, &class)
+}
+
+// PromoteInstructor makes a member of a class one of its
+// instructors. They remain a member. Only instructors and the
+// creator of the class may promote members.
+//
+// Request Body:
+// {
+//     "requesterUid": string <instructor or creator of the class>
+//     "targetUid": string <member to promote>
+//     "cid": string
+// }
+//
+// Returns: Status 200 with the marshalled class.
+func PromoteInstructor(cc echo.Context) error {
+	return setInstructor(cc, true)
+}
+
+// DemoteInstructor removes a user from the instructors of a
+// class, leaving their membership as is. The creator of the
+// class cannot be demoted. Only instructors and the creator of
+// the class may demote instructors.
+//
+// Request Body:
+// {
+//     "requesterUid": string <instructor or creator of the class>
+//     "targetUid": string <instructor to demote>
+//     "cid": string
+// }
+//
+// Returns: Status 200 with the marshalled class.
+func DemoteInstructor(cc echo.Context) error {
+	return setInstructor(cc, false)
+}
+
+// deadlineLayout is the layout of deadlines given to
+// SetTemplateDeadline, in the class's time zone.
+const deadlineLayout = "2006-01-02T15:04"
+
+// SetTemplateDeadline sets when work on a template program in
+// a class library is due. The deadline is a wall-clock time in
+// the class's time zone, such as "2021-03-01T23:59". An empty
+// deadline removes it.
+//
+// Request Body:
+// {
+//     "uid": string <instructor of the class>
+//     "cid": string
+//     "pid": string <template program in the class library>
+//     "deadline": string
+// }
+//
+// Returns: Status 200 with the marshalled class.
+func SetTemplateDeadline(cc echo.Context) error {
+	var req struct {
+		UID      string `json:"uid"`
+		CID      string `json:"cid"`
+		PID      string `json:"pid"`
+		Deadline string `json:"deadline"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.CID == "" || req.PID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid, cid, and pid fields are all required")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), req.CID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+	if !class.HasProgram(req.PID) {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "program is not in the class library")
+	}
+
+	if req.Deadline == "" {
+		delete(class.Deadlines, req.PID)
+	} else {
+		due, err := time.ParseInLocation(deadlineLayout, req.Deadline, class.Location())
+		if err != nil {
+			return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, fmt.Sprintf("deadline must be formatted as %s", deadlineLayout))
+		}
+		if class.Deadlines == nil {
+			class.Deadlines = make(map[string]string)
+		}
+		class.Deadlines[req.PID] = due.UTC().Format(db.TimestampLayout)
+	}
+
+	if err := c.StoreClass(c.Request().Context(), class); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to update class").Error())
+	}
+	return c.JSON(http.StatusOK, &class)
+}
+
+// submission describes whether a member's fork of a template
+// program was last saved before its deadline.
+type submission struct {
+	UID       string `json:"uid"`
+	PID       string `json:"pid,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+	Status    string `json:"status"`
+}
+
+// GetSubmissionTimeliness reports, for each member of a class,
+// whether their fork of a template program in the class was
+// last saved before the template's deadline. Members without
+// a fork have not submitted. Members whose fork cannot be
+// loaded, or whose save time cannot be read, are reported as
+// unknown. Times are given in the class's time zone. Members
+// that cannot be loaded are left out.
+//
+// Query Parameters:
+//  - uid string: UID of an instructor of the class
+//  - cid string: CID of the class
+//  - pid string: PID of the template program
+//
+// Returns: Status 200 with the deadline and each member's
+// submission.
+func GetSubmissionTimeliness(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid, pid := c.QueryParam("uid"), c.QueryParam("cid"), c.QueryParam("pid")
+	if uid == "" || cid == "" || pid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid`, `cid`, and `pid` are required query parameters.")
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(uid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+	due, ok := class.Deadline(pid)
+	if !ok {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "program has no deadline in the class")
+	}
+
+	loc := class.Location()
+	resp := struct {
+		Deadline    string       `json:"deadline"`
+		Submissions []submission `json:"submissions"`
+	}{
+		Deadline:    due.In(loc).Format(db.TimestampLayout),
+		Submissions: make([]submission, 0, len(class.Members)),
+	}
+	for _, m := range class.Members {
+		member, err := c.LoadUser(c.Request().Context(), m)
+		if err != nil {
+			c.Logger().Warnf("Failed to load user with uid `%s` in class with cid `%s`. Class could be corrupted!", m, cid)
+			continue
+		}
+
+		s := submission{UID: m, Status: "not submitted"}
+		if s.PID, err = forkInClass(c.Request().Context(), c, member, pid, class.WID); err != nil {
+			c.Logger().Warnf("Failed to load the programs of user with uid `%s`: %v", m, err)
+			s.Status = "unknown"
+		} else if s.PID != "" {
+			fork, err := c.LoadProgram(c.Request().Context(), s.PID)
+			if err != nil {
+				c.Logger().Warnf("Failed to load program with pid `%s` for user with uid `%s`. User could be corrupted!", s.PID, m)
+				s.Status = "unknown"
+				resp.Submissions = append(resp.Submissions, s)
+				continue
+			}
+			saved := fork.LastSaved()
+			if saved == "" {
+				saved = fork.DateCreated
+			}
+			ts, err := time.Parse(db.TimestampLayout, saved)
+			switch {
+			case err != nil:
+				s.Status = "unknown"
+			case ts.After(due):
+				s.Status = "late"
+			default:
+				s.Status = "on time"
+			}
+			if err == nil {
+				s.UpdatedAt = ts.In(loc).Format(db.TimestampLayout)
+			}
+		}
+		resp.Submissions = append(resp.Submissions, s)
+	}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// MoveClassProgram moves a program from the library of one
+// class to another. The requester must be an instructor of
+// both classes, and the destination must have room for it.
+// The checks on the class libraries are made in the same
+// transaction as the move.
+//
+// Request Body:
+// {
+//     "uid": string <instructor of both classes>
+//     "fromCid": string <class the program is in>
+//     "toCid": string <class to move the program to>
+//     "pid": string
+// }
+//
+// Returns: Status 200 with the marshalled destination class,
+// 400 if the program is not in the source class, 404 if it does
+// not exist, or 409 if it is already in the destination or the
+// destination is full.
+func MoveClassProgram(cc echo.Context) error {
+	var req struct {
+		UID     string `json:"uid"`
+		FromCID string `json:"fromCid"`
+		ToCID   string `json:"toCid"`
+		PID     string `json:"pid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.FromCID == "" || req.ToCID == "" || req.PID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid, fromCid, toCid, and pid fields are all required")
+	}
+	if req.FromCID == req.ToCID {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "cannot move a program into the class it is in")
+	}
+
+	src, err := c.LoadClass(c.Request().Context(), req.FromCID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	dst, err := c.LoadClass(c.Request().Context(), req.ToCID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+
+	if !src.IsInstructor(req.UID) || !dst.IsInstructor(req.UID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of both classes")
+	}
+
+	// the library checks are made in the same transaction as
+	// the move, so that concurrent moves cannot overfill dst.
+	if err := c.MoveClassProgram(c.Request().Context(), req.PID, src.CID, dst.CID); err != nil {
+		switch {
+		case err == db.ErrProgramNotInClass:
+			return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, err.Error())
+		case err == db.ErrProgramInClass, err == db.ErrClassFull:
+			return httpext.Error(c, http.StatusConflict, httpext.CodeConflict, err.Error())
+		case status.Code(err) == codes.NotFound:
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, "program does not exist")
+		}
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to move program").Error())
+	}
+
+	dst, err = c.LoadClass(c.Request().Context(), req.ToCID)
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to load destination class").Error())
+	}
+	return c.JSON(http.StatusOK, &dst)
 }
@@ -3,16 +3,19 @@ package handler_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/uclaacm/teach-la-go-backend/db"
 	"github.com/uclaacm/teach-la-go-backend/handler"
+	"github.com/uclaacm/teach-la-go-backend/httpext"
 )
 
 func TestGetClass(t *testing.T) {
@@ -90,8 +93,11 @@ func TestGetClass(t *testing.T) {
 			Context: c,
 			TLADB:   d,
 		})) {
-			require.Equal(t, http.StatusBadRequest, rec.Code)
-			assert.Equal(t, "given user not in class", rec.Body.String())
+			require.Equal(t, http.StatusForbidden, rec.Code)
+			resp := httpext.ErrorBody{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, httpext.CodeForbidden, resp.Error.Code)
+			assert.Equal(t, "given user not in class", resp.Error.Message)
 		}
 	})
 	t.Run("validClass", func(t *testing.T) {
@@ -122,6 +128,35 @@ func TestGetClass(t *testing.T) {
 			assert.NotZero(t, res.CID)
 		}
 	})
+	t.Run("instructorOrCreatorNotInMembers", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Creator:     "creator",
+			Instructors: []string{"instructor"},
+			Members:     []string{"member"},
+		}))
+		for _, uid := range []string{"creator", "instructor", "member"} {
+			require.NoError(t, d.StoreUser(context.Background(), db.User{UID: uid}))
+		}
+		for _, uid := range []string{"creator", "instructor"} {
+			req := httptest.NewRequest(http.MethodPost, "/?userData=true", strings.NewReader(fmt.Sprintf(`{"uid": "%s", "cid": "test"}`, uid)))
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			if assert.NoError(t, handler.GetClass(&db.DBContext{
+				Context: c,
+				TLADB:   d,
+			})) {
+				require.Equal(t, http.StatusOK, rec.Code, uid)
+				res := struct {
+					UserData map[string]db.User `json:"userData"`
+				}{}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+				assert.Contains(t, res.UserData, "member", uid)
+			}
+		}
+	})
 	t.Run("withPrograms", func(t *testing.T) {
 		d := db.OpenMock()
 		require.NoError(t, d.StoreClass(context.Background(), db.Class{
@@ -156,6 +191,71 @@ func TestGetClass(t *testing.T) {
 		}
 	})
 
+	t.Run("instructorOnlyPrograms", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Instructors: []string{"teacher"},
+			Members:     []string{"student"},
+			Programs:    []string{"template", "shared"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "template", InstructorOnly: true}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "shared"}))
+		list := func(t *testing.T, uid string) []string {
+			body := fmt.Sprintf(`{"uid": %q, "cid": "test"}`, uid)
+			req := httptest.NewRequest(http.MethodPost, "/?programs=true", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			require.NoError(t, handler.GetClass(&db.DBContext{
+				Context: c,
+				TLADB:   d,
+			}))
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			res := struct {
+				Programs    []string     `json:"programs"`
+				ProgramData []db.Program `json:"programData"`
+			}{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			pids := []string{}
+			for _, p := range res.ProgramData {
+				pids = append(pids, p.UID)
+			}
+			// the pids of hidden programs are left out too.
+			assert.Equal(t, pids, res.Programs)
+			return pids
+		}
+
+		assert.Equal(t, []string{"shared"}, list(t, "student"))
+		assert.Equal(t, []string{"template", "shared"}, list(t, "teacher"))
+	})
+
+	t.Run("deletedPrograms", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:      "test",
+			Members:  []string{"test"},
+			Programs: []string{"trashed", "kept"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "trashed", DeletedAt: "yesterday"}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "kept"}))
+		req := httptest.NewRequest(http.MethodPost, "/?programs=true", strings.NewReader(`{"uid": "test", "cid": "test"}`))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetClass(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		res := struct {
+			ProgramData []db.Program `json:"programData"`
+		}{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		require.Len(t, res.ProgramData, 1)
+		assert.Equal(t, "kept", res.ProgramData[0].UID)
+	})
+
 	t.Run("withUsersStudent", func(t *testing.T) {
 		d := db.OpenMock()
 		require.NoError(t, d.StoreClass(context.Background(), db.Class{
@@ -309,6 +409,29 @@ func TestGetClass(t *testing.T) {
 }
 
 func TestDeleteClass(t *testing.T) {
+	t.Run("noCreator", func(t *testing.T) {
+		// classes left without a creator may be deleted by an
+		// administrator, and by nobody else.
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "user"}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{CID: "orphan"}))
+		del := func(uid string) int {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"uid": "`+uid+`", "cid": "orphan"}`))
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			require.NoError(t, handler.DeleteClass(&db.DBContext{
+				Context: c,
+				TLADB:   d,
+			}))
+			return rec.Code
+		}
+
+		assert.Equal(t, http.StatusForbidden, del("user"))
+		assert.Equal(t, http.StatusOK, del("admin"))
+		_, err := d.LoadClass(context.Background(), "orphan")
+		assert.Error(t, err)
+	})
 	t.Run("missingCID", func(t *testing.T) {
 		d := db.OpenMock()
 		req := httptest.NewRequest(http.MethodPost, "/", nil)
@@ -339,7 +462,7 @@ func TestDeleteClass(t *testing.T) {
 	})
 	t.Run("classDNE", func(t *testing.T) {
 		d := db.OpenMock()
-		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{\"cid\": \"does not exist\"}"))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"does not exist\"}"))
 		rec := httptest.NewRecorder()
 		assert.NotNil(t, req, rec)
 		c := echo.New().NewContext(req, rec)
@@ -355,8 +478,9 @@ func TestDeleteClass(t *testing.T) {
 		d := db.OpenMock()
 		require.NoError(t, d.StoreClass(context.Background(), db.Class{
 			CID:     "test",
+			Creator: "test",
 		}))
-		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{\"cid\": \"test\"}"))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"test\"}"))
 		rec := httptest.NewRecorder()
 		assert.NotNil(t, req, rec)
 		c := echo.New().NewContext(req, rec)
@@ -374,12 +498,13 @@ func TestDeleteClass(t *testing.T) {
 		d := db.OpenMock()
 		require.NoError(t, d.StoreClass(context.Background(), db.Class{
 			CID:      "test",
+			Creator:  "test",
 			Programs: []string{"test"},
 		}))
 		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
 			UID: "test",
 		}))
-		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{\"cid\": \"test\"}"))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"test\"}"))
 		rec := httptest.NewRecorder()
 		assert.NotNil(t, req, rec)
 		c := echo.New().NewContext(req, rec)
@@ -395,4 +520,2060 @@ func TestDeleteClass(t *testing.T) {
 			require.Error(t, err)
 		}
 	})
+	t.Run("notCreator", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Creator:     "creator",
+			Instructors: []string{"creator", "instructor"},
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{\"uid\": \"instructor\", \"cid\": \"test\"}"))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.DeleteClass(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			_, err := d.LoadClass(context.Background(), "test")
+			assert.NoError(t, err)
+		}
+	})
+	t.Run("removesUserReferences", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Name:        "CS 31",
+			Creator:     "creator",
+			Instructors: []string{"creator"},
+			Members:     []string{"member"},
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "creator", Classes: []string{"test"}}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "member", Classes: []string{"other", "test"}}))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{\"uid\": \"creator\", \"cid\": \"test\"}"))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.DeleteClass(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			require.Equal(t, http.StatusOK, rec.Code)
+			class := db.Class{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &class))
+			assert.Equal(t, "CS 31", class.Name)
+
+			creator, err := d.LoadUser(context.Background(), "creator")
+			require.NoError(t, err)
+			assert.Empty(t, creator.Classes)
+			member, err := d.LoadUser(context.Background(), "member")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"other"}, member.Classes)
+		}
+	})
+}
+
+func TestArchiveClassPrograms(t *testing.T) {
+	t.Run("missingArchiveCID", func(t *testing.T) {
+		d := db.OpenMock()
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"test\"}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.ArchiveClassPrograms(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("notInstructor", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "src",
+			Instructors: []string{"test"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:     "archive",
+			Members: []string{"test"},
+		}))
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"src\", \"archiveCid\": \"archive\"}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.ArchiveClassPrograms(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
+	t.Run("overCap", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "src",
+			Instructors: []string{"test"},
+			Programs:    []string{"a", "b"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "archive",
+			Instructors: []string{"test"},
+			Programs:    []string{"c"},
+			MaxPrograms: 2,
+		}))
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"src\", \"archiveCid\": \"archive\"}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.ArchiveClassPrograms(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			src, err := d.LoadClass(context.Background(), "src")
+			require.NoError(t, err)
+			assert.Len(t, src.Programs, 2)
+		}
+	})
+	t.Run("validArchive", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "src",
+			Instructors: []string{"test"},
+			Programs:    []string{"a", "b"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "archive",
+			WID:         "archive,wid",
+			Instructors: []string{"test"},
+			Programs:    []string{"c"},
+			MaxPrograms: 3,
+		}))
+		for _, pid := range []string{"a", "b"} {
+			require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+				UID: pid,
+			}))
+		}
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"src\", \"archiveCid\": \"archive\"}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.ArchiveClassPrograms(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			require.Equal(t, http.StatusOK, rec.Code)
+			res := db.Class{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.ElementsMatch(t, []string{"a", "b", "c"}, res.Programs)
+
+			src, err := d.LoadClass(context.Background(), "src")
+			require.NoError(t, err)
+			assert.Empty(t, src.Programs)
+
+			p, err := d.LoadProgram(context.Background(), "a")
+			require.NoError(t, err)
+			assert.Equal(t, "archive,wid", p.WID)
+		}
+	})
+}
+
+func TestSetClassCodeLimit(t *testing.T) {
+	t.Run("notInstructor", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:     "test",
+			Members: []string{"test"},
+		}))
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"test\", \"maxCodeBytes\": 100}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.SetClassCodeLimit(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
+	t.Run("negativeLimit", func(t *testing.T) {
+		d := db.OpenMock()
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"test\", \"maxCodeBytes\": -1}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.SetClassCodeLimit(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("validLimit", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Instructors: []string{"test"},
+		}))
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"test\", \"cid\": \"test\", \"maxCodeBytes\": 100}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.SetClassCodeLimit(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			require.Equal(t, http.StatusOK, rec.Code)
+			class, err := d.LoadClass(context.Background(), "test")
+			require.NoError(t, err)
+			assert.Equal(t, 100, class.MaxAssignmentCodeBytes)
+			assert.Equal(t, 100, class.CodeLimit())
+		}
+	})
+}
+
+func TestGetClassCard(t *testing.T) {
+	t.Run("missingCID", func(t *testing.T) {
+		d := db.OpenMock()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.GetClassCard(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("privateClass", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:  "test",
+			Name: "private",
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/?cid=test", nil)
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.GetClassCard(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+		}
+	})
+	t.Run("discoverableClass", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:          "test",
+			Name:         "CS 31",
+			Description:  "intro to programming",
+			Thumbnail:    4,
+			Members:      []string{"a", "b"},
+			Discoverable: true,
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/?cid=test", nil)
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.GetClassCard(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Header().Get("Cache-Control"))
+			assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+
+			card := struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				Thumbnail   int64  `json:"thumbnail"`
+				Members     int    `json:"members"`
+			}{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &card))
+			assert.Equal(t, "CS 31", card.Name)
+			assert.Equal(t, "intro to programming", card.Description)
+			assert.Equal(t, int64(4), card.Thumbnail)
+			assert.Equal(t, 2, card.Members)
+		}
+	})
+}
+
+func TestDistributeToMembers(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			WID:         "a-b-c",
+			Instructors: []string{"teacher"},
+			Members:     []string{"s1", "s2", "s3"},
+			Programs:    []string{"template"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:  "template",
+			Name: "group project",
+			Code: "print('hi')",
+		}))
+		for _, uid := range []string{"teacher", "s1", "s2", "s3", "outsider"} {
+			require.NoError(t, d.StoreUser(context.Background(), db.User{UID: uid}))
+		}
+		return d
+	}
+	distribute := func(d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		assert.NoError(t, handler.DistributeToMembers(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		d := setup(t)
+		rec := distribute(d, `{"uid": "s1", "cid": "test", "pid": "template", "members": ["s2"]}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("subset", func(t *testing.T) {
+		d := setup(t)
+		rec := distribute(d, `{"uid": "teacher", "cid": "test", "pid": "template", "members": ["s1", "s2", "outsider"]}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		results := make(map[string]struct {
+			PID    string `json:"pid"`
+			Status string `json:"status"`
+		})
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		assert.Equal(t, "not a member", results["outsider"].Status)
+		assert.Empty(t, results["outsider"].PID)
+
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		for _, uid := range []string{"s1", "s2"} {
+			assert.Equal(t, "distributed", results[uid].Status)
+			pid := results[uid].PID
+
+			u, err := d.LoadUser(context.Background(), uid)
+			require.NoError(t, err)
+			assert.Contains(t, u.Programs, pid)
+			assert.Contains(t, class.Programs, pid)
+
+			p, err := d.LoadProgram(context.Background(), pid)
+			require.NoError(t, err)
+			assert.Equal(t, "template", p.ForkedFrom)
+			assert.Equal(t, "a-b-c", p.WID)
+			assert.Equal(t, "print('hi')", p.Code)
+		}
+
+		u, err := d.LoadUser(context.Background(), "s3")
+		require.NoError(t, err)
+		assert.Empty(t, u.Programs)
+		u, err = d.LoadUser(context.Background(), "outsider")
+		require.NoError(t, err)
+		assert.Empty(t, u.Programs)
+	})
+	t.Run("idempotent", func(t *testing.T) {
+		d := setup(t)
+		body := `{"uid": "teacher", "cid": "test", "pid": "template", "members": ["s1"]}`
+		require.Equal(t, http.StatusOK, distribute(d, body).Code)
+		rec := distribute(d, body)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		results := make(map[string]struct {
+			PID    string `json:"pid"`
+			Status string `json:"status"`
+		})
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		assert.Equal(t, "already distributed", results["s1"].Status)
+
+		u, err := d.LoadUser(context.Background(), "s1")
+		require.NoError(t, err)
+		assert.Len(t, u.Programs, 1)
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Len(t, class.Programs, 2)
+	})
+	t.Run("storeFails", func(t *testing.T) {
+		// a failed write leaves the class unchanged.
+		d := setup(t)
+		d.SetFailure("StoreUser", fmt.Errorf("unavailable"))
+		rec := distribute(d, `{"uid": "teacher", "cid": "test", "pid": "template", "members": ["s1"]}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		results := make(map[string]struct {
+			PID    string `json:"pid"`
+			Status string `json:"status"`
+		})
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		assert.Equal(t, "failed to fork program", results["s1"].Status)
+		assert.Empty(t, results["s1"].PID)
+
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"template"}, class.Programs)
+	})
+}
+
+func TestEnrollStudents(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Instructors: []string{"teacher"},
+			Members:     []string{"s1"},
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "teacher"}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "s1", Classes: []string{"test"}}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "s2"}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "s3"}))
+		return d
+	}
+	enroll := func(d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		assert.NoError(t, handler.EnrollStudents(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		d := setup(t)
+		rec := enroll(d, `{"instructorUid": "s1", "cid": "test", "studentUids": ["s2"]}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("tooMany", func(t *testing.T) {
+		d := setup(t)
+		uids := make([]string, 201)
+		for i := range uids {
+			uids[i] = fmt.Sprintf("s%d", i)
+		}
+		b, err := json.Marshal(uids)
+		require.NoError(t, err)
+		rec := enroll(d, fmt.Sprintf(`{"instructorUid": "teacher", "cid": "test", "studentUids": %s}`, b))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("roster", func(t *testing.T) {
+		d := setup(t)
+		rec := enroll(d, `{"instructorUid": "teacher", "cid": "test", "studentUids": ["s1", "s2", "s3", "ghost", "s2"]}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		results := make(map[string]string)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		assert.Equal(t, map[string]string{
+			"s1":    "already enrolled",
+			"s2":    "already enrolled",
+			"s3":    "enrolled",
+			"ghost": "not found",
+		}, results)
+
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"s1", "s2", "s3"}, class.Members)
+		for _, uid := range []string{"s1", "s2", "s3"} {
+			u, err := d.LoadUser(context.Background(), uid)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"test"}, u.Classes)
+		}
+	})
+	t.Run("failure", func(t *testing.T) {
+		d := setup(t)
+		d.SetFailure("StoreUser", fmt.Errorf("forced"))
+		rec := enroll(d, `{"instructorUid": "teacher", "cid": "test", "studentUids": ["s2"]}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		results := make(map[string]string)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		assert.Equal(t, "failed", results["s2"])
+
+		// the class is left as it was.
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"s1"}, class.Members)
+	})
+	t.Run("allOrNothing", func(t *testing.T) {
+		// the users written before the class fails are not
+		// left enrolled.
+		d := setup(t)
+		d.SetFailure("StoreClass", fmt.Errorf("forced"))
+		rec := enroll(d, `{"instructorUid": "teacher", "cid": "test", "studentUids": ["s2", "s3"]}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		results := make(map[string]string)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+		assert.Equal(t, map[string]string{"s2": "failed", "s3": "failed"}, results)
+		for _, uid := range []string{"s2", "s3"} {
+			u, err := d.LoadUser(context.Background(), uid)
+			require.NoError(t, err)
+			assert.Empty(t, u.Classes)
+		}
+	})
+}
+
+func TestRemoveStudent(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Creator:     "creator",
+			Instructors: []string{"creator", "teacher"},
+			Members:     []string{"creator", "s1", "s2"},
+		}))
+		for _, uid := range []string{"creator", "teacher", "s1", "s2"} {
+			u := db.User{UID: uid}
+			if uid != "teacher" {
+				u.Classes = []string{"test"}
+			}
+			require.NoError(t, d.StoreUser(context.Background(), u))
+		}
+		return d
+	}
+	remove := func(d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		assert.NoError(t, handler.RemoveStudent(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+	members := func(t *testing.T, d *db.MockDB) []string {
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		return class.Members
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		d := setup(t)
+		rec := remove(d, `{"instructorUid": "s1", "targetUid": "s2", "cid": "test"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, []string{"creator", "s1", "s2"}, members(t, d))
+	})
+	t.Run("creator", func(t *testing.T) {
+		d := setup(t)
+		rec := remove(d, `{"instructorUid": "teacher", "targetUid": "creator", "cid": "test"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, []string{"creator", "s1", "s2"}, members(t, d))
+	})
+	t.Run("notMember", func(t *testing.T) {
+		d := setup(t)
+		rec := remove(d, `{"instructorUid": "teacher", "targetUid": "teacher", "cid": "test"}`)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("instructor", func(t *testing.T) {
+		d := setup(t)
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		class.AddInstructor("s2")
+		require.NoError(t, d.StoreClass(context.Background(), class))
+
+		rec := remove(d, `{"instructorUid": "teacher", "targetUid": "s2", "cid": "test"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, []string{"creator", "s1", "s2"}, members(t, d))
+	})
+	t.Run("remove", func(t *testing.T) {
+		d := setup(t)
+		rec := remove(d, `{"instructorUid": "teacher", "targetUid": "s1", "cid": "test"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		class := db.Class{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &class))
+		assert.Equal(t, []string{"creator", "s2"}, class.Members)
+		assert.Equal(t, []string{"creator", "s2"}, members(t, d))
+		u, err := d.LoadUser(context.Background(), "s1")
+		require.NoError(t, err)
+		assert.Empty(t, u.Classes)
+	})
+}
+
+func TestGetSharedClasses(t *testing.T) {
+	setup := func(t *testing.T, viewerClasses, authorClasses []string) *db.MockDB {
+		d := db.OpenMock()
+		for _, cid := range []string{"a", "b", "c"} {
+			require.NoError(t, d.StoreClass(context.Background(), db.Class{CID: cid, Name: cid}))
+		}
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{CID: "old", Archived: true}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "viewer", Classes: viewerClasses}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "author", Classes: authorClasses}))
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, []db.ClassSummary) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetSharedClasses(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		classes := []db.ClassSummary{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &classes))
+		}
+		return rec, classes
+	}
+
+	t.Run("unknownViewer", func(t *testing.T) {
+		d := setup(t, nil, []string{"a"})
+		rec, _ := get(t, d, "viewer=invalid&author=author")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+	t.Run("overlapping", func(t *testing.T) {
+		d := setup(t, []string{"a", "b", "old"}, []string{"b", "c", "a", "old"})
+		rec, classes := get(t, d, "viewer=viewer&author=author")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		cids := make([]string, 0, len(classes))
+		for _, class := range classes {
+			cids = append(cids, class.CID)
+		}
+		assert.ElementsMatch(t, []string{"a", "b"}, cids)
+	})
+	t.Run("disjoint", func(t *testing.T) {
+		d := setup(t, []string{"a"}, []string{"b", "c"})
+		rec, classes := get(t, d, "viewer=viewer&author=author")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, classes)
+	})
+}
+
+func TestClassSummary(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		class := db.Class{
+			CID:         "test",
+			Instructors: []string{"teacher"},
+		}
+		class.AddMember("a")
+		class.AddMember("b")
+		class.AddProgram("template")
+		require.NoError(t, d.StoreClass(context.Background(), class))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "template"}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "teacher", Programs: []string{"template"}}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "a"}))
+		return d
+	}
+	getSummary := func(t *testing.T, d *db.MockDB, uid string) (*httptest.ResponseRecorder, db.ClassStats) {
+		req := httptest.NewRequest(http.MethodGet, "/?cid=test&uid="+uid, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetClassSummary(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		stats := db.ClassStats{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+		}
+		return rec, stats
+	}
+
+	t.Run("notInClass", func(t *testing.T) {
+		rec, _ := getSummary(t, setup(t), "outsider")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("afterProgramAdds", func(t *testing.T) {
+		d := setup(t)
+		rec, stats := getSummary(t, d, "a")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 2, stats.Members)
+		assert.Equal(t, 1, stats.Programs)
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"uid": "teacher", "cid": "test", "pid": "template", "members": ["a"]}`))
+		drec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, drec)
+		require.NoError(t, handler.DistributeToMembers(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		require.Equal(t, http.StatusOK, drec.Code)
+
+		rec, stats = getSummary(t, d, "a")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 2, stats.Members)
+		assert.Equal(t, 2, stats.Programs)
+	})
+	t.Run("rebuild", func(t *testing.T) {
+		d := setup(t)
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		class.Stats.Members = 40
+		require.NoError(t, d.StoreClass(context.Background(), class))
+
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"uid": "teacher", "cid": "test"}`))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.RebuildClassSummary(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		rec, stats := getSummary(t, d, "teacher")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 2, stats.Members)
+	})
+}
+
+func TestCopyClassSettings(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:                    "src",
+			WID:                    "a-b-c",
+			Name:                   "CS 31 Fall",
+			Thumbnail:              7,
+			Description:            "intro to programming",
+			Discoverable:           true,
+			MaxPrograms:            30,
+			MaxAssignmentCodeBytes: 2048,
+			Timezone:               "America/Los_Angeles",
+			Creator:                "founder",
+			Instructors:            []string{"founder", "teacher"},
+			Members:                []string{"a", "b"},
+			Programs:               []string{"x", "y"},
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "teacher", Classes: []string{"src"}}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "a", Classes: []string{"src"}}))
+		return d
+	}
+	copyClass := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.CopyClassSettings(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		rec := copyClass(t, setup(t), `{"uid": "a", "cid": "src", "name": "CS 31 Winter"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("copy", func(t *testing.T) {
+		d := setup(t)
+		rec := copyClass(t, d, `{"uid": "teacher", "cid": "src", "name": "  CS 31 Winter "}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		resp := db.Class{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		class, err := d.LoadClass(context.Background(), resp.CID)
+		require.NoError(t, err)
+
+		assert.NotEqual(t, "src", class.CID)
+		assert.NotEqual(t, "a-b-c", class.WID)
+		assert.Equal(t, "CS 31 Winter", class.Name)
+		assert.Equal(t, int64(7), class.Thumbnail)
+		assert.Equal(t, "intro to programming", class.Description)
+		assert.True(t, class.Discoverable)
+		assert.Equal(t, 30, class.MaxPrograms)
+		assert.Equal(t, 2048, class.MaxAssignmentCodeBytes)
+		assert.Equal(t, "America/Los_Angeles", class.Timezone)
+
+		assert.Equal(t, "teacher", class.Creator)
+		assert.Equal(t, []string{"teacher"}, class.Instructors)
+		assert.Empty(t, class.Members)
+		assert.Empty(t, class.Programs)
+
+		u, err := d.LoadUser(context.Background(), "teacher")
+		require.NoError(t, err)
+		assert.Contains(t, u.Classes, class.CID)
+	})
+	t.Run("invalidName", func(t *testing.T) {
+		d := setup(t)
+		for _, name := range []string{"   ", strings.Repeat("a", db.MaxClassNameLength+1)} {
+			body, err := json.Marshal(map[string]string{"uid": "teacher", "cid": "src", "name": name})
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusBadRequest, copyClass(t, d, string(body)).Code)
+		}
+	})
+	t.Run("storeFails", func(t *testing.T) {
+		// no class is left behind without a creator who has it.
+		d := setup(t)
+		d.SetFailure("StoreUser", fmt.Errorf("unavailable"))
+		rec := copyClass(t, d, `{"uid": "teacher", "cid": "src", "name": "CS 31 Winter"}`)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		classes, _, err := d.LoadClassPage(context.Background(), "", 50)
+		require.NoError(t, err)
+		assert.Len(t, classes, 1)
+	})
+}
+
+func TestCopyClass(t *testing.T) {
+	setup := func() *db.MockDB {
+		return db.OpenMockWith(
+			[]db.User{
+				{UID: "teacher", Classes: []string{"src"}},
+				{UID: "a", Classes: []string{"src"}},
+			},
+			[]db.Program{
+				{UID: "x", Name: "lab 1", Code: "print(1)", Language: "python", WID: "a-b-c"},
+				{UID: "y", Name: "lab 2", WID: "a-b-c", DeletedAt: "yesterday"},
+			},
+			[]db.Class{{
+				CID:         "src",
+				WID:         "a-b-c",
+				Name:        "CS 31",
+				Thumbnail:   7,
+				Creator:     "founder",
+				Instructors: []string{"founder", "teacher"},
+				Members:     []string{"a"},
+				Programs:    []string{"x", "y", "missing"},
+			}},
+		)
+	}
+	copyClass := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.CopyClass(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("missingFields", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, copyClass(t, setup(), `{"uid": "teacher"}`).Code)
+	})
+	t.Run("notInstructor", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, copyClass(t, setup(), `{"uid": "a", "cid": "src"}`).Code)
+	})
+	t.Run("copy", func(t *testing.T) {
+		d := setup()
+		rec := copyClass(t, d, `{"uid": "teacher", "cid": "src"}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		resp := db.Class{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		class, err := d.LoadClass(context.Background(), resp.CID)
+		require.NoError(t, err)
+
+		assert.NotEqual(t, "src", class.CID)
+		assert.NotEqual(t, "a-b-c", class.WID)
+		assert.Equal(t, "CS 31 (copy)", class.Name)
+		assert.Equal(t, int64(7), class.Thumbnail)
+		assert.Equal(t, "teacher", class.Creator)
+		assert.Equal(t, []string{"teacher"}, class.Instructors)
+		assert.Empty(t, class.Members)
+
+		// only the live program is copied, into a new program.
+		require.Len(t, class.Programs, 1)
+		assert.Equal(t, 1, class.Stats.Programs)
+		p, err := d.LoadProgram(context.Background(), class.Programs[0])
+		require.NoError(t, err)
+		assert.NotEqual(t, "x", p.UID)
+		assert.Equal(t, "lab 1", p.Name)
+		assert.Equal(t, "print(1)", p.Code)
+		assert.Equal(t, class.WID, p.WID)
+		assert.Equal(t, "x", p.ForkedFrom)
+
+		u, err := d.LoadUser(context.Background(), "teacher")
+		require.NoError(t, err)
+		assert.Contains(t, u.Classes, class.CID)
+		assert.Contains(t, u.Programs, p.UID)
+
+		// the source class is untouched.
+		src, err := d.LoadClass(context.Background(), "src")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"x", "y", "missing"}, src.Programs)
+	})
+	t.Run("storeFails", func(t *testing.T) {
+		// no class or programs are left behind without an owner.
+		d := setup()
+		d.SetFailure("StoreUser", fmt.Errorf("unavailable"))
+		assert.Equal(t, http.StatusInternalServerError, copyClass(t, d, `{"uid": "teacher", "cid": "src"}`).Code)
+
+		classes, _, err := d.LoadClassPage(context.Background(), "", 50)
+		require.NoError(t, err)
+		assert.Len(t, classes, 1)
+		u, err := d.LoadUser(context.Background(), "teacher")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"src"}, u.Classes)
+		assert.Empty(t, u.Programs)
+	})
+	t.Run("longName", func(t *testing.T) {
+		d := setup()
+		src, err := d.LoadClass(context.Background(), "src")
+		require.NoError(t, err)
+		src.Name = strings.Repeat("a", db.MaxClassNameLength)
+		require.NoError(t, d.StoreClass(context.Background(), src))
+
+		rec := copyClass(t, d, `{"uid": "teacher", "cid": "src"}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		class := db.Class{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &class))
+		assert.Len(t, class.Name, db.MaxClassNameLength)
+		assert.True(t, strings.HasSuffix(class.Name, " (copy)"))
+	})
+}
+
+func TestGetClassEngagement(t *testing.T) {
+	type engagement struct {
+		ActiveMembers int `json:"activeMembers"`
+		Edits         int `json:"edits"`
+		NewPrograms   int `json:"newPrograms"`
+	}
+	now := time.Now().UTC()
+	recent := now.AddDate(0, 0, -1).Format(db.TimestampLayout)
+	old := now.AddDate(0, 0, -30).Format(db.TimestampLayout)
+
+	setup := func(t *testing.T, programs map[string]db.Program) *db.MockDB {
+		// programs are seeded as they are, since storing them
+		// would refresh their UpdatedAt.
+		owned := make(map[string][]string)
+		seeded := make([]db.Program, 0, len(programs))
+		for pid, p := range programs {
+			owned[p.UID] = append(owned[p.UID], pid)
+			p.UID = pid
+			seeded = append(seeded, p)
+		}
+		d := db.OpenMockWith(nil, seeded, nil)
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			WID:         "a-b-c",
+			Instructors: []string{"teacher"},
+			Members:     []string{"active", "inactive", "elsewhere"},
+		}))
+		for _, uid := range []string{"teacher", "active", "inactive", "elsewhere"} {
+			require.NoError(t, d.StoreUser(context.Background(), db.User{UID: uid, Programs: owned[uid]}))
+		}
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, engagement) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetClassEngagement(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		e := engagement{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &e))
+		}
+		return rec, e
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		rec, _ := get(t, setup(t, nil), "uid=active&cid=test")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("noActivity", func(t *testing.T) {
+		rec, e := get(t, setup(t, nil), "uid=teacher&cid=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, engagement{}, e)
+	})
+	t.Run("activeAndInactive", func(t *testing.T) {
+		d := setup(t, map[string]db.Program{
+			// UID holds the owner while setting up.
+			"new":     {UID: "active", WID: "a-b-c", DateCreated: recent},
+			"edited":  {UID: "active", WID: "a-b-c", DateCreated: old, UpdatedAt: recent},
+			"stale":   {UID: "inactive", WID: "a-b-c", DateCreated: old, UpdatedAt: old},
+			"outside": {UID: "elsewhere", DateCreated: recent, UpdatedAt: recent},
+		})
+		rec, e := get(t, d, "uid=teacher&cid=test&days=7")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, engagement{ActiveMembers: 1, Edits: 1, NewPrograms: 1}, e)
+
+		rec, e = get(t, d, "uid=teacher&cid=test&days=60")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, engagement{ActiveMembers: 2, Edits: 2, NewPrograms: 3}, e)
+	})
+	t.Run("timelineInClassZone", func(t *testing.T) {
+		// 02:00 UTC two days ago is still the evening before in
+		// Los Angeles.
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		early := midnight.AddDate(0, 0, -2).Add(2 * time.Hour)
+		d := setup(t, map[string]db.Program{
+			"new": {UID: "active", WID: "a-b-c", DateCreated: early.Format(db.TimestampLayout)},
+		})
+		timeline := func(timezone string) map[string]int {
+			class, err := d.LoadClass(context.Background(), "test")
+			require.NoError(t, err)
+			class.Timezone = timezone
+			require.NoError(t, d.StoreClass(context.Background(), class))
+
+			rec, _ := get(t, d, "uid=teacher&cid=test")
+			require.Equal(t, http.StatusOK, rec.Code)
+			var e struct {
+				Timeline map[string]int `json:"timeline"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &e))
+			return e.Timeline
+		}
+
+		assert.Equal(t, map[string]int{early.Format("2006-01-02"): 1}, timeline(""))
+		assert.Equal(t, map[string]int{early.AddDate(0, 0, -1).Format("2006-01-02"): 1}, timeline("America/Los_Angeles"))
+	})
+}
+
+func TestGetClassLanguageTrend(t *testing.T) {
+	type bucket struct {
+		Start  string         `json:"start"`
+		Counts map[string]int `json:"counts"`
+	}
+	at := func(date string, hour int) string {
+		d, err := time.Parse("2006-01-02", date)
+		require.NoError(t, err)
+		return d.Add(time.Duration(hour) * time.Hour).Format(db.TimestampLayout)
+	}
+	counts := func(python, processing, html, react int) map[string]int {
+		return map[string]int{"python": python, "processing": processing, "html": html, "react": react}
+	}
+	setup := func(t *testing.T, timezone string) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			WID:         "a-b-c",
+			Instructors: []string{"teacher"},
+			Members:     []string{"alice", "bob", "ghost"},
+			Programs:    []string{"template"},
+			Timezone:    timezone,
+		}))
+		for _, p := range []db.Program{
+			{UID: "a1", WID: "a-b-c", Language: "python", DateCreated: at("2021-03-01", 12)},
+			{UID: "a2", WID: "a-b-c", Language: "html", DateCreated: at("2021-03-01", 18)},
+			{UID: "a3", WID: "a-b-c", Language: "python", DateCreated: at("2021-03-04", 2)},
+			{UID: "a4", WID: "other", Language: "python", DateCreated: at("2021-03-01", 12)},
+			{UID: "b1", WID: "a-b-c", Language: "react", DateCreated: at("2021-03-02", 12)},
+			{UID: "b2", WID: "a-b-c", Language: "cobol", DateCreated: at("2021-03-02", 12)},
+			{UID: "b3", WID: "a-b-c", Language: "python", DateCreated: at("2021-02-20", 12)},
+			{UID: "template", Language: "processing", DateCreated: at("2021-03-03", 12)},
+		} {
+			require.NoError(t, d.StoreProgram(context.Background(), p))
+		}
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "alice", Programs: []string{"a1", "a2", "a3", "a4"}}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "bob", Programs: []string{"b1", "b2", "b3", "template"}}))
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, []bucket) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetClassLanguageTrend(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		var trend []bucket
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &trend))
+		}
+		return rec, trend
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		rec, _ := get(t, setup(t, ""), "uid=alice&cid=test&from=2021-03-01&to=2021-03-04")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("badRange", func(t *testing.T) {
+		d := setup(t, "")
+		for _, query := range []string{
+			"from=2021-03-04&to=2021-03-01",
+			"from=2020-01-01&to=2021-03-01",
+			"from=March&to=2021-03-01",
+			"from=2021-03-01&to=2021-03-04&bucket=year",
+		} {
+			rec, _ := get(t, d, "uid=teacher&cid=test&"+query)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		}
+	})
+	t.Run("daily", func(t *testing.T) {
+		rec, trend := get(t, setup(t, ""), "uid=teacher&cid=test&from=2021-03-01&to=2021-03-05")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []bucket{
+			{Start: "2021-03-01", Counts: counts(1, 0, 1, 0)},
+			{Start: "2021-03-02", Counts: counts(0, 0, 0, 1)},
+			{Start: "2021-03-03", Counts: counts(0, 1, 0, 0)},
+			{Start: "2021-03-04", Counts: counts(1, 0, 0, 0)},
+			{Start: "2021-03-05", Counts: counts(0, 0, 0, 0)},
+		}, trend)
+	})
+	t.Run("weekly", func(t *testing.T) {
+		rec, trend := get(t, setup(t, ""), "uid=teacher&cid=test&from=2021-02-15&to=2021-03-02&bucket=week")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []bucket{
+			{Start: "2021-02-15", Counts: counts(1, 0, 0, 0)},
+			{Start: "2021-02-22", Counts: counts(0, 0, 0, 0)},
+			{Start: "2021-03-01", Counts: counts(1, 0, 1, 1)},
+		}, trend)
+	})
+	t.Run("classZone", func(t *testing.T) {
+		// 02:00 UTC on the 4th is still the 3rd in Los Angeles.
+		rec, trend := get(t, setup(t, "America/Los_Angeles"), "uid=teacher&cid=test&from=2021-03-03&to=2021-03-04")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []bucket{
+			{Start: "2021-03-03", Counts: counts(1, 1, 0, 0)},
+			{Start: "2021-03-04", Counts: counts(0, 0, 0, 0)},
+		}, trend)
+	})
+}
+
+func TestGetClassInstructors(t *testing.T) {
+	type profile struct {
+		UID         string `json:"uid"`
+		DisplayName string `json:"displayName"`
+		Creator     bool   `json:"creator"`
+	}
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Creator:     "founder",
+			Instructors: []string{"founder", "ta", "missing"},
+			Members:     []string{"student"},
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "founder", DisplayName: "Joe Bruin"}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "ta", DisplayName: "Josephine Bruin"}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "student"}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "outsider"}))
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, uid string) (*httptest.ResponseRecorder, []profile) {
+		req := httptest.NewRequest(http.MethodGet, "/?cid=test&uid="+uid, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetClassInstructors(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		profiles := []profile{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &profiles))
+		}
+		return rec, profiles
+	}
+
+	t.Run("nonMember", func(t *testing.T) {
+		rec, _ := get(t, setup(t), "outsider")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("member", func(t *testing.T) {
+		rec, profiles := get(t, setup(t), "student")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []profile{
+			{UID: "founder", DisplayName: "Joe Bruin", Creator: true},
+			{UID: "ta", DisplayName: "Josephine Bruin"},
+		}, profiles)
+	})
+}
+
+func TestRemoveProgramFromClass(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		class := db.Class{
+			CID:         "test",
+			WID:         "a-b-c",
+			Instructors: []string{"teacher"},
+			Members:     []string{"student"},
+		}
+		class.AddProgram("a")
+		class.AddProgram("b")
+		require.NoError(t, d.StoreClass(context.Background(), class))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "a", WID: "a-b-c"}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "b", WID: "a-b-c"}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "student", Programs: []string{"a"}}))
+		return d
+	}
+	remove := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.RemoveProgramFromClass(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		rec := remove(t, setup(t), `{"uid": "student", "cid": "test", "pid": "a"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("notPresent", func(t *testing.T) {
+		rec := remove(t, setup(t), `{"uid": "teacher", "cid": "test", "pid": "c"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("remove", func(t *testing.T) {
+		d := setup(t)
+		rec := remove(t, d, `{"uid": "teacher", "cid": "test", "pid": "a"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		programs := []string{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &programs))
+		assert.Equal(t, []string{"b"}, programs)
+
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, class.Programs)
+		assert.Equal(t, 1, class.Stats.Programs)
+
+		p, err := d.LoadProgram(context.Background(), "a")
+		require.NoError(t, err)
+		assert.Empty(t, p.WID)
+		u, err := d.LoadUser(context.Background(), "student")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, u.Programs)
+	})
+}
+
+func TestGetTeacherDashboard(t *testing.T) {
+	type overview struct {
+		CID          string `json:"cid"`
+		Name         string `json:"name"`
+		Members      int    `json:"members"`
+		Programs     int    `json:"programs"`
+		LastActivity string `json:"lastActivity"`
+	}
+
+	d := db.OpenMock()
+	classes := make([]string, 0)
+	for i := 0; i < 12; i++ {
+		class := db.Class{
+			CID:         fmt.Sprintf("section%d", i),
+			Name:        fmt.Sprintf("Section %d", i),
+			Instructors: []string{"teacher"},
+		}
+		class.AddMember("student")
+		require.NoError(t, d.StoreClass(context.Background(), class))
+		classes = append(classes, class.CID)
+	}
+	require.NoError(t, d.StoreClass(context.Background(), db.Class{
+		CID:         "attended",
+		Instructors: []string{"other"},
+		Members:     []string{"teacher"},
+	}))
+	require.NoError(t, d.StoreUser(context.Background(), db.User{
+		UID:     "teacher",
+		Classes: append(classes, "attended"),
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/?uid=teacher", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	require.NoError(t, handler.GetTeacherDashboard(&db.DBContext{
+		Context: c,
+		TLADB:   d,
+	}))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	overviews := []overview{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &overviews))
+	require.Len(t, overviews, len(classes))
+	for i, o := range overviews {
+		assert.Equal(t, classes[i], o.CID)
+		assert.Equal(t, fmt.Sprintf("Section %d", i), o.Name)
+		assert.Equal(t, 1, o.Members)
+		assert.NotEmpty(t, o.LastActivity)
+	}
+}
+
+func TestSetClassTimezone(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Instructors: []string{"teacher"},
+			Members:     []string{"student"},
+		}))
+		return d
+	}
+	set := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.SetClassTimezone(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("defaultsToUTC", func(t *testing.T) {
+		class := db.Class{}
+		assert.Equal(t, time.UTC, class.Location())
+	})
+	t.Run("notInstructor", func(t *testing.T) {
+		rec := set(t, setup(t), `{"uid": "student", "cid": "test", "timezone": "America/Los_Angeles"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("invalidTimezone", func(t *testing.T) {
+		for _, tz := range []string{"Mars/Olympus_Mons", "Local"} {
+			d := setup(t)
+			rec := set(t, d, fmt.Sprintf(`{"uid": "teacher", "cid": "test", "timezone": "%s"}`, tz))
+			assert.Equal(t, http.StatusBadRequest, rec.Code, tz)
+			class, err := d.LoadClass(context.Background(), "test")
+			require.NoError(t, err)
+			assert.Empty(t, class.Timezone)
+		}
+	})
+	t.Run("validTimezone", func(t *testing.T) {
+		d := setup(t)
+		rec := set(t, d, `{"uid": "teacher", "cid": "test", "timezone": "America/Los_Angeles"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "America/Los_Angeles", class.Timezone)
+		assert.Equal(t, "America/Los_Angeles", class.Location().String())
+
+		rec = set(t, d, `{"uid": "teacher", "cid": "test", "timezone": ""}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		class, err = d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, time.UTC, class.Location())
+	})
+}
+
+func TestRenameClass(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Name:        "Intro to Pyhton",
+			Instructors: []string{"teacher"},
+			Members:     []string{"student"},
+		}))
+		return d
+	}
+	rename := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.RenameClass(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+	name := func(t *testing.T, d *db.MockDB) string {
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		return class.Name
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		d := setup(t)
+		rec := rename(t, d, `{"uid": "student", "cid": "test", "name": "Intro to Python"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, "Intro to Pyhton", name(t, d))
+	})
+	t.Run("missingClass", func(t *testing.T) {
+		rec := rename(t, setup(t), `{"uid": "teacher", "cid": "missing", "name": "Intro to Python"}`)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("emptyName", func(t *testing.T) {
+		for _, n := range []string{"", "   \t"} {
+			d := setup(t)
+			rec := rename(t, d, fmt.Sprintf(`{"uid": "teacher", "cid": "test", "name": %q}`, n))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, "Intro to Pyhton", name(t, d))
+		}
+	})
+	t.Run("tooLong", func(t *testing.T) {
+		d := setup(t)
+		long := strings.Repeat("é", db.MaxClassNameLength+1)
+		rec := rename(t, d, fmt.Sprintf(`{"uid": "teacher", "cid": "test", "name": %q}`, long))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "Intro to Pyhton", name(t, d))
+
+		// the cap is on runes, not bytes.
+		long = strings.Repeat("é", db.MaxClassNameLength)
+		rec = rename(t, d, fmt.Sprintf(`{"uid": "teacher", "cid": "test", "name": %q}`, long))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+	t.Run("renames", func(t *testing.T) {
+		d := setup(t)
+		rec := rename(t, d, `{"uid": "teacher", "cid": "test", "name": "  Intro to Python "}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Intro to Python", name(t, d))
+
+		var class db.Class
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &class))
+		assert.Equal(t, "Intro to Python", class.Name)
+		assert.Equal(t, []string{"student"}, class.Members)
+	})
+}
+
+func TestGetTemplateForkers(t *testing.T) {
+	type partition struct {
+		Forked []struct {
+			UID string `json:"uid"`
+			PID string `json:"pid"`
+		} `json:"forked"`
+		NotForked []string `json:"notForked"`
+	}
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			WID:         "a-b-c",
+			Instructors: []string{"teacher"},
+			Members:     []string{"direct", "indirect", "none", "missing"},
+		}))
+		for _, p := range []db.Program{
+			{UID: "template"},
+			{UID: "fork", ForkedFrom: "template"},
+			{UID: "forkOfFork", ForkedFrom: "fork"},
+			{UID: "unrelated"},
+		} {
+			require.NoError(t, d.StoreProgram(context.Background(), p))
+		}
+		for uid, programs := range map[string][]string{
+			"teacher":  {"template"},
+			"direct":   {"fork"},
+			"indirect": {"forkOfFork"},
+			"none":     {"unrelated"},
+		} {
+			require.NoError(t, d.StoreUser(context.Background(), db.User{UID: uid, Programs: programs}))
+		}
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, partition) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetTemplateForkers(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		p := partition{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		}
+		return rec, p
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		rec, _ := get(t, setup(t), "uid=direct&cid=test&pid=template")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("badClass", func(t *testing.T) {
+		rec, _ := get(t, setup(t), "uid=teacher&cid=nope&pid=template")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("partitioned", func(t *testing.T) {
+		rec, p := get(t, setup(t), "uid=teacher&cid=test&pid=template")
+		require.Equal(t, http.StatusOK, rec.Code)
+		if assert.Len(t, p.Forked, 2) {
+			assert.Equal(t, "direct", p.Forked[0].UID)
+			assert.Equal(t, "fork", p.Forked[0].PID)
+			assert.Equal(t, "indirect", p.Forked[1].UID)
+			assert.Equal(t, "forkOfFork", p.Forked[1].PID)
+		}
+		assert.Equal(t, []string{"none"}, p.NotForked)
+	})
+}
+
+func TestResolveJoinCode(t *testing.T) {
+	d := db.OpenMock()
+	require.NoError(t, d.StoreClass(context.Background(), db.Class{
+		CID:     "open",
+		WID:     "apple,banana,cherry",
+		Name:    "CS 31",
+		Members: []string{"a", "b"},
+	}))
+	require.NoError(t, d.StoreClass(context.Background(), db.Class{
+		CID:      "closed",
+		WID:      "date,elder,fig",
+		Archived: true,
+	}))
+	resolve := func(t *testing.T, code string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/?code="+code, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.ResolveJoinCode(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, code := range []string{"", "apple", "apple,,cherry", "apple,banana;cherry"} {
+			assert.Equal(t, http.StatusBadRequest, resolve(t, code).Code, code)
+		}
+	})
+	t.Run("unknown", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, resolve(t, "grape,honeydew,kiwi").Code)
+	})
+	t.Run("expired", func(t *testing.T) {
+		assert.Equal(t, http.StatusGone, resolve(t, "date,elder,fig").Code)
+	})
+	t.Run("valid", func(t *testing.T) {
+		rec := resolve(t, "apple,banana,cherry")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var preview struct {
+			CID     string `json:"cid"`
+			Name    string `json:"name"`
+			Members int    `json:"members"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &preview))
+		assert.Equal(t, "open", preview.CID)
+		assert.Equal(t, "CS 31", preview.Name)
+		assert.Equal(t, 2, preview.Members)
+
+		class, err := d.LoadClass(context.Background(), "open")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, class.Members)
+	})
+}
+
+func TestJoinByCode(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:     "open",
+			WID:     "apple,banana,cherry",
+			Members: []string{"a"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:      "closed",
+			WID:      "date,elder,fig",
+			Archived: true,
+		}))
+		for _, uid := range []string{"a", "b"} {
+			require.NoError(t, d.StoreUser(context.Background(), db.User{UID: uid}))
+		}
+		return d
+	}
+	join := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.JoinByCode(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		d := setup(t)
+		rec := join(t, d, `{"uid": "b", "code": "apple,banana,cherry"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		class := db.Class{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &class))
+		assert.Equal(t, "open", class.CID)
+		assert.Equal(t, []string{"a", "b"}, class.Members)
+		u, err := d.LoadUser(context.Background(), "b")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"open"}, u.Classes)
+	})
+	t.Run("caseMismatch", func(t *testing.T) {
+		d := setup(t)
+		rec := join(t, d, `{"uid": "b", "code": "Apple,BANANA,cherry"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		class, err := d.LoadClass(context.Background(), "open")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, class.Members)
+	})
+	t.Run("wrongCode", func(t *testing.T) {
+		d := setup(t)
+		assert.Equal(t, http.StatusNotFound, join(t, d, `{"uid": "b", "code": "grape,honeydew,kiwi"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, join(t, d, `{"uid": "b", "code": "apple"}`).Code)
+
+		u, err := d.LoadUser(context.Background(), "b")
+		require.NoError(t, err)
+		assert.Empty(t, u.Classes)
+	})
+	t.Run("alreadyMember", func(t *testing.T) {
+		d := setup(t)
+		assert.Equal(t, http.StatusConflict, join(t, d, `{"uid": "a", "code": "apple,banana,cherry"}`).Code)
+	})
+	t.Run("archived", func(t *testing.T) {
+		d := setup(t)
+		assert.Equal(t, http.StatusGone, join(t, d, `{"uid": "b", "code": "date,elder,fig"}`).Code)
+	})
+}
+
+func TestGetRecommendedClasses(t *testing.T) {
+	type page struct {
+		Classes []struct {
+			CID string `json:"cid"`
+		} `json:"classes"`
+		Total int `json:"total"`
+	}
+	d := db.OpenMock()
+	for _, p := range []db.Program{
+		{UID: "mine", Language: "python"},
+		{UID: "py", Language: "python"},
+		{UID: "html", Language: "html"},
+	} {
+		require.NoError(t, d.StoreProgram(context.Background(), p))
+	}
+	require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "test", Programs: []string{"mine"}}))
+	for _, class := range []db.Class{
+		{CID: "joined", Discoverable: true, Members: []string{"test"}, Programs: []string{"py"}},
+		{CID: "teaching", Discoverable: true, Instructors: []string{"test"}, Programs: []string{"py"}},
+		{CID: "hidden", Programs: []string{"py"}},
+		{CID: "archived", Discoverable: true, Archived: true, Programs: []string{"py"}},
+		{CID: "bigHTML", Discoverable: true, Members: []string{"a", "b", "c"}, Programs: []string{"html"}},
+		{CID: "smallPython", Discoverable: true, Members: []string{"a"}, Programs: []string{"py"}},
+		{CID: "bigEmpty", Discoverable: true, Members: []string{"a", "b"}},
+	} {
+		require.NoError(t, d.StoreClass(context.Background(), class))
+	}
+	get := func(t *testing.T, query string) (*httptest.ResponseRecorder, page) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetRecommendedClasses(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		p := page{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		}
+		return rec, p
+	}
+	cids := func(p page) []string {
+		res := []string{}
+		for _, c := range p.Classes {
+			res = append(res, c.CID)
+		}
+		return res
+	}
+
+	t.Run("badUser", func(t *testing.T) {
+		rec, _ := get(t, "uid=nobody")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("ranked", func(t *testing.T) {
+		rec, p := get(t, "uid=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 3, p.Total)
+		assert.Equal(t, []string{"smallPython", "bigHTML", "bigEmpty"}, cids(p))
+	})
+	t.Run("paginated", func(t *testing.T) {
+		rec, p := get(t, "uid=test&offset=1&limit=1")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 3, p.Total)
+		assert.Equal(t, []string{"bigHTML"}, cids(p))
+	})
+}
+
+func TestGetClassStorage(t *testing.T) {
+	type storage struct {
+		Total   int            `json:"total"`
+		Library int            `json:"library"`
+		Members map[string]int `json:"members"`
+	}
+	// each subtest uses its own class, since footprints are
+	// cached by cid.
+	setup := func(t *testing.T, cid string) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         cid,
+			WID:         "a-b-c",
+			Instructors: []string{"teacher"},
+			Members:     []string{"alice", "bob", "carol"},
+			Programs:    []string{"template", "alice2"},
+		}))
+		for _, p := range []db.Program{
+			{UID: "template", Code: strings.Repeat("t", 100)},
+			{UID: "alice1", WID: "a-b-c", Code: strings.Repeat("a", 10)},
+			{UID: "alice2", Code: strings.Repeat("a", 20)},
+			{UID: "aliceElsewhere", Code: strings.Repeat("a", 1000)},
+			{UID: "bob1", WID: "a-b-c", Code: strings.Repeat("b", 5)},
+		} {
+			require.NoError(t, d.StoreProgram(context.Background(), p))
+		}
+		for uid, programs := range map[string][]string{
+			"teacher": {"template"},
+			"alice":   {"alice1", "alice2", "aliceElsewhere"},
+			"bob":     {"bob1"},
+			"carol":   {},
+		} {
+			require.NoError(t, d.StoreUser(context.Background(), db.User{UID: uid, Programs: programs}))
+		}
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, storage) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetClassStorage(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		s := storage{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &s))
+		}
+		return rec, s
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		rec, _ := get(t, setup(t, "storage-forbidden"), "uid=alice&cid=storage-forbidden")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("totals", func(t *testing.T) {
+		rec, s := get(t, setup(t, "storage-totals"), "uid=teacher&cid=storage-totals")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, storage{
+			Total:   135,
+			Library: 100,
+			Members: map[string]int{"alice": 30, "bob": 5, "carol": 0},
+		}, s)
+	})
+	t.Run("cached", func(t *testing.T) {
+		d := setup(t, "storage-cached")
+		_, first := get(t, d, "uid=teacher&cid=storage-cached")
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "template"}))
+		rec, second := get(t, d, "uid=teacher&cid=storage-cached")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, first, second)
+	})
+}
+
+func TestPromoteAndDemoteInstructor(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			Creator:     "creator",
+			Instructors: []string{"creator", "ta"},
+			Members:     []string{"ta", "student", "other"},
+		}))
+		return d
+	}
+	call := func(t *testing.T, d *db.MockDB, h echo.HandlerFunc, requester, target string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"requesterUid": "%s", "targetUid": "%s", "cid": "test"}`, requester, target)
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, h(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+	load := func(t *testing.T, d *db.MockDB) db.Class {
+		class, err := d.LoadClass(context.Background(), "test")
+		require.NoError(t, err)
+		return class
+	}
+
+	t.Run("promoteByMember", func(t *testing.T) {
+		d := setup(t)
+		rec := call(t, d, handler.PromoteInstructor, "student", "other")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		class := load(t, d)
+		assert.False(t, class.IsInstructor("other"))
+	})
+	t.Run("promoteNonMember", func(t *testing.T) {
+		rec := call(t, setup(t), handler.PromoteInstructor, "creator", "stranger")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("promote", func(t *testing.T) {
+		d := setup(t)
+		rec := call(t, d, handler.PromoteInstructor, "ta", "student")
+		require.Equal(t, http.StatusOK, rec.Code)
+		class := load(t, d)
+		assert.True(t, class.IsInstructor("student"))
+		assert.True(t, class.IsMember("student"))
+	})
+	t.Run("demoteCreator", func(t *testing.T) {
+		d := setup(t)
+		rec := call(t, d, handler.DemoteInstructor, "ta", "creator")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		class := load(t, d)
+		assert.True(t, class.IsInstructor("creator"))
+	})
+	t.Run("demote", func(t *testing.T) {
+		d := setup(t)
+		rec := call(t, d, handler.DemoteInstructor, "creator", "ta")
+		require.Equal(t, http.StatusOK, rec.Code)
+		class := load(t, d)
+		assert.False(t, class.IsInstructor("ta"))
+		assert.True(t, class.IsMember("ta"))
+	})
+}
+
+func TestSubmissionTimeliness(t *testing.T) {
+	utc := func(s string) string {
+		ts, err := time.Parse("2006-01-02 15:04", s)
+		require.NoError(t, err)
+		return ts.Format(db.TimestampLayout)
+	}
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMockWith(nil, []db.Program{
+			{UID: "template"},
+			// the deadline is 07:59 UTC, the next day.
+			{UID: "earlyFork", WID: "a-b-c", ForkedFrom: "template", SavedAt: utc("2021-03-02 07:00")},
+			{UID: "tardyFork", WID: "a-b-c", ForkedFrom: "template", SavedAt: utc("2021-03-02 09:00")},
+		}, nil)
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			WID:         "a-b-c",
+			Timezone:    "America/Los_Angeles",
+			Instructors: []string{"teacher"},
+			Members:     []string{"early", "tardy", "absent"},
+			Programs:    []string{"template"},
+		}))
+		for uid, programs := range map[string][]string{
+			"teacher": {"template"},
+			"early":   {"earlyFork"},
+			"tardy":   {"tardyFork"},
+			"absent":  {},
+		} {
+			require.NoError(t, d.StoreUser(context.Background(), db.User{UID: uid, Programs: programs}))
+		}
+		return d
+	}
+	setDeadline := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.SetTemplateDeadline(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetSubmissionTimeliness(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("badDeadline", func(t *testing.T) {
+		d := setup(t)
+		rec := setDeadline(t, d, `{"uid": "teacher", "cid": "test", "pid": "template", "deadline": "March 1st"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		rec = setDeadline(t, d, `{"uid": "teacher", "cid": "test", "pid": "elsewhere", "deadline": "2021-03-01T23:59"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("noDeadline", func(t *testing.T) {
+		rec := get(t, setup(t), "uid=teacher&cid=test&pid=template")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("notInstructor", func(t *testing.T) {
+		d := setup(t)
+		rec := setDeadline(t, d, `{"uid": "early", "cid": "test", "pid": "template", "deadline": "2021-03-01T23:59"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = get(t, d, "uid=early&cid=test&pid=template")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("submissions", func(t *testing.T) {
+		d := setup(t)
+		rec := setDeadline(t, d, `{"uid": "teacher", "cid": "test", "pid": "template", "deadline": "2021-03-01T23:59"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		rec = get(t, d, "uid=teacher&cid=test&pid=template")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp struct {
+			Submissions []struct {
+				UID    string `json:"uid"`
+				PID    string `json:"pid"`
+				Status string `json:"status"`
+			} `json:"submissions"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		statuses := make(map[string]string)
+		for _, s := range resp.Submissions {
+			statuses[s.UID] = s.Status
+		}
+		assert.Equal(t, map[string]string{
+			"early":  "on time",
+			"tardy":  "late",
+			"absent": "not submitted",
+		}, statuses)
+	})
+	t.Run("unreadable", func(t *testing.T) {
+		d := setup(t)
+		rec := setDeadline(t, d, `{"uid": "teacher", "cid": "test", "pid": "template", "deadline": "2021-03-01T23:59"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		d.SetFailure("LoadProgram", fmt.Errorf("unavailable"))
+
+		rec = get(t, d, "uid=teacher&cid=test&pid=template")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp struct {
+			Submissions []struct {
+				UID    string `json:"uid"`
+				Status string `json:"status"`
+			} `json:"submissions"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		statuses := make(map[string]string)
+		for _, s := range resp.Submissions {
+			statuses[s.UID] = s.Status
+		}
+		assert.Equal(t, map[string]string{
+			"early":  "unknown",
+			"tardy":  "unknown",
+			"absent": "not submitted",
+		}, statuses)
+	})
+	t.Run("storedWithoutSaving", func(t *testing.T) {
+		// writes that do not save the program, such as an admin
+		// remapping thumbnails, do not make a submission late.
+		d := setup(t)
+		rec := setDeadline(t, d, `{"uid": "teacher", "cid": "test", "pid": "template", "deadline": "2021-03-01T23:59"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		fork, err := d.LoadProgram(context.Background(), "earlyFork")
+		require.NoError(t, err)
+		fork.Thumbnail = 3
+		require.NoError(t, d.StoreProgram(context.Background(), fork))
+
+		rec = get(t, d, "uid=teacher&cid=test&pid=template")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"uid":"early","pid":"earlyFork","updatedAt":"2021-03-01 23:00:00 -0800 PST","status":"on time"`)
+	})
+}
+
+func TestMoveClassProgram(t *testing.T) {
+	setup := func(t *testing.T, maxPrograms int) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "from",
+			WID:         "from-wid",
+			Instructors: []string{"teacher", "onlyFrom"},
+			Programs:    []string{"moving", "staying"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "to",
+			WID:         "to-wid",
+			Instructors: []string{"teacher"},
+			Programs:    []string{"existing"},
+			MaxPrograms: maxPrograms,
+		}))
+		for _, pid := range []string{"moving", "staying", "existing"} {
+			require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: pid}))
+		}
+		return d
+	}
+	move := func(t *testing.T, d *db.MockDB, uid, pid string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"uid": "%s", "fromCid": "from", "toCid": "to", "pid": "%s"}`, uid, pid)
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.MoveClassProgram(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+	load := func(t *testing.T, d *db.MockDB, cid string) db.Class {
+		class, err := d.LoadClass(context.Background(), cid)
+		require.NoError(t, err)
+		return class
+	}
+
+	t.Run("notInstructorOfBoth", func(t *testing.T) {
+		rec := move(t, setup(t, 0), "onlyFrom", "moving")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("notInSource", func(t *testing.T) {
+		d := setup(t, 0)
+		rec := move(t, d, "teacher", "elsewhere")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, []string{"existing"}, load(t, d, "to").Programs)
+	})
+	t.Run("destinationFull", func(t *testing.T) {
+		d := setup(t, 1)
+		rec := move(t, d, "teacher", "moving")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Equal(t, []string{"moving", "staying"}, load(t, d, "from").Programs)
+	})
+	t.Run("alreadyInDestination", func(t *testing.T) {
+		d := setup(t, 0)
+		to := load(t, d, "to")
+		to.Programs = append(to.Programs, "moving")
+		require.NoError(t, d.StoreClass(context.Background(), to))
+		rec := move(t, d, "teacher", "moving")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+	t.Run("programMissing", func(t *testing.T) {
+		// a dangling pid fails the whole move, as in Firestore.
+		d := setup(t, 0)
+		require.NoError(t, d.RemoveProgram(context.Background(), "moving"))
+		rec := move(t, d, "teacher", "moving")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, []string{"moving", "staying"}, load(t, d, "from").Programs)
+		assert.Equal(t, []string{"existing"}, load(t, d, "to").Programs)
+	})
+	t.Run("moved", func(t *testing.T) {
+		d := setup(t, 2)
+		rec := move(t, d, "teacher", "moving")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"staying"}, load(t, d, "from").Programs)
+		assert.Equal(t, []string{"existing", "moving"}, load(t, d, "to").Programs)
+		p, err := d.LoadProgram(context.Background(), "moving")
+		require.NoError(t, err)
+		assert.Equal(t, "to-wid", p.WID)
+	})
+}
+
+func TestGetUserClasses(t *testing.T) {
+	d := db.OpenMockWith(
+		[]db.User{{UID: "test", Classes: []string{"b", "dangling", "a"}}},
+		nil,
+		[]db.Class{{CID: "a", Name: "A"}, {CID: "b", Name: "B"}},
+	)
+	get := func(t *testing.T, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetUserClasses(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("missingUID", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get(t, "").Code)
+	})
+	t.Run("badUID", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get(t, "uid=doesnotexist").Code)
+	})
+	t.Run("danglingClass", func(t *testing.T) {
+		rec := get(t, "uid=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		resp := struct {
+			Classes []db.Class `json:"classes"`
+			Missing []string   `json:"missing"`
+		}{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp.Classes, 2)
+		assert.Equal(t, "B", resp.Classes[0].Name)
+		assert.Equal(t, "A", resp.Classes[1].Name)
+		assert.Equal(t, []string{"dangling"}, resp.Missing)
+	})
 }
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LogRequest returns middleware that writes one line per
+// handled request to out, as key=value pairs:
+//
+//  method=GET path=/program/get status=200 duration_ms=12.345
+//
+// Requests given an ID by RequestID have it appended as
+// request_id.
+//
+// The status is the one written to the client, so errors
+// returned by the handler are run through echo's error
+// handler before the line is written.
+func LogRequest(out io.Writer) echo.MiddlewareFunc {
+	return func(nxt echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := nxt(c); err != nil {
+				c.Error(err)
+			}
+			elapsed := time.Since(start)
+
+			line := fmt.Sprintf("method=%s path=%s status=%d duration_ms=%.3f",
+				c.Request().Method,
+				c.Request().URL.Path,
+				c.Response().Status,
+				float64(elapsed)/float64(time.Millisecond),
+			)
+			if id := RequestIDFromContext(c.Request().Context()); id != "" {
+				line += " request_id=" + id
+			}
+			fmt.Fprintln(out, line)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package handler_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uclaacm/teach-la-go-backend/handler"
+)
+
+func TestLogRequest(t *testing.T) {
+	serve := func(t *testing.T, h echo.HandlerFunc) (*httptest.ResponseRecorder, string) {
+		var out bytes.Buffer
+		req := httptest.NewRequest(http.MethodPost, "/program/create", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.LogRequest(&out)(h)(c))
+		return rec, out.String()
+	}
+	line := regexp.MustCompile(`^method=(\S+) path=(\S+) status=(\d+) duration_ms=\d+\.\d{3}(?: request_id=(\S+))?\n$`)
+
+	t.Run("written", func(t *testing.T) {
+		rec, out := serve(t, func(c echo.Context) error {
+			return c.String(http.StatusCreated, "")
+		})
+		require.True(t, line.MatchString(out), out)
+		m := line.FindStringSubmatch(out)
+		assert.Equal(t, http.MethodPost, m[1])
+		assert.Equal(t, "/program/create", m[2])
+		assert.Equal(t, "201", m[3])
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+	t.Run("returnedError", func(t *testing.T) {
+		rec, out := serve(t, func(c echo.Context) error {
+			return echo.ErrNotFound
+		})
+		require.True(t, line.MatchString(out), out)
+		assert.Equal(t, "404", line.FindStringSubmatch(out)[3])
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("requestID", func(t *testing.T) {
+		_, out := serve(t, handler.RequestID(func(c echo.Context) error {
+			return c.String(http.StatusOK, "")
+		}))
+		require.True(t, line.MatchString(out), out)
+		assert.NotEmpty(t, line.FindStringSubmatch(out)[4])
+	})
+}
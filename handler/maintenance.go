@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/uclaacm/teach-la-go-backend/db"
+	"github.com/uclaacm/teach-la-go-backend/httpext"
+)
+
+const (
+	// MaintenancePath is the path of the handler that toggles
+	// maintenance mode. It stays writable during maintenance.
+	MaintenancePath = "/admin/maintenance"
+
+	// maintenanceRetryAfter is the number of seconds clients
+	// are asked to wait before retrying a rejected write.
+	maintenanceRetryAfter = "120"
+)
+
+// readOnlyPosts holds the paths of handlers that take POST
+// requests but only read, such as those whose parameters are
+// sent in a request body. They are let through in maintenance
+// mode.
+var readOnlyPosts = map[string]bool{
+	"/class/get":             true,
+	"/class/members":         true,
+	"/program/validate":      true,
+	"/admin/programs/owners": true,
+}
+
+// maintenance is non-zero while the backend is in maintenance
+// mode. It only applies to this process: each instance behind
+// a load balancer has its own, and must be toggled separately.
+var maintenance int32
+
+// SetMaintenance turns maintenance mode on or off for this
+// process.
+func SetMaintenance(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&maintenance, v)
+}
+
+// InMaintenance returns whether the backend is in maintenance
+// mode.
+func InMaintenance() bool {
+	return atomic.LoadInt32(&maintenance) != 0
+}
+
+// Maintenance is middleware that rejects requests that may
+// write to the database with status 503 while the backend is
+// in maintenance mode. Reads, including the POST handlers in
+// readOnlyPosts, are always let through.
+func Maintenance(nxt echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path := c.Request().URL.Path
+		if !InMaintenance() || path == MaintenancePath {
+			return nxt(c)
+		}
+
+		switch c.Request().Method {
+		case http.MethodPost:
+			if readOnlyPosts[path] {
+				return nxt(c)
+			}
+			fallthrough
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			c.Response().Header().Set("Retry-After", maintenanceRetryAfter)
+			return c.String(http.StatusServiceUnavailable, "down for maintenance, try again later")
+		}
+		return nxt(c)
+	}
+}
+
+// SetMaintenanceMode turns maintenance mode on or off. Only
+// the instance that serves the request is affected, so behind a
+// load balancer it must reach every instance.
+//
+// Request Body:
+// {
+//     "uid": string <administrator>
+//     "enabled": bool
+// }
+//
+// Returns: Status 200 on success.
+func SetMaintenanceMode(cc echo.Context) error {
+	var req struct {
+		UID     string `json:"uid"`
+		Enabled bool   `json:"enabled"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" {
+		return c.String(http.StatusBadRequest, "uid is required")
+	}
+	if !isAdmin(c, req.UID) {
+		return c.String(http.StatusForbidden, "given user is not an administrator")
+	}
+
+	SetMaintenance(req.Enabled)
+	c.Logger().Infof("maintenance mode set to %t by `%s`", req.Enabled, req.UID)
+	return c.String(http.StatusOK, "")
+}
+
+// Health reports that the backend is up, and whether it is in
+// maintenance mode.
+//
+// Returns: Status 200 with the marshalled health status.
+func Health(c echo.Context) error {
+	resp := struct {
+		Status      string `json:"status"`
+		Maintenance bool   `json:"maintenance"`
+	}{
+		Status:      "ok",
+		Maintenance: InMaintenance(),
+	}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// Live reports that the backend process is up. It never
+// touches the database.
+//
+// Returns: Status 200.
+func Live(c echo.Context) error {
+	return c.String(http.StatusOK, "")
+}
+
+// readyTimeout bounds how long Ready waits on the database.
+const readyTimeout = 5 * time.Second
+
+// Ready reports whether the backend can reach the database.
+//
+// Returns: Status 200 with {"status": "ok"}, or 503 with the
+// error if the database could not be reached.
+func Ready(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readyTimeout)
+	defer cancel()
+	if err := c.Ping(ctx); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"status": "unavailable",
+			"error":  errors.Wrap(err, "failed to reach database").Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
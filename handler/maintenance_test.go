@@ -0,0 +1,146 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uclaacm/teach-la-go-backend/db"
+	"github.com/uclaacm/teach-la-go-backend/handler"
+)
+
+func TestMaintenance(t *testing.T) {
+	ok := func(c echo.Context) error {
+		return c.String(http.StatusOK, "")
+	}
+	serve := func(t *testing.T, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.Maintenance(ok)(c))
+		return rec
+	}
+
+	t.Run("off", func(t *testing.T) {
+		handler.SetMaintenance(false)
+		rec := serve(t, http.MethodPut, "/program/update")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+	t.Run("writesBlocked", func(t *testing.T) {
+		handler.SetMaintenance(true)
+		defer handler.SetMaintenance(false)
+
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			rec := serve(t, method, "/program/update")
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+		}
+	})
+	t.Run("readsPass", func(t *testing.T) {
+		handler.SetMaintenance(true)
+		defer handler.SetMaintenance(false)
+
+		rec := serve(t, http.MethodGet, "/program/get")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		// some reads take their parameters in a POST body.
+		for _, path := range []string{"/class/get", "/class/members", "/program/validate", "/admin/programs/owners"} {
+			rec := serve(t, http.MethodPost, path)
+			assert.Equal(t, http.StatusOK, rec.Code, path)
+		}
+	})
+	t.Run("toggleStaysWritable", func(t *testing.T) {
+		handler.SetMaintenance(true)
+		defer handler.SetMaintenance(false)
+
+		rec := serve(t, http.MethodPut, handler.MaintenancePath)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestSetMaintenanceMode(t *testing.T) {
+	defer handler.SetMaintenance(false)
+
+	d := db.OpenMock()
+	require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+	require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "user"}))
+	set := func(t *testing.T, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.SetMaintenanceMode(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+	health := func(t *testing.T) bool {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		require.NoError(t, handler.Health(echo.New().NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		resp := struct {
+			Maintenance bool `json:"maintenance"`
+		}{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp.Maintenance
+	}
+
+	t.Run("notAdmin", func(t *testing.T) {
+		rec := set(t, `{"uid": "user", "enabled": true}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.False(t, health(t))
+	})
+	t.Run("toggle", func(t *testing.T) {
+		rec := set(t, `{"uid": "admin", "enabled": true}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, health(t))
+
+		rec = set(t, `{"uid": "admin", "enabled": false}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.False(t, health(t))
+	})
+}
+
+func TestReady(t *testing.T) {
+	get := func(t *testing.T, d *db.MockDB) (int, map[string]string) {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.Ready(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		resp := make(map[string]string)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return rec.Code, resp
+	}
+
+	t.Run("reachable", func(t *testing.T) {
+		code, resp := get(t, db.OpenMock())
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "ok", resp["status"])
+	})
+	t.Run("unreachable", func(t *testing.T) {
+		d := db.OpenMock()
+		d.SetFailure("Ping", errors.New("connection refused"))
+		code, resp := get(t, d)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Contains(t, resp["error"], "connection refused")
+	})
+}
+
+func TestLive(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/livez", nil)
+	rec := httptest.NewRecorder()
+	require.NoError(t, handler.Live(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
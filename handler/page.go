@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultPageSize is the number of results returned by
+	// paginated handlers when no limit is given.
+	defaultPageSize = 20
+
+	// maxPageSize is the largest limit paginated handlers
+	// accept.
+	maxPageSize = 100
+)
+
+// pageParams reads the optional `offset` and `limit` query
+// parameters used by paginated handlers.
+func pageParams(c echo.Context) (offset, limit int, err error) {
+	offset, limit = 0, defaultPageSize
+	if o := c.QueryParam("offset"); o != "" {
+		if offset, err = strconv.Atoi(o); err != nil || offset < 0 {
+			return 0, 0, errors.New("`offset` must be a non-negative integer")
+		}
+	}
+	if l := c.QueryParam("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, errors.Errorf("`limit` must be an integer from 1 to %d", maxPageSize)
+		}
+	}
+	return offset, limit, nil
+}
+
+// page returns the bounds of the page of n results starting
+// at offset with at most limit results.
+func page(n, offset, limit int) (start, end int) {
+	if offset > n {
+		offset = n
+	}
+	end = offset + limit
+	if end > n {
+		end = n
+	}
+	return offset, end
+}
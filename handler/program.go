@@ -0,0 +1,983 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/uclaacm/teach-la-go-backend/db"
+	"github.com/uclaacm/teach-la-go-backend/httpext"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ownsProgram returns whether the user owns the program
+// with the given pid.
+func ownsProgram(u db.User, pid string) bool {
+	for _, p := range u.Programs {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// descendsFrom returns whether the program with the given
+// pid is the program ancestor, or was forked from it either
+// directly or through a chain of forks.
+func descendsFrom(c *db.DBContext, pid, ancestor string) bool {
+	seen := make(map[string]bool)
+	for pid != "" && !seen[pid] {
+		if pid == ancestor {
+			return true
+		}
+		seen[pid] = true
+
+		p, err := c.LoadProgram(c.Request().Context(), pid)
+		if err != nil {
+			return false
+		}
+		pid = p.ForkedFrom
+	}
+	return false
+}
+
+// copyName returns name suffixed with " (copy)", shortening
+// name if needed so that the result is at most max runes.
+func copyName(name string, max int) string {
+	const suffix = " (copy)"
+	r := []rune(name)
+	if n := max - utf8.RuneCountInString(suffix); len(r) > n {
+		r = r[:n]
+	}
+	return strings.TrimRightFunc(string(r), unicode.IsSpace) + suffix
+}
+
+// inClass returns whether the program is in the class library
+// or is associated to the class.
+func inClass(class db.Class, p db.Program) bool {
+	return class.HasProgram(p.UID) || (p.WID != "" && p.WID == class.WID)
+}
+
+// tokenize splits code into identifier, number, and symbol
+// tokens, dropping whitespace.
+func tokenize(code string) []string {
+	tokens := make([]string, 0)
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range code {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens = append(tokens, string(r))
+		}
+	}
+	flush()
+	return tokens
+}
+
+// similarity returns the overlap between the tokens of two
+// pieces of code as a score between 0 and 1, where 1 means
+// the code is identical ignoring whitespace.
+func similarity(a, b string) float64 {
+	ta, tb := tokenize(a), tokenize(b)
+	if len(ta)+len(tb) == 0 {
+		return 1
+	}
+
+	counts := make(map[string]int)
+	for _, t := range ta {
+		counts[t]++
+	}
+	shared := 0
+	for _, t := range tb {
+		if counts[t] > 0 {
+			counts[t]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(ta)+len(tb))
+}
+
+// GetProgramClasses lists the classes of a program's owner
+// whose libraries contain the program or a fork of it.
+//
+// Query Parameters:
+//  - uid string: UID of the program's owner
+//  - pid string: PID of the program
+//
+// Returns: Status 200 with a marshalled array of ClassSummary.
+func GetProgramClasses(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, pid := c.QueryParam("uid"), c.QueryParam("pid")
+	if uid == "" || pid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` and `pid` are required query parameters.")
+	}
+	if err := db.ValidateUID(uid); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+	if !ownsProgram(user, pid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user does not own program")
+	}
+
+	classes := make([]db.ClassSummary, 0)
+	for _, cid := range user.Classes {
+		class, err := c.LoadClass(c.Request().Context(), cid)
+		if err != nil {
+			c.Logger().Warnf("Failed to load class with cid `%s` for user with uid `%s`. User could be corrupted!", cid, uid)
+			continue
+		}
+
+		for _, p := range class.Programs {
+			if descendsFrom(c, p, pid) {
+				classes = append(classes, class.Summary())
+				break
+			}
+		}
+	}
+
+	return c.JSON(http.StatusOK, classes)
+}
+
+// GetMemberProgramForTemplate returns the user's fork of a
+// template program that is associated to a class.
+//
+// Query Parameters:
+//  - uid string: UID of the member
+//  - cid string: CID of the class
+//  - pid string: PID of the template program
+//
+// Returns: Status 200 with the marshalled fork.
+func GetMemberProgramForTemplate(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid, pid := c.QueryParam("uid"), c.QueryParam("cid"), c.QueryParam("pid")
+	if uid == "" || cid == "" || pid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid`, `cid`, and `pid` are required query parameters.")
+	}
+	if err := db.ValidateUID(uid); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.HasAccess(uid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user not in class")
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+	fork, err := forkInClass(c.Request().Context(), c, user, pid, class.WID)
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to load the user's programs").Error())
+	}
+	if fork == "" {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, "user has no fork of the program in the class")
+	}
+
+	p, err := c.LoadProgram(c.Request().Context(), fork)
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to load program").Error())
+	}
+	return c.JSON(http.StatusOK, &p)
+}
+
+// GetProgramVersion returns the version of a program and when
+// it was last saved, so that clients can check whether their
+// copy is stale without fetching the whole program. It is
+// authorized like GetProgram.
+//
+// Query Parameters:
+//  - pid string: PID of the program
+//  - uid string: UID of the requester, needed for instructor-only
+//    programs
+//  - includeDeleted bool: "true" to allow deleted programs
+//
+// Returns: Status 200 with the marshalled version, 403 if the
+// program is only visible to instructors of its class, or 404
+// if the program does not exist or has been deleted.
+func GetProgramVersion(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	pid := c.QueryParam("pid")
+	if pid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`pid` is a required query parameter.")
+	}
+
+	p, err := c.LoadProgram(c.Request().Context(), pid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "failed to locate program").Error())
+	}
+	if p.Deleted() && c.QueryParam("includeDeleted") != "true" {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, "program has been deleted")
+	}
+	if !db.CanViewProgram(c.Request().Context(), c.TLADB, c.QueryParam("uid"), p) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "program is only visible to instructors of its class")
+	}
+
+	resp := struct {
+		Version   int64  `json:"version"`
+		UpdatedAt string `json:"updatedAt"`
+	}{
+		Version:   p.Version,
+		UpdatedAt: p.LastSaved(),
+	}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// SetProgramNotes sets the notes of a program owned by the
+// given user. Surrounding whitespace is trimmed, and empty
+// notes clear the program's notes.
+//
+// Request Body:
+// {
+//     "uid": string <owner of the program>
+//     "pid": string
+//     "notes": string
+// }
+//
+// Returns: Status 200 with the marshalled program, or 413 if
+// the notes are longer than db.MaxNotesBytes.
+func SetProgramNotes(cc echo.Context) error {
+	var req struct {
+		UID   string `json:"uid"`
+		PID   string `json:"pid"`
+		Notes string `json:"notes"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.PID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and pid fields are both required")
+	}
+	if err := db.ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+	notes := strings.TrimSpace(req.Notes)
+	if len(notes) > db.MaxNotesBytes {
+		return httpext.Error(c, http.StatusRequestEntityTooLarge, httpext.CodeTooLarge, "program notes are too long")
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), req.UID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+	if !ownsProgram(user, req.PID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user does not own program")
+	}
+
+	p, err := c.LoadProgram(c.Request().Context(), req.PID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "failed to load program").Error())
+	}
+	// notes are metadata, so setting them is not a save.
+	p.Notes = notes
+	if err := c.StoreProgram(c.Request().Context(), p); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to set program notes").Error())
+	}
+
+	p, err = c.LoadProgram(c.Request().Context(), req.PID)
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to load program").Error())
+	}
+	return c.JSON(http.StatusOK, &p)
+}
+
+// RenameProgram renames a program owned by the given user.
+// If the propagate query parameter is "true", the rename is
+// also applied to forks of the program that the user owns
+// and that live in one of the user's classes. The program and
+// its forks are renamed together, or not at all. Surrounding
+// whitespace is trimmed from the name, which must not be empty
+// or longer than db.MaxProgramNameLength runes. Renaming is not
+// a save, so it leaves Version and SavedAt alone.
+//
+// Request Body:
+// {
+//     "uid": string <owner of the program>
+//     "pid": string
+//     "name": string
+// }
+//
+// Query Parameters:
+//  - propagate string: Whether to rename owned forks.
+//
+// Returns: Status 200 with a marshalled map of PIDs to the
+// renamed programs.
+func RenameProgram(cc echo.Context) error {
+	var req struct {
+		UID  string `json:"uid"`
+		PID  string `json:"pid"`
+		Name string `json:"name"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.PID == "" || req.Name == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid, pid, and name fields are all required")
+	}
+	if err := db.ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "program name cannot be empty")
+	}
+	if utf8.RuneCountInString(name) > db.MaxProgramNameLength {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, fmt.Sprintf("program name cannot be longer than %d characters", db.MaxProgramNameLength))
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), req.UID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+	if !ownsProgram(user, req.PID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user does not own program")
+	}
+
+	toRename := []string{req.PID}
+	if c.QueryParam("propagate") == "true" {
+		// only forks in the user's own classes are renamed.
+		wids := make(map[string]bool)
+		for _, cid := range user.Classes {
+			if class, err := c.LoadClass(c.Request().Context(), cid); err == nil && class.WID != "" {
+				wids[class.WID] = true
+			}
+		}
+		for _, p := range user.Programs {
+			if p == req.PID {
+				continue
+			}
+			prog, err := c.LoadProgram(c.Request().Context(), p)
+			if err != nil || !wids[prog.WID] {
+				continue
+			}
+			if descendsFrom(c, prog.ForkedFrom, req.PID) {
+				toRename = append(toRename, p)
+			}
+		}
+	}
+
+	ctx := c.Request().Context()
+	renamed := make(map[string]db.Program)
+	err = c.Transact(ctx, func(tx db.TLADB) error {
+		renamed = make(map[string]db.Program)
+		// every read is made before the first write.
+		for _, p := range toRename {
+			prog, err := tx.LoadProgram(ctx, p)
+			if err != nil {
+				return err
+			}
+			prog.Name = name
+			renamed[p] = prog
+		}
+		for _, prog := range renamed {
+			if err := tx.StoreProgram(ctx, prog); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "failed to load program").Error())
+		}
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to rename program").Error())
+	}
+
+	return c.JSON(http.StatusOK, renamed)
+}
+
+// RestoreProgram brings back a deleted program owned by the
+// given user. Restoring a program that is not deleted does
+// nothing.
+//
+// Request Body:
+// {
+//     "uid": string <owner of the program>
+//     "pid": string
+// }
+//
+// Returns: Status 200 with the marshalled program.
+func RestoreProgram(cc echo.Context) error {
+	var req struct {
+		UID string `json:"uid"`
+		PID string `json:"pid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.PID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and pid fields are both required")
+	}
+	if err := db.ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), req.UID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+	if !ownsProgram(user, req.PID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user does not own program")
+	}
+
+	p, err := c.LoadProgram(c.Request().Context(), req.PID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "failed to load program").Error())
+	}
+	if p.Deleted() {
+		p.DeletedAt = ""
+		if err := c.StoreProgram(c.Request().Context(), p); err != nil {
+			return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to restore program").Error())
+		}
+	}
+	return c.JSON(http.StatusOK, &p)
+}
+
+// CompareProgramSimilarity scores how similar the code of two
+// programs in a class is. The score is advisory only; it is
+// meant to point instructors at pairs worth a closer look.
+// Programs written in different languages are still scored,
+// but flagged as low confidence.
+//
+// Query Parameters:
+//  - uid string: UID of an instructor of the class
+//  - cid string: CID of the class both programs belong to
+//  - pid1 string: PID of the first program
+//  - pid2 string: PID of the second program
+//
+// Returns: Status 200 with the marshalled similarity score.
+func CompareProgramSimilarity(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid := c.QueryParam("uid"), c.QueryParam("cid")
+	pid1, pid2 := c.QueryParam("pid1"), c.QueryParam("pid2")
+	if uid == "" || cid == "" || pid1 == "" || pid2 == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid`, `cid`, `pid1`, and `pid2` are required query parameters.")
+	}
+	if err := db.ValidateUID(uid); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+
+	class, err := c.LoadClass(c.Request().Context(), cid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+	}
+	if !class.IsInstructor(uid) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+	}
+
+	p1, err := c.LoadProgram(c.Request().Context(), pid1)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "failed to load program").Error())
+	}
+	p2, err := c.LoadProgram(c.Request().Context(), pid2)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "failed to load program").Error())
+	}
+	if !inClass(class, p1) || !inClass(class, p2) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "both programs must belong to the class")
+	}
+
+	resp := struct {
+		Similarity    float64 `json:"similarity"`
+		LowConfidence bool    `json:"lowConfidence"`
+	}{
+		Similarity:    similarity(p1.Code, p2.Code),
+		LowConfidence: p1.Language != p2.Language,
+	}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// archivedPrograms returns the PIDs and WIDs of programs in
+// the user's archived classes.
+func archivedPrograms(c *db.DBContext, u db.User) (pids, wids map[string]bool) {
+	pids, wids = make(map[string]bool), make(map[string]bool)
+	for _, cid := range u.Classes {
+		class, err := c.LoadClass(c.Request().Context(), cid)
+		if err != nil || !class.Archived {
+			continue
+		}
+		for _, p := range class.Programs {
+			pids[p] = true
+		}
+		if class.WID != "" {
+			wids[class.WID] = true
+		}
+	}
+	return pids, wids
+}
+
+// GetUserProgramsByLanguage returns a page of the programs of
+// a user that are written in the given language. Programs in
+// archived classes are left out unless requested.
+//
+// Query Parameters:
+//  - uid string: UID of the user
+//  - language string: Language of the programs
+//  - archived string: Whether to include archived programs.
+//  - offset int: Number of programs to skip.
+//  - limit int: Most programs to return.
+//
+// Returns: Status 200 with the marshalled page of programs and
+// the total number of matching programs.
+func GetUserProgramsByLanguage(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, language := c.QueryParam("uid"), c.QueryParam("language")
+	if uid == "" || language == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` and `language` are required query parameters.")
+	}
+	if err := db.ValidateUID(uid); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+	if _, err := db.LanguageCode(language); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, err.Error())
+	}
+	offset, limit, err := pageParams(c)
+	if err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, err.Error())
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+
+	var archivedPIDs, archivedWIDs map[string]bool
+	if c.QueryParam("archived") != "true" {
+		archivedPIDs, archivedWIDs = archivedPrograms(c, user)
+	}
+
+	matching := make([]db.Program, 0)
+	for _, pid := range user.Programs {
+		p, err := c.LoadProgram(c.Request().Context(), pid)
+		if err != nil {
+			c.Logger().Warnf("Failed to load program with pid `%s` for user with uid `%s`. User could be corrupted!", pid, uid)
+			continue
+		}
+		if p.Language != language || archivedPIDs[pid] || archivedWIDs[p.WID] {
+			continue
+		}
+		matching = append(matching, p)
+	}
+
+	start, end := page(len(matching), offset, limit)
+	resp := struct {
+		Programs []db.Program `json:"programs"`
+		Total    int          `json:"total"`
+	}{
+		Programs: matching[start:end],
+		Total:    len(matching),
+	}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// programSize summarizes a program and the size of its code.
+type programSize struct {
+	PID      string `json:"pid"`
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	Bytes    int    `json:"bytes"`
+}
+
+// maxSearchResults is the most programs a search returns.
+const maxSearchResults = 50
+
+// SearchPrograms finds the programs of a user whose name
+// contains the query, ignoring case. Deleted programs are left
+// out. At most maxSearchResults programs are returned, sorted
+// by name.
+//
+// Query Parameters:
+//  - uid string: UID of the user
+//  - q string: Text to look for in program names
+//  - language string: Language of the programs, optional
+//
+// Returns: Status 200 with a marshalled array of programs.
+func SearchPrograms(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, q, language := c.QueryParam("uid"), strings.TrimSpace(c.QueryParam("q")), c.QueryParam("language")
+	if uid == "" || q == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` and `q` are required query parameters.")
+	}
+	if err := db.ValidateUID(uid); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+	if language != "" {
+		if _, err := db.LanguageCode(language); err != nil {
+			return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, err.Error())
+		}
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+	programs, err := loadUserPrograms(c, user, false)
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to load programs").Error())
+	}
+
+	q = strings.ToLower(q)
+	matching := make([]db.Program, 0)
+	for _, p := range programs {
+		if language != "" && p.Language != language {
+			continue
+		}
+		if strings.Contains(strings.ToLower(p.Name), q) {
+			matching = append(matching, p)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		a, b := strings.ToLower(matching[i].Name), strings.ToLower(matching[j].Name)
+		if a != b {
+			return a < b
+		}
+		return matching[i].UID < matching[j].UID
+	})
+	if len(matching) > maxSearchResults {
+		matching = matching[:maxSearchResults]
+	}
+	return c.JSON(http.StatusOK, matching)
+}
+
+// GetLargestPrograms returns the programs of a user, or of a
+// class if a cid is given, ordered from the largest code to
+// the smallest. Only instructors may list a class's programs.
+// Deleted programs are left out.
+//
+// Query Parameters:
+//  - uid string: UID of the user
+//  - cid string: Optional CID of a class the user instructs
+//  - offset int: Number of programs to skip.
+//  - limit int: Most programs to return.
+//
+// Returns: Status 200 with a marshalled array of program sizes.
+func GetLargestPrograms(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, cid := c.QueryParam("uid"), c.QueryParam("cid")
+	if uid == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "`uid` is a required query parameter.")
+	}
+	if err := db.ValidateUID(uid); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+	offset, limit, err := pageParams(c)
+	if err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, err.Error())
+	}
+
+	var pids []string
+	if cid != "" {
+		class, err := c.LoadClass(c.Request().Context(), cid)
+		if err != nil {
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeClassNotFound, "could not find class")
+		}
+		if !class.IsInstructor(uid) {
+			return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user is not an instructor of the class")
+		}
+		pids = class.Programs
+	} else {
+		user, err := c.LoadUser(c.Request().Context(), uid)
+		if err != nil {
+			return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+		}
+		pids = user.Programs
+	}
+
+	sizes := make([]programSize, 0, len(pids))
+	for _, pid := range pids {
+		p, err := c.LoadProgram(c.Request().Context(), pid)
+		if err != nil {
+			c.Logger().Warnf("Failed to load program with pid `%s`: %v", pid, err)
+			continue
+		}
+		if p.Deleted() {
+			continue
+		}
+		sizes = append(sizes, programSize{
+			PID:      pid,
+			Name:     p.Name,
+			Language: p.Language,
+			Bytes:    len(p.Code),
+		})
+	}
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].Bytes > sizes[j].Bytes
+	})
+
+	start, end := page(len(sizes), offset, limit)
+	return c.JSON(http.StatusOK, sizes[start:end])
+}
+
+// ValidateProgram checks a program against the rules applied
+// by /program/create without creating it, so that clients can
+// find every problem with a program up front.
+//
+// Request Body:
+// {
+//     "wid": [optional WID for the class the program would be added to]
+//     "program": {
+//         thumbnail: index of the desired thumbnail
+//         language: language string
+//         name: name of the program
+//         code: [optional code for the program]
+//     }
+// }
+//
+// Returns: Status 200 with a report if the program is valid,
+// or 400 with a report listing its problems.
+func ValidateProgram(cc echo.Context) error {
+	var req struct {
+		WID  string     `json:"wid"`
+		Prog db.Program `json:"program"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+
+	limit := db.MaxCodeBytes
+	problems := make([]string, 0)
+	if req.WID != "" {
+		class, err := c.LoadClassByWID(c.Request().Context(), req.WID)
+		if err != nil {
+			problems = append(problems, "class does not exist")
+		} else {
+			limit = class.CodeLimit()
+		}
+	}
+	problems = append(problems, db.ValidateProgram(req.Prog, limit)...)
+
+	resp := struct {
+		Valid    bool     `json:"valid"`
+		Problems []string `json:"problems"`
+	}{
+		Valid:    len(problems) == 0,
+		Problems: problems,
+	}
+	if !resp.Valid {
+		return c.JSON(http.StatusBadRequest, &resp)
+	}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// ResetProgramThumbnail sets the thumbnail of a program owned
+// by the given user to the default thumbnail of its language,
+// such as after the program's language has changed.
+//
+// Request Body:
+// {
+//     "uid": string <owner of the program>
+//     "pid": string
+// }
+//
+// Returns: Status 200 with the marshalled program.
+func ResetProgramThumbnail(cc echo.Context) error {
+	var req struct {
+		UID string `json:"uid"`
+		PID string `json:"pid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.PID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and pid fields are both required")
+	}
+	if err := db.ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), req.UID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeUserNotFound, "Failed to load user.")
+	}
+	if !ownsProgram(user, req.PID) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "given user does not own program")
+	}
+
+	p, err := c.LoadProgram(c.Request().Context(), req.PID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "failed to locate program").Error())
+	}
+	thumbnail, err := db.LanguageDefaultThumbnail(p.Language)
+	if err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, err.Error())
+	}
+
+	// the thumbnail is metadata, so resetting it is not a save.
+	p.Thumbnail = thumbnail
+	if err := c.StoreProgram(c.Request().Context(), p); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to update program").Error())
+	}
+	return c.JSON(http.StatusOK, &p)
+}
+
+// ForkProgram copies a program into a user's account, such as
+// to remix a program someone shared. The fork keeps the code,
+// language, and thumbnail of the program, and remembers which
+// program it was forked from. Its name is the program's with
+// " (copy)" added, shortened to fit db.MaxProgramNameLength.
+//
+// Request Body:
+// {
+//     "uid": string <user to fork the program to>
+//     "pid": string <program to fork>
+// }
+//
+// Returns: Status 201 with the marshalled fork, 403 if the
+// program is InstructorOnly and the user may not see it, 404 if
+// it has been deleted, or 429 if the user is creating programs
+// too quickly.
+func ForkProgram(cc echo.Context) error {
+	var req struct {
+		UID string `json:"uid"`
+		PID string `json:"pid"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInvalidBody, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.PID == "" {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "uid and pid fields are both required")
+	}
+	if err := db.ValidateUID(req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidUID, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	src, err := c.LoadProgram(ctx, req.PID)
+	if err != nil {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, errors.Wrap(err, "failed to locate program").Error())
+	}
+	if src.Deleted() {
+		return httpext.Error(c, http.StatusNotFound, httpext.CodeProgramNotFound, "program has been deleted")
+	}
+	if !db.CanViewProgram(ctx, c.TLADB, req.UID, src) {
+		return httpext.Error(c, http.StatusForbidden, httpext.CodeForbidden, "program is only visible to instructors of its class")
+	}
+	if _, err := c.LoadUser(ctx, req.UID); err != nil {
+		return httpext.Error(c, http.StatusBadRequest, httpext.CodeInvalidRequest, "Failed to load user.")
+	}
+
+	// forks count toward the same cooldown as created programs.
+	if wait := db.ProgramCreateWait(req.UID); wait > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return httpext.Error(c, http.StatusTooManyRequests, httpext.CodeRateLimited, "creating programs too quickly, try again later")
+	}
+
+	fork := db.Program{
+		Code:        src.Code,
+		Language:    src.Language,
+		Thumbnail:   src.Thumbnail,
+		Name:        copyName(src.Name, db.MaxProgramNameLength),
+		ForkedFrom:  req.PID,
+		DateCreated: time.Now().UTC().String(),
+	}
+	fork.Touch()
+
+	// the fork and the user are written together, so that a
+	// failure does not leave a fork no one owns.
+	err = c.Transact(ctx, func(tx db.TLADB) error {
+		user, err := tx.LoadUser(ctx, req.UID)
+		if err != nil {
+			return err
+		}
+		created, err := tx.InsertProgram(ctx, fork)
+		if err != nil {
+			return err
+		}
+		user.Programs = append(user.Programs, created.UID)
+		if err := tx.StoreUser(ctx, user); err != nil {
+			return err
+		}
+		fork = created
+		return nil
+	})
+	if err != nil {
+		return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, errors.Wrap(err, "failed to fork program").Error())
+	}
+	db.RecordProgramCreate(req.UID)
+
+	return c.JSON(http.StatusCreated, &fork)
+}
+
+// language describes a supported program language.
+type language struct {
+	Name        string `json:"name"`
+	Code        int    `json:"code"`
+	DefaultCode string `json:"defaultCode"`
+}
+
+// ListLanguages lists every supported program language, with
+// the code new programs in it start with, so that editors need
+// not hardcode them. Languages are sorted by name.
+//
+// Returns: Status 200 with a marshalled array of languages.
+func ListLanguages(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	resp := make([]language, 0)
+	for _, name := range db.Languages() {
+		code, err := db.LanguageCode(name)
+		if err != nil {
+			return httpext.Error(c, http.StatusInternalServerError, httpext.CodeInternal, err.Error())
+		}
+		resp = append(resp, language{
+			Name:        name,
+			Code:        code,
+			DefaultCode: db.DefaultCode(name),
+		})
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].Name < resp[j].Name })
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,1112 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uclaacm/teach-la-go-backend/db"
+	"github.com/uclaacm/teach-la-go-backend/handler"
+	"github.com/uclaacm/teach-la-go-backend/httpext"
+)
+
+func TestGetProgramClasses(t *testing.T) {
+	t.Run("MissingPID", func(t *testing.T) {
+		d := db.OpenMock()
+		req := httptest.NewRequest(http.MethodGet, "/?uid=test", nil)
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.GetProgramClasses(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+	t.Run("NotOwner", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID: "test",
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/?uid=test&pid=someoneElses", nil)
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.GetProgramClasses(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
+	t.Run("TwoClasses", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "test",
+			Programs: []string{"prog"},
+			Classes:  []string{"first", "second", "unrelated"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "prog"}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "fork", ForkedFrom: "prog"}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "other"}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:      "first",
+			Programs: []string{"prog"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:      "second",
+			Programs: []string{"other", "fork"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:      "unrelated",
+			Programs: []string{"other"},
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/?uid=test&pid=prog", nil)
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.GetProgramClasses(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			require.Equal(t, http.StatusOK, rec.Code)
+			res := []db.ClassSummary{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			require.Len(t, res, 2)
+			assert.Equal(t, "first", res[0].CID)
+			assert.Equal(t, "second", res[1].CID)
+		}
+	})
+}
+
+func TestRestoreProgram(t *testing.T) {
+	d := db.OpenMock()
+	require.NoError(t, d.StoreUser(context.Background(), db.User{
+		UID:      "owner",
+		Programs: []string{"trashed", "kept"},
+	}))
+	require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "other"}))
+	require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+		UID:       "trashed",
+		DeletedAt: time.Now().UTC().String(),
+	}))
+	require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "kept"}))
+
+	listed := func(t *testing.T) map[string]db.Program {
+		req := httptest.NewRequest(http.MethodGet, "/?uid=owner", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetUserPrograms(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		require.Equal(t, http.StatusOK, rec.Code)
+		programs := make(map[string]db.Program)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &programs))
+		return programs
+	}
+	restore := func(t *testing.T, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.RestoreProgram(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("MissingFields", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, restore(t, `{"uid": "owner"}`).Code)
+	})
+	t.Run("MalformedUID", func(t *testing.T) {
+		rec := restore(t, `{"uid": "owner/../other", "pid": "trashed"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), httpext.CodeInvalidUID)
+	})
+	t.Run("NotOwner", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, restore(t, `{"uid": "other", "pid": "trashed"}`).Code)
+	})
+	t.Run("Cycle", func(t *testing.T) {
+		assert.NotContains(t, listed(t), "trashed")
+
+		rec := restore(t, `{"uid": "owner", "pid": "trashed"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		p := db.Program{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.False(t, p.Deleted())
+
+		assert.Contains(t, listed(t), "trashed")
+		stored, err := d.LoadProgram(context.Background(), "trashed")
+		require.NoError(t, err)
+		assert.False(t, stored.Deleted())
+
+		// restoring again does nothing.
+		assert.Equal(t, http.StatusOK, restore(t, `{"uid": "owner", "pid": "trashed"}`).Code)
+	})
+}
+
+func TestRenameProgram(t *testing.T) {
+	// seed stores a user owning an original program, a fork of it
+	// in their class, and a fork in a class they are not in, plus
+	// another user owning a fork of their own.
+	seed := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:     "class",
+			WID:     "some,class,wid",
+			Members: []string{"owner", "other"},
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "owner",
+			Programs: []string{"original", "ownedFork", "strayFork"},
+			Classes:  []string{"class"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:        "strayFork",
+			Name:       "original",
+			WID:        "another,class,wid",
+			ForkedFrom: "original",
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "other",
+			Programs: []string{"otherFork"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:  "original",
+			Name: "original",
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:        "ownedFork",
+			Name:       "original",
+			WID:        "some,class,wid",
+			ForkedFrom: "original",
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:        "otherFork",
+			Name:       "original",
+			WID:        "some,class,wid",
+			ForkedFrom: "original",
+		}))
+		return d
+	}
+
+	t.Run("NotOwner", func(t *testing.T) {
+		d := seed(t)
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"other\", \"pid\": \"original\", \"name\": \"renamed\"}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.RenameProgram(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
+	t.Run("WithoutPropagate", func(t *testing.T) {
+		d := seed(t)
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"owner\", \"pid\": \"original\", \"name\": \"renamed\"}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.RenameProgram(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			require.Equal(t, http.StatusOK, rec.Code)
+			p, err := d.LoadProgram(context.Background(), "original")
+			require.NoError(t, err)
+			assert.Equal(t, "renamed", p.Name)
+			p, err = d.LoadProgram(context.Background(), "ownedFork")
+			require.NoError(t, err)
+			assert.Equal(t, "original", p.Name)
+		}
+	})
+	t.Run("WithPropagate", func(t *testing.T) {
+		d := seed(t)
+		req := httptest.NewRequest(http.MethodPut, "/?propagate=true", strings.NewReader("{\"uid\": \"owner\", \"pid\": \"original\", \"name\": \"renamed\"}"))
+		rec := httptest.NewRecorder()
+		assert.NotNil(t, req, rec)
+		c := echo.New().NewContext(req, rec)
+
+		if assert.NoError(t, handler.RenameProgram(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		})) {
+			require.Equal(t, http.StatusOK, rec.Code)
+			res := make(map[string]db.Program)
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Len(t, res, 2)
+
+			p, err := d.LoadProgram(context.Background(), "ownedFork")
+			require.NoError(t, err)
+			assert.Equal(t, "renamed", p.Name)
+			p, err = d.LoadProgram(context.Background(), "otherFork")
+			require.NoError(t, err)
+			assert.Equal(t, "original", p.Name)
+			p, err = d.LoadProgram(context.Background(), "strayFork")
+			require.NoError(t, err)
+			assert.Equal(t, "original", p.Name)
+		}
+	})
+	t.Run("StoreFails", func(t *testing.T) {
+		// nothing is renamed if any write fails.
+		d := seed(t)
+		d.SetFailure("StoreProgram", fmt.Errorf("unavailable"))
+		req := httptest.NewRequest(http.MethodPut, "/?propagate=true", strings.NewReader("{\"uid\": \"owner\", \"pid\": \"original\", \"name\": \"renamed\"}"))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.RenameProgram(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		for _, pid := range []string{"original", "ownedFork"} {
+			p, err := d.LoadProgram(context.Background(), pid)
+			require.NoError(t, err)
+			assert.Equal(t, "original", p.Name)
+		}
+	})
+	t.Run("InvalidName", func(t *testing.T) {
+		d := seed(t)
+		for _, name := range []string{"   ", strings.Repeat("a", db.MaxProgramNameLength+1)} {
+			body, err := json.Marshal(map[string]string{"uid": "owner", "pid": "original", "name": name})
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(string(body)))
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			require.NoError(t, handler.RenameProgram(&db.DBContext{
+				Context: c,
+				TLADB:   d,
+			}))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+		p, err := d.LoadProgram(context.Background(), "original")
+		require.NoError(t, err)
+		assert.Equal(t, "original", p.Name)
+	})
+	t.Run("NotSave", func(t *testing.T) {
+		// renaming must not look like new work on the program.
+		d := seed(t)
+		before, err := d.LoadProgram(context.Background(), "original")
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("{\"uid\": \"owner\", \"pid\": \"original\", \"name\": \"  renamed \"}"))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.RenameProgram(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		after, err := d.LoadProgram(context.Background(), "original")
+		require.NoError(t, err)
+		assert.Equal(t, "renamed", after.Name)
+		assert.Equal(t, before.Version, after.Version)
+		assert.Equal(t, before.SavedAt, after.SavedAt)
+	})
+}
+
+func TestCompareProgramSimilarity(t *testing.T) {
+	type score struct {
+		Similarity    float64 `json:"similarity"`
+		LowConfidence bool    `json:"lowConfidence"`
+	}
+	compare := func(t *testing.T, a, b db.Program, uid string) (*httptest.ResponseRecorder, score) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "test",
+			WID:         "a-b-c",
+			Instructors: []string{"teacher"},
+			Members:     []string{"student"},
+		}))
+		a.UID, a.WID = "a", "a-b-c"
+		b.UID, b.WID = "b", "a-b-c"
+		require.NoError(t, d.StoreProgram(context.Background(), a))
+		require.NoError(t, d.StoreProgram(context.Background(), b))
+
+		req := httptest.NewRequest(http.MethodGet, "/?cid=test&pid1=a&pid2=b&uid="+uid, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.CompareProgramSimilarity(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		s := score{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &s))
+		}
+		return rec, s
+	}
+
+	t.Run("notInstructor", func(t *testing.T) {
+		rec, _ := compare(t, db.Program{}, db.Program{}, "student")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("identical", func(t *testing.T) {
+		code := "for i in range(10):\n    print(i)\n"
+		rec, s := compare(t,
+			db.Program{Language: "python", Code: code},
+			db.Program{Language: "python", Code: code},
+			"teacher",
+		)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 1.0, s.Similarity)
+		assert.False(t, s.LowConfidence)
+	})
+	t.Run("similar", func(t *testing.T) {
+		rec, s := compare(t,
+			db.Program{Language: "python", Code: "for i in range(10):\n    print(i)\n"},
+			db.Program{Language: "python", Code: "for j in range(10):\n  print(j)"},
+			"teacher",
+		)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Greater(t, s.Similarity, 0.7)
+		assert.Less(t, s.Similarity, 1.0)
+	})
+	t.Run("dissimilar", func(t *testing.T) {
+		rec, s := compare(t,
+			db.Program{Language: "python", Code: "for i in range(10):\n    print(i)\n"},
+			db.Program{Language: "python", Code: "name = input()\nwhile name != 'quit':\n    name = input()"},
+			"teacher",
+		)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Less(t, s.Similarity, 0.5)
+	})
+	t.Run("differentLanguages", func(t *testing.T) {
+		rec, s := compare(t,
+			db.Program{Language: "python", Code: "print(1)"},
+			db.Program{Language: "cpp", Code: "print(1)"},
+			"teacher",
+		)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, s.LowConfidence)
+	})
+}
+
+func TestGetMemberProgramForTemplate(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:      "test",
+			WID:      "a-b-c",
+			Members:  []string{"student", "other"},
+			Programs: []string{"template", "fork"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "template"}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:        "fork",
+			Name:       "my copy",
+			WID:        "a-b-c",
+			ForkedFrom: "template",
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "student",
+			Programs: []string{"fork"},
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "other"}))
+		return d
+	}
+	get := func(d *db.MockDB, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		assert.NoError(t, handler.GetMemberProgramForTemplate(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("missingPID", func(t *testing.T) {
+		rec := get(setup(t), "uid=student&cid=test")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("presentFork", func(t *testing.T) {
+		rec := get(setup(t), "uid=student&cid=test&pid=template")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		p := db.Program{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Equal(t, "fork", p.UID)
+		assert.Equal(t, "my copy", p.Name)
+	})
+	t.Run("absentFork", func(t *testing.T) {
+		rec := get(setup(t), "uid=other&cid=test&pid=template")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestGetProgramVersion(t *testing.T) {
+	type version struct {
+		Version   int64  `json:"version"`
+		UpdatedAt string `json:"updatedAt"`
+	}
+	getVersion := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, version) {
+		req := httptest.NewRequest(http.MethodGet, "/?pid="+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetProgramVersion(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		v := version{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &v))
+		}
+		return rec, v
+	}
+
+	t.Run("missingProgram", func(t *testing.T) {
+		rec, _ := getVersion(t, db.OpenMock(), "invalid")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("afterUpdates", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "test",
+			Programs: []string{"test"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "test"}))
+
+		rec, before := getVersion(t, d, "test")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		for _, code := range []string{"first", "second"} {
+			p, err := d.LoadProgram(context.Background(), "test")
+			require.NoError(t, err)
+			p.Code = code
+			p.Touch()
+			require.NoError(t, d.StoreProgram(context.Background(), p))
+		}
+
+		rec, after := getVersion(t, d, "test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, before.Version+2, after.Version)
+		assert.NotEmpty(t, after.UpdatedAt)
+
+		p, err := d.LoadProgram(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, p.Version, after.Version)
+		assert.Equal(t, p.SavedAt, after.UpdatedAt)
+	})
+	t.Run("deleted", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:       "test",
+			DeletedAt: time.Now().UTC().String(),
+		}))
+
+		rec, _ := getVersion(t, d, "test")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec, _ = getVersion(t, d, "test&includeDeleted=true")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+	t.Run("instructorOnly", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "class",
+			WID:         "wid",
+			Creator:     "teacher",
+			Instructors: []string{"teacher"},
+			Members:     []string{"student"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:            "test",
+			WID:            "wid",
+			InstructorOnly: true,
+		}))
+
+		rec, _ := getVersion(t, d, "test&uid=student")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec, _ = getVersion(t, d, "test")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec, _ = getVersion(t, d, "test&uid=teacher")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestSetProgramNotes(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "owner",
+			Programs: []string{"test"},
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "other"}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:   "test",
+			Notes: "original",
+		}))
+		return d
+	}
+	setNotes := func(t *testing.T, d *db.MockDB, uid, notes string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string]string{
+			"uid":   uid,
+			"pid":   "test",
+			"notes": notes,
+		})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(string(body)))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.SetProgramNotes(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("notOwner", func(t *testing.T) {
+		d := setup(t)
+		rec := setNotes(t, d, "other", "mine now")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("set", func(t *testing.T) {
+		d := setup(t)
+		rec := setNotes(t, d, "owner", "  uses a while loop\n")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		p := db.Program{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Equal(t, "uses a while loop", p.Notes)
+
+		p, err := d.LoadProgram(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "uses a while loop", p.Notes)
+	})
+	t.Run("notSave", func(t *testing.T) {
+		// setting notes must not look like new work on the program.
+		d := setup(t)
+		before, err := d.LoadProgram(context.Background(), "test")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, setNotes(t, d, "owner", "notes").Code)
+
+		after, err := d.LoadProgram(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, before.Version, after.Version)
+		assert.Equal(t, before.SavedAt, after.SavedAt)
+	})
+	t.Run("tooLong", func(t *testing.T) {
+		d := setup(t)
+		rec := setNotes(t, d, "owner", strings.Repeat("a", db.MaxNotesBytes+1))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+		p, err := d.LoadProgram(context.Background(), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "original", p.Notes)
+	})
+}
+
+func TestGetUserProgramsByLanguage(t *testing.T) {
+	type programPage struct {
+		Programs []db.Program `json:"programs"`
+		Total    int          `json:"total"`
+	}
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		programs := map[string]db.Program{
+			"py1":      {Language: "python"},
+			"py2":      {Language: "python"},
+			"py3":      {Language: "python"},
+			"html":     {Language: "html"},
+			"archived": {Language: "python", WID: "old-class"},
+		}
+		pids := make([]string, 0)
+		for pid, p := range programs {
+			p.UID = pid
+			require.NoError(t, d.StoreProgram(context.Background(), p))
+			pids = append(pids, pid)
+		}
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:      "old",
+			WID:      "old-class",
+			Members:  []string{"test"},
+			Archived: true,
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "test",
+			Programs: pids,
+			Classes:  []string{"old"},
+		}))
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, programPage) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetUserProgramsByLanguage(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		p := programPage{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		}
+		return rec, p
+	}
+
+	t.Run("invalidLanguage", func(t *testing.T) {
+		rec, _ := get(t, setup(t), "uid=test&language=cobol")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("matchingLanguage", func(t *testing.T) {
+		rec, p := get(t, setup(t), "uid=test&language=python")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 3, p.Total)
+		for _, prog := range p.Programs {
+			assert.Equal(t, "python", prog.Language)
+			assert.NotEqual(t, "archived", prog.UID)
+		}
+	})
+	t.Run("includeArchived", func(t *testing.T) {
+		rec, p := get(t, setup(t), "uid=test&language=python&archived=true")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 4, p.Total)
+	})
+	t.Run("paginated", func(t *testing.T) {
+		d := setup(t)
+		rec, first := get(t, d, "uid=test&language=python&limit=2")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Len(t, first.Programs, 2)
+
+		rec, second := get(t, d, "uid=test&language=python&limit=2&offset=2")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Len(t, second.Programs, 1)
+		assert.NotContains(t, []string{first.Programs[0].UID, first.Programs[1].UID}, second.Programs[0].UID)
+	})
+}
+
+func TestGetLargestPrograms(t *testing.T) {
+	type programSize struct {
+		PID   string `json:"pid"`
+		Bytes int    `json:"bytes"`
+	}
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		for pid, size := range map[string]int{"small": 10, "medium": 100, "large": 1000, "tiny": 1} {
+			require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+				UID:  pid,
+				Code: strings.Repeat("a", size),
+			}))
+		}
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "test",
+			Programs: []string{"small", "large", "tiny", "medium"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "class",
+			Instructors: []string{"teacher"},
+			Members:     []string{"test"},
+			Programs:    []string{"tiny", "medium"},
+		}))
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, []programSize) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetLargestPrograms(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		sizes := []programSize{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sizes))
+		}
+		return rec, sizes
+	}
+
+	t.Run("ordering", func(t *testing.T) {
+		rec, sizes := get(t, setup(t), "uid=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Len(t, sizes, 4)
+		for i, pid := range []string{"large", "medium", "small", "tiny"} {
+			assert.Equal(t, pid, sizes[i].PID)
+		}
+		assert.Equal(t, 1000, sizes[0].Bytes)
+	})
+	t.Run("limit", func(t *testing.T) {
+		rec, sizes := get(t, setup(t), "uid=test&limit=2")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Len(t, sizes, 2)
+		assert.Equal(t, "large", sizes[0].PID)
+		assert.Equal(t, "medium", sizes[1].PID)
+	})
+	t.Run("classNotInstructor", func(t *testing.T) {
+		rec, _ := get(t, setup(t), "uid=test&cid=class")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("class", func(t *testing.T) {
+		rec, sizes := get(t, setup(t), "uid=teacher&cid=class")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Len(t, sizes, 2)
+		assert.Equal(t, "medium", sizes[0].PID)
+		assert.Equal(t, "tiny", sizes[1].PID)
+	})
+	t.Run("deleted", func(t *testing.T) {
+		d := setup(t)
+		p, err := d.LoadProgram(context.Background(), "large")
+		require.NoError(t, err)
+		p.DeletedAt = time.Now().UTC().String()
+		require.NoError(t, d.StoreProgram(context.Background(), p))
+
+		rec, sizes := get(t, d, "uid=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Len(t, sizes, 3)
+		assert.Equal(t, "medium", sizes[0].PID)
+	})
+}
+
+func TestValidateProgram(t *testing.T) {
+	type report struct {
+		Valid    bool     `json:"valid"`
+		Problems []string `json:"problems"`
+	}
+	validate := func(t *testing.T, d *db.MockDB, body string) (*httptest.ResponseRecorder, report) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.ValidateProgram(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		r := report{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+		return rec, r
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		rec, r := validate(t, db.OpenMock(), `{"program": {"language": "python", "thumbnail": 3, "code": "print('hi')"}}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, r.Valid)
+		assert.Empty(t, r.Problems)
+	})
+	t.Run("multipleProblems", func(t *testing.T) {
+		rec, r := validate(t, db.OpenMock(), `{"program": {"language": "cobol", "thumbnail": -1}}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.False(t, r.Valid)
+		assert.Len(t, r.Problems, 2)
+	})
+	t.Run("classCodeLimit", func(t *testing.T) {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:                    "test",
+			WID:                    "a-b-c",
+			MaxAssignmentCodeBytes: 4,
+		}))
+		rec, r := validate(t, d, `{"wid": "a-b-c", "program": {"language": "python", "code": "print('hi')"}}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Len(t, r.Problems, 1)
+
+		rec, r = validate(t, d, `{"wid": "x-y-z", "program": {"language": "python"}}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Len(t, r.Problems, 1)
+	})
+}
+
+func TestResetProgramThumbnail(t *testing.T) {
+	d := db.OpenMock()
+	require.NoError(t, d.StoreUser(context.Background(), db.User{
+		UID:      "owner",
+		Programs: []string{"py", "web", "bad"},
+	}))
+	require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "other"}))
+	for _, p := range []db.Program{
+		{UID: "py", Language: "python", Thumbnail: 40},
+		{UID: "web", Language: "html", Thumbnail: 40},
+		{UID: "bad", Language: "cobol", Thumbnail: 40},
+	} {
+		require.NoError(t, d.StoreProgram(context.Background(), p))
+	}
+	reset := func(t *testing.T, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.ResetProgramThumbnail(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("notOwner", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, reset(t, `{"uid": "other", "pid": "py"}`).Code)
+	})
+	t.Run("unknownLanguage", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, reset(t, `{"uid": "owner", "pid": "bad"}`).Code)
+	})
+	for pid, language := range map[string]string{"py": "python", "web": "html"} {
+		t.Run(language, func(t *testing.T) {
+			require.Equal(t, http.StatusOK, reset(t, fmt.Sprintf(`{"uid": "owner", "pid": "%s"}`, pid)).Code)
+			want, err := db.LanguageDefaultThumbnail(language)
+			require.NoError(t, err)
+			p, err := d.LoadProgram(context.Background(), pid)
+			require.NoError(t, err)
+			assert.Equal(t, want, p.Thumbnail)
+			assert.Equal(t, int64(0), p.Version)
+			assert.Empty(t, p.SavedAt)
+		})
+	}
+}
+
+func TestForkProgram(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "author", Programs: []string{"src"}}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "remixer", Programs: []string{"mine"}}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{
+			UID:       "src",
+			Name:      "Snake",
+			Code:      "print('hiss')",
+			Language:  "python",
+			Thumbnail: 7,
+			WID:       "a-b-c",
+			Notes:     "private",
+			Version:   12,
+		}))
+		return d
+	}
+	fork := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.ForkProgram(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("missingProgram", func(t *testing.T) {
+		rec := fork(t, setup(t), `{"uid": "remixer", "pid": "missing"}`)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("missingUser", func(t *testing.T) {
+		rec := fork(t, setup(t), `{"uid": "missing", "pid": "src"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+	t.Run("forks", func(t *testing.T) {
+		d := setup(t)
+		rec := fork(t, d, `{"uid": "remixer", "pid": "src"}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		var p db.Program
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.NotEmpty(t, p.UID)
+		assert.NotEqual(t, "src", p.UID)
+		assert.Equal(t, "Snake (copy)", p.Name)
+		assert.Equal(t, "print('hiss')", p.Code)
+		assert.Equal(t, "python", p.Language)
+		assert.Equal(t, int64(7), p.Thumbnail)
+		assert.Equal(t, "src", p.ForkedFrom)
+		assert.Empty(t, p.WID)
+		assert.Empty(t, p.Notes)
+		assert.Equal(t, int64(1), p.Version)
+
+		stored, err := d.LoadProgram(context.Background(), p.UID)
+		require.NoError(t, err)
+		assert.Equal(t, p, stored)
+		u, err := d.LoadUser(context.Background(), "remixer")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mine", p.UID}, u.Programs)
+		author, err := d.LoadUser(context.Background(), "author")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"src"}, author.Programs)
+	})
+	t.Run("instructorOnly", func(t *testing.T) {
+		d := setup(t)
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "class",
+			WID:         "a-b-c",
+			Instructors: []string{"teacher"},
+			Members:     []string{"remixer"},
+		}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "teacher"}))
+		src, err := d.LoadProgram(context.Background(), "src")
+		require.NoError(t, err)
+		src.InstructorOnly = true
+		require.NoError(t, d.StoreProgram(context.Background(), src))
+
+		rec := fork(t, d, `{"uid": "remixer", "pid": "src"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = fork(t, d, `{"uid": "teacher", "pid": "src"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		rec = fork(t, d, `{"uid": "author", "pid": "src"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+	t.Run("deleted", func(t *testing.T) {
+		d := setup(t)
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "late"}))
+		src, err := d.LoadProgram(context.Background(), "src")
+		require.NoError(t, err)
+		src.DeletedAt = time.Now().UTC().String()
+		require.NoError(t, d.StoreProgram(context.Background(), src))
+
+		rec := fork(t, d, `{"uid": "late", "pid": "src"}`)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("longName", func(t *testing.T) {
+		// the copy of a program with the longest allowed name
+		// must still have a valid name.
+		d := setup(t)
+		src, err := d.LoadProgram(context.Background(), "src")
+		require.NoError(t, err)
+		src.Name = strings.Repeat("é", db.MaxProgramNameLength)
+		require.NoError(t, d.StoreProgram(context.Background(), src))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "verbose"}))
+
+		rec := fork(t, d, `{"uid": "verbose", "pid": "src"}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		var p db.Program
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		assert.Equal(t, db.MaxProgramNameLength, utf8.RuneCountInString(p.Name))
+		assert.True(t, strings.HasSuffix(p.Name, " (copy)"))
+		assert.NoError(t, p.Validate())
+	})
+	t.Run("throttled", func(t *testing.T) {
+		d := setup(t)
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "eager"}))
+		rec := fork(t, d, `{"uid": "eager", "pid": "src"}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		rec = fork(t, d, `{"uid": "eager", "pid": "src"}`)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+		u, err := d.LoadUser(context.Background(), "eager")
+		require.NoError(t, err)
+		assert.Len(t, u.Programs, 1)
+	})
+	t.Run("storeFails", func(t *testing.T) {
+		// a fork is not left behind without an owner, nor
+		// does the failure start the cooldown.
+		d := setup(t)
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "unlucky"}))
+		d.SetFailure("StoreUser", fmt.Errorf("unavailable"))
+		rec := fork(t, d, `{"uid": "unlucky", "pid": "src"}`)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		d.SetFailure("StoreUser", nil)
+		rec = fork(t, d, `{"uid": "unlucky", "pid": "src"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		u, err := d.LoadUser(context.Background(), "unlucky")
+		require.NoError(t, err)
+		assert.Len(t, u.Programs, 1)
+	})
+}
+
+func TestListLanguages(t *testing.T) {
+	type language struct {
+		Name        string `json:"name"`
+		Code        int    `json:"code"`
+		DefaultCode string `json:"defaultCode"`
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	require.NoError(t, handler.ListLanguages(&db.DBContext{
+		Context: c,
+		TLADB:   db.OpenMock(),
+	}))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var languages []language
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &languages))
+	names := make([]string, 0)
+	for _, l := range languages {
+		names = append(names, l.Name)
+		code, err := db.LanguageCode(l.Name)
+		require.NoError(t, err)
+		assert.Equal(t, code, l.Code, l.Name)
+		assert.Equal(t, db.DefaultCode(l.Name), l.DefaultCode, l.Name)
+	}
+	assert.Equal(t, []string{"html", "processing", "python", "react"}, names)
+}
+
+func TestSearchPrograms(t *testing.T) {
+	programs := []db.Program{
+		{UID: "a", Name: "Turtle Race", Language: "python"},
+		{UID: "b", Name: "my turtle", Language: "processing"},
+		{UID: "c", Name: "Snake", Language: "python"},
+		{UID: "d", Name: "old turtle", Language: "python", DeletedAt: "yesterday"},
+	}
+	pids := []string{"a", "b", "c", "d"}
+	for i := 0; i < maxSearchResultsForTest+5; i++ {
+		pid := fmt.Sprintf("many%02d", i)
+		programs = append(programs, db.Program{UID: pid, Name: fmt.Sprintf("bulk %02d", i), Language: "html"})
+		pids = append(pids, pid)
+	}
+	d := db.OpenMockWith([]db.User{{UID: "test", Programs: pids}}, programs, nil)
+
+	search := func(t *testing.T, query string) (int, []db.Program) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.SearchPrograms(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		found := make([]db.Program, 0)
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &found))
+		}
+		return rec.Code, found
+	}
+	names := func(programs []db.Program) []string {
+		n := make([]string, 0, len(programs))
+		for _, p := range programs {
+			n = append(n, p.Name)
+		}
+		return n
+	}
+
+	t.Run("MissingQuery", func(t *testing.T) {
+		code, _ := search(t, "uid=test")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+	t.Run("UnknownLanguage", func(t *testing.T) {
+		code, _ := search(t, "uid=test&q=turtle&language=cobol")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+	t.Run("CaseInsensitive", func(t *testing.T) {
+		code, found := search(t, "uid=test&q=TURTLE")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"my turtle", "Turtle Race"}, names(found))
+	})
+	t.Run("Language", func(t *testing.T) {
+		code, found := search(t, "uid=test&q=turtle&language=python")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"Turtle Race"}, names(found))
+	})
+	t.Run("Capped", func(t *testing.T) {
+		code, found := search(t, "uid=test&q=bulk")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, found, maxSearchResultsForTest)
+		assert.Equal(t, "bulk 00", found[0].Name)
+	})
+}
+
+// maxSearchResultsForTest mirrors the cap on search results.
+const maxSearchResultsForTest = 50
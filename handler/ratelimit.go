@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// rateLimitSweepInterval is how often idle buckets are
+	// dropped from a rate limiter.
+	rateLimitSweepInterval = time.Minute
+
+	// maxRateLimitBuckets caps how many clients a rate limiter
+	// keeps a bucket for. Once it is reached, new clients share
+	// the overflow bucket until idle buckets are swept.
+	maxRateLimitBuckets = 100000
+
+	// overflowBucket is the key of the bucket shared by clients
+	// seen while a rate limiter is full.
+	overflowBucket = "overflow"
+)
+
+// bucket is a token bucket for a single client.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds a token bucket for every client seen
+// recently.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// allow takes a token from the bucket for key. If the bucket
+// is empty, it returns false and how long until a token is
+// available.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	if _, ok := l.buckets[key]; !ok && len(l.buckets) >= maxRateLimitBuckets {
+		l.sweep(now)
+		if len(l.buckets) >= maxRateLimitBuckets {
+			key = overflowBucket
+		}
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// newRateLimiter returns a rateLimiter allowing rps requests
+// per second to each client, with bursts of up to burst.
+func newRateLimiter(rps, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:      float64(rps),
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// sweep drops every bucket that has refilled completely, since
+// such a bucket is no different from a new one.
+func (l *rateLimiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// RateLimit returns middleware that allows each client IP rps
+// requests per second, with bursts of up to burst requests.
+// Requests over the limit are rejected with status 429 and a
+// Retry-After header.
+//
+// The client IP is found by the IPExtractor of the server,
+// which should be ClientIPExtractor.
+func RateLimit(rps, burst int) echo.MiddlewareFunc {
+	l := newRateLimiter(rps, burst)
+
+	return func(nxt echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ok, wait := l.allow(c.RealIP(), time.Now())
+			if ok {
+				return nxt(c)
+			}
+
+			retry := int(math.Ceil(wait.Seconds()))
+			if retry < 1 {
+				retry = 1
+			}
+			c.Response().Header().Set("Retry-After", strconv.Itoa(retry))
+			return c.String(http.StatusTooManyRequests, "too many requests, try again later")
+		}
+	}
+}
+
+// ClientIPExtractor returns the echo.IPExtractor that finds the
+// IP of a client, as rate limits are keyed on. The client is the
+// nearest address in X-Forwarded-For that was not added by a
+// trusted proxy, so that clients cannot choose their own IP by
+// sending the header themselves.
+//
+// Proxies on loopback, link-local, and private addresses are
+// trusted, along with those in trusted, a comma-separated list
+// of CIDR ranges such as "35.191.0.0/16,130.211.0.0/22".
+func ClientIPExtractor(trusted string) (echo.IPExtractor, error) {
+	var opts []echo.TrustOption
+	for _, cidr := range strings.Split(trusted, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid trusted proxy range")
+		}
+		opts = append(opts, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...), nil
+}
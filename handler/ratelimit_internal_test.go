@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterCap(t *testing.T) {
+	// the clock is fixed, so no bucket refills or is swept while
+	// the limiter fills up, however long that takes.
+	l := newRateLimiter(1, 1)
+	now := l.lastSweep
+	for i := 0; i < maxRateLimitBuckets; i++ {
+		ok, _ := l.allow(fmt.Sprintf("client%d", i), now)
+		assert.True(t, ok)
+	}
+	assert.Len(t, l.buckets, maxRateLimitBuckets)
+
+	// once the limiter is full, new clients share a bucket
+	// rather than growing it further.
+	ok, _ := l.allow("new1", now)
+	assert.True(t, ok)
+	ok, wait := l.allow("new2", now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	assert.Len(t, l.buckets, maxRateLimitBuckets+1)
+
+	// idle buckets are swept once they have refilled, making room
+	// for new clients again.
+	ok, _ = l.allow("new3", now.Add(rateLimitSweepInterval))
+	assert.True(t, ok)
+	assert.Len(t, l.buckets, 1)
+}
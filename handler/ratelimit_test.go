@@ -0,0 +1,83 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uclaacm/teach-la-go-backend/handler"
+)
+
+func TestRateLimit(t *testing.T) {
+	ok := func(c echo.Context) error {
+		return c.String(http.StatusOK, "")
+	}
+	serve := func(t *testing.T, h echo.HandlerFunc, forwarded, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/program/get", nil)
+		if forwarded != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, forwarded)
+		}
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, h(c))
+		return rec
+	}
+
+	t.Run("overLimit", func(t *testing.T) {
+		h := handler.RateLimit(1, 3)(ok)
+		for i := 0; i < 3; i++ {
+			rec := serve(t, h, "1.1.1.1", "10.0.0.1:1234")
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		rec := serve(t, h, "1.1.1.1", "10.0.0.1:1234")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	})
+	t.Run("perClient", func(t *testing.T) {
+		h := handler.RateLimit(1, 1)(ok)
+		assert.Equal(t, http.StatusOK, serve(t, h, "1.1.1.1, 10.0.0.1", "10.0.0.1:1234").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(t, h, "1.1.1.1", "10.0.0.1:1234").Code)
+		assert.Equal(t, http.StatusOK, serve(t, h, "2.2.2.2", "10.0.0.1:1234").Code)
+	})
+	t.Run("spoofedForwardedFor", func(t *testing.T) {
+		// only the entry added by the trusted proxy is used, so
+		// a client cannot pick a fresh IP for each request.
+		extractor, err := handler.ClientIPExtractor("")
+		require.NoError(t, err)
+		e := echo.New()
+		e.IPExtractor = extractor
+		h := handler.RateLimit(1, 1)(ok)
+		serve := func(forwarded string) int {
+			req := httptest.NewRequest(http.MethodGet, "/program/get", nil)
+			req.Header.Set(echo.HeaderXForwardedFor, forwarded)
+			req.RemoteAddr = "10.0.0.1:1234"
+			rec := httptest.NewRecorder()
+			require.NoError(t, h(e.NewContext(req, rec)))
+			return rec.Code
+		}
+		assert.Equal(t, http.StatusOK, serve("6.6.6.6, 1.1.1.1"))
+		assert.Equal(t, http.StatusTooManyRequests, serve("7.7.7.7, 1.1.1.1"))
+		assert.Equal(t, http.StatusOK, serve("6.6.6.6, 2.2.2.2"))
+	})
+	t.Run("trustedRanges", func(t *testing.T) {
+		_, err := handler.ClientIPExtractor("not a range")
+		assert.Error(t, err)
+
+		extractor, err := handler.ClientIPExtractor("35.191.0.0/16, 130.211.0.0/22")
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderXForwardedFor, "6.6.6.6, 1.1.1.1, 35.191.0.9")
+		req.RemoteAddr = "130.211.0.1:1234"
+		assert.Equal(t, "1.1.1.1", extractor(req))
+	})
+	t.Run("remoteAddr", func(t *testing.T) {
+		h := handler.RateLimit(1, 1)(ok)
+		assert.Equal(t, http.StatusOK, serve(t, h, "", "3.3.3.3:1234").Code)
+		assert.Equal(t, http.StatusTooManyRequests, serve(t, h, "", "3.3.3.3:5678").Code)
+		assert.Equal(t, http.StatusOK, serve(t, h, "", "4.4.4.4:1234").Code)
+	})
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// requestIDKey is the context key under which RequestID
+// stores the ID of a request.
+type requestIDKey struct{}
+
+// requestIDPattern matches the incoming request IDs that are
+// passed through. Anything else is replaced, so that clients
+// cannot inject arbitrary text into the logs.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID is middleware that gives every request an ID,
+// so that log lines about the same request can be correlated.
+// The ID from an incoming X-Request-ID header is kept if it is
+// well formed; otherwise a new UUID is generated. The ID is
+// stored in the request context and echoed in the X-Request-ID
+// response header.
+func RequestID(nxt echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Request().Header.Get(echo.HeaderXRequestID)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+
+		ctx := context.WithValue(c.Request().Context(), requestIDKey{}, id)
+		c.SetRequest(c.Request().WithContext(ctx))
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+		return nxt(c)
+	}
+}
+
+// RequestIDFromContext returns the ID that RequestID gave the
+// request with the given context, or "" if it has none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,61 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uclaacm/teach-la-go-backend/handler"
+)
+
+func TestRequestID(t *testing.T) {
+	serve := func(t *testing.T, incoming string) (*httptest.ResponseRecorder, string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if incoming != "" {
+			req.Header.Set(echo.HeaderXRequestID, incoming)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+
+		var seen string
+		require.NoError(t, handler.RequestID(func(c echo.Context) error {
+			seen = handler.RequestIDFromContext(c.Request().Context())
+			return c.String(http.StatusOK, "")
+		})(c))
+		return rec, seen
+	}
+
+	t.Run("generated", func(t *testing.T) {
+		rec, seen := serve(t, "")
+		_, err := uuid.Parse(seen)
+		assert.NoError(t, err, seen)
+		assert.Equal(t, seen, rec.Header().Get(echo.HeaderXRequestID))
+
+		// each request gets its own ID.
+		_, other := serve(t, "")
+		assert.NotEqual(t, seen, other)
+	})
+	t.Run("passedThrough", func(t *testing.T) {
+		rec, seen := serve(t, "upstream-1234")
+		assert.Equal(t, "upstream-1234", seen)
+		assert.Equal(t, "upstream-1234", rec.Header().Get(echo.HeaderXRequestID))
+	})
+	t.Run("malformed", func(t *testing.T) {
+		for _, incoming := range []string{"has space", "new\nline", strings.Repeat("a", 129)} {
+			rec, seen := serve(t, incoming)
+			assert.NotEqual(t, incoming, seen)
+			_, err := uuid.Parse(seen)
+			assert.NoError(t, err, seen)
+			assert.Equal(t, seen, rec.Header().Get(echo.HeaderXRequestID))
+		}
+	})
+	t.Run("missing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.Empty(t, handler.RequestIDFromContext(req.Context()))
+	})
+}
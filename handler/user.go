@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
 	"github.com/uclaacm/teach-la-go-backend/db"
+	"github.com/uclaacm/teach-la-go-backend/httpext"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -47,20 +53,66 @@ func GetUser(cc echo.Context) error {
 
 	// Get programs, if requested.
 	if programsRequested != "" {
-		for _, p := range resp.UserData.Programs {
-			// If error in retrieving a given program, ignore it.
-			currentProg, err := c.LoadProgram(c.Request().Context(), p)
-			if err != nil {
-				c.Logger().Warnf("Failed to load program with pid `%s` for user with uid `%s`. User could be corrupted!", p, uid)
-				continue
-			}
-
-			resp.Programs[p] = currentProg
+		if resp.Programs, err = loadUserPrograms(c, user, false); err != nil {
+			return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to load programs").Error())
 		}
 	}
 	return c.JSON(http.StatusOK, &resp)
 }
 
+// loadUserPrograms loads all of the user's programs in one
+// read, keyed by pid. Programs that fail to load are left out,
+// as are deleted programs unless includeDeleted is set.
+func loadUserPrograms(c *db.DBContext, user db.User, includeDeleted bool) (map[string]db.Program, error) {
+	programs, err := c.LoadPrograms(c.Request().Context(), user.Programs)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(programs))
+	loaded := make(map[string]db.Program, len(programs))
+	for _, p := range programs {
+		found[p.UID] = true
+		if !p.Deleted() || includeDeleted {
+			loaded[p.UID] = p
+		}
+	}
+	for _, pid := range user.Programs {
+		if !found[pid] {
+			c.Logger().Warnf("Failed to load program with pid `%s` for user with uid `%s`. User could be corrupted!", pid, user.UID)
+		}
+	}
+	return loaded, nil
+}
+
+// GetUserPrograms returns all of a user's programs.
+//
+// Query Parameters:
+//  - uid string: UID of the user
+//  - includeDeleted string: Whether to include deleted programs.
+//
+// Returns: Status 200 with the marshalled programs, keyed by
+// pid. Programs that could not be loaded are left out.
+func GetUserPrograms(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid := c.QueryParam("uid")
+	if uid == "" {
+		return c.String(http.StatusBadRequest, "`uid` is a required query parameter.")
+	}
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		c.Logger().Debugf("Failed to load user with uid `%s`: %v", uid, err)
+		return c.String(http.StatusNotFound, "Failed to load user.")
+	}
+
+	programs, err := loadUserPrograms(c, user, c.QueryParam("includeDeleted") == "true")
+	if err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to load programs").Error())
+	}
+	return c.JSON(http.StatusOK, &programs)
+}
+
 // DeleteUser deletes an user along with all their programs
 // from the database.
 //
@@ -109,3 +161,378 @@ func DeleteUser(cc echo.Context) error {
 
 	return c.String(http.StatusOK, "user deleted successfully")
 }
+
+// exportedClass describes a user's membership in a class in
+// their data export.
+type exportedClass struct {
+	db.ClassSummary
+	Instructor bool `json:"instructor"`
+}
+
+// ExportUserData returns all of the data kept about a user as
+// a single JSON document: their profile, their programs, and
+// the classes they belong to. A user may export their own
+// data, and administrators may export anyone's. Every export
+// is logged.
+//
+// The document is streamed, so a failure partway through
+// leaves it truncated rather than returning an error status.
+//
+// Query Parameters:
+//  - uid string: UID of the user to export
+//  - requester string: UID of the user asking for the export
+//
+// Returns: Status 200 with the exported JSON document.
+func ExportUserData(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, requester := c.QueryParam("uid"), c.QueryParam("requester")
+	if uid == "" || requester == "" {
+		return c.String(http.StatusBadRequest, "`uid` and `requester` are required query parameters.")
+	}
+	if requester != uid && !isAdmin(c, requester) {
+		return c.String(http.StatusForbidden, "only the user or an administrator may export their data")
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Failed to load user.")
+	}
+	c.Logger().Infof("data of user `%s` exported by `%s`", uid, requester)
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	w.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", uid+".json"))
+	w.WriteHeader(http.StatusOK)
+
+	// write the document piece by piece, stopping at the
+	// first failure.
+	enc := json.NewEncoder(w)
+	var werr error
+	write := func(s string) {
+		if werr == nil {
+			_, werr = w.Write([]byte(s))
+		}
+	}
+	encode := func(v interface{}) {
+		if werr == nil {
+			werr = enc.Encode(v)
+		}
+		w.Flush()
+	}
+
+	write(`{"profile":`)
+	encode(&user)
+
+	write(`,"programs":[`)
+	n := 0
+	for _, pid := range user.Programs {
+		p, err := c.LoadProgram(c.Request().Context(), pid)
+		if err != nil {
+			c.Logger().Warnf("Failed to load program with pid `%s` for user with uid `%s`. User could be corrupted!", pid, uid)
+			continue
+		}
+		if n > 0 {
+			write(",")
+		}
+		encode(&p)
+		n++
+	}
+
+	write(`],"classes":[`)
+	n = 0
+	for _, cid := range user.Classes {
+		class, err := c.LoadClass(c.Request().Context(), cid)
+		if err != nil {
+			c.Logger().Warnf("Failed to load class with cid `%s` for user with uid `%s`. User could be corrupted!", cid, uid)
+			continue
+		}
+		if n > 0 {
+			write(",")
+		}
+		encode(&exportedClass{
+			ClassSummary: class.Summary(),
+			Instructor:   class.IsInstructor(uid),
+		})
+		n++
+	}
+	write("]}")
+
+	return werr
+}
+
+// EraseUserData permanently removes a user and everything that
+// refers to them: their programs, their membership and
+// instructorship in classes, and their profile. Unlike
+// DeleteUser, nothing is left behind. A user may erase their
+// own data, and administrators may erase anyone's. Classes the
+// user created are handed to another of their instructors, or
+// left without a creator if they have none. To guard
+// against accidents, the request must repeat the uid being
+// erased as a confirmation. Every erasure is logged.
+//
+// Request Body:
+// {
+//     "uid": REQUIRED, the user to erase
+//     "requester": REQUIRED, the user asking for the erasure
+//     "confirm": REQUIRED, must match uid
+// }
+//
+// Returns: Status 200 on erasure.
+func EraseUserData(cc echo.Context) error {
+	var req struct {
+		UID       string `json:"uid"`
+		Requester string `json:"requester"`
+		Confirm   string `json:"confirm"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.Requester == "" {
+		return c.String(http.StatusBadRequest, "uid and requester are required")
+	}
+	if req.Confirm != req.UID {
+		return c.String(http.StatusBadRequest, "confirm must match the uid being erased")
+	}
+	if req.Requester != req.UID && !isAdmin(c, req.Requester) {
+		return c.String(http.StatusForbidden, "only the user or an administrator may erase their data")
+	}
+
+	ctx := c.Request().Context()
+	user, err := c.LoadUser(ctx, req.UID)
+	if err != nil {
+		return c.String(http.StatusNotFound, "could not find user")
+	}
+	c.Logger().Infof("data of user `%s` erased by `%s`", req.UID, req.Requester)
+
+	// collect every class that may refer to the user or one of
+	// their programs.
+	classes := make(map[string]db.Class)
+	for _, cid := range user.Classes {
+		if class, err := c.LoadClass(ctx, cid); err == nil {
+			classes[class.CID] = class
+		}
+	}
+	for _, pid := range user.Programs {
+		p, err := c.LoadProgram(ctx, pid)
+		if err != nil || p.WID == "" {
+			continue
+		}
+		if class, err := c.LoadClassByWID(ctx, p.WID); err == nil {
+			if _, ok := classes[class.CID]; !ok {
+				classes[class.CID] = class
+			}
+		}
+	}
+
+	for _, class := range classes {
+		changed := class.RemoveMember(user.UID)
+		changed = class.RemoveInstructor(user.UID) || changed
+		for _, pid := range user.Programs {
+			changed = class.RemoveProgram(pid) || changed
+		}
+		if class.Creator == user.UID {
+			// hand the class to another instructor, so that it
+			// can still be deleted. Classes without one are left
+			// to administrators.
+			class.Creator = ""
+			if len(class.Instructors) > 0 {
+				class.Creator = class.Instructors[0]
+			}
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := c.StoreClass(ctx, class); err != nil {
+			return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to erase user").Error())
+		}
+	}
+
+	for _, pid := range user.Programs {
+		if err := c.RemoveProgram(ctx, pid); err != nil && status.Code(err) != codes.NotFound {
+			return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to erase user").Error())
+		}
+	}
+
+	if err := c.DeleteUser(ctx, user.UID); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to erase user").Error())
+	}
+
+	return c.String(http.StatusOK, "user erased successfully")
+}
+
+// streak describes a run of consecutive days on which a user
+// created or saved a program.
+type streak struct {
+	Current    int    `json:"current"`
+	Longest    int    `json:"longest"`
+	LastActive string `json:"lastActive"`
+}
+
+// computeStreak computes the streaks in a set of active
+// dates, formatted as "2006-01-02", as of the given date.
+// The current streak is still alive if the last active day
+// was today or yesterday.
+func computeStreak(active map[string]bool, today string) streak {
+	const layout = "2006-01-02"
+
+	days := make([]time.Time, 0, len(active))
+	for d := range active {
+		if t, err := time.Parse(layout, d); err == nil {
+			days = append(days, t)
+		}
+	}
+	if len(days) == 0 {
+		return streak{}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	s, run := streak{}, 0
+	for i, d := range days {
+		if i > 0 && days[i-1].AddDate(0, 0, 1).Equal(d) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > s.Longest {
+			s.Longest = run
+		}
+	}
+
+	last := days[len(days)-1]
+	s.LastActive = last.Format(layout)
+	if now, err := time.Parse(layout, today); err == nil && !last.AddDate(0, 0, 1).Before(now) {
+		s.Current = run
+	}
+	return s
+}
+
+// GetUserStreak returns a user's current and longest streaks
+// of consecutive days on which they created or saved a
+// program. Days are taken in the user's time zone. Programs
+// keep no edit history, so only the day each program was
+// created and the day it was last saved count.
+//
+// Query Parameters:
+//  - uid string: UID of the user
+//  - requester string: UID of the user asking, which must be uid
+//
+// Returns: Status 200 with the marshalled streak.
+func GetUserStreak(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, requester := c.QueryParam("uid"), c.QueryParam("requester")
+	if uid == "" || requester == "" {
+		return c.String(http.StatusBadRequest, "`uid` and `requester` are required query parameters.")
+	}
+	if requester != uid {
+		return c.String(http.StatusForbidden, "users may only view their own streak")
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Failed to load user.")
+	}
+	activity, err := c.LoadProgramActivity(c.Request().Context(), user.Programs)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to load programs").Error())
+	}
+
+	loc := user.Location()
+	active := make(map[string]bool)
+	for _, a := range activity {
+		for _, ts := range []string{a.DateCreated, a.LastSaved()} {
+			if d := day(ts, loc); d != "" {
+				active[d] = true
+			}
+		}
+	}
+
+	s := computeStreak(active, time.Now().In(loc).Format("2006-01-02"))
+	return c.JSON(http.StatusOK, &s)
+}
+
+// GetNotificationPrefs returns a user's notification
+// preferences. Users who have not set them get the defaults
+// described on db.NotificationPrefs.
+//
+// Query Parameters:
+//  - uid string: UID of the user
+//  - requester string: UID of the user asking, which must be uid
+//
+// Returns: Status 200 with the marshalled preferences.
+func GetNotificationPrefs(cc echo.Context) error {
+	c := cc.(*db.DBContext)
+
+	uid, requester := c.QueryParam("uid"), c.QueryParam("requester")
+	if uid == "" || requester == "" {
+		return c.String(http.StatusBadRequest, "`uid` and `requester` are required query parameters.")
+	}
+	if requester != uid {
+		return c.String(http.StatusForbidden, "users may only view their own notification preferences")
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), uid)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Failed to load user.")
+	}
+
+	prefs := user.Notifications()
+	return c.JSON(http.StatusOK, &prefs)
+}
+
+// SetNotificationPrefs updates some of a user's notification
+// preferences. Preferences left out of the request keep their
+// current values. If any key is unknown, nothing is changed.
+//
+// Request Body:
+// {
+//     "uid": REQUIRED, UID of the user
+//     "requester": REQUIRED, UID of the user asking, which must be uid
+//     "prefs": REQUIRED, map of preference keys to whether they are on,
+//              such as { "comment": false }
+// }
+//
+// Returns: Status 200 with the marshalled preferences.
+func SetNotificationPrefs(cc echo.Context) error {
+	var req struct {
+		UID       string          `json:"uid"`
+		Requester string          `json:"requester"`
+		Prefs     map[string]bool `json:"prefs"`
+	}
+
+	c := cc.(*db.DBContext)
+
+	if err := httpext.RequestBodyTo(c.Request(), &req); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to read request body").Error())
+	}
+	if req.UID == "" || req.Requester == "" || len(req.Prefs) == 0 {
+		return c.String(http.StatusBadRequest, "uid, requester, and prefs fields are all required")
+	}
+	if req.Requester != req.UID {
+		return c.String(http.StatusForbidden, "users may only change their own notification preferences")
+	}
+
+	user, err := c.LoadUser(c.Request().Context(), req.UID)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Failed to load user.")
+	}
+
+	prefs := user.Notifications()
+	for key, on := range req.Prefs {
+		if err := prefs.Set(key, on); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	user.NotificationPrefs = &prefs
+	if err := c.StoreUser(c.Request().Context(), user); err != nil {
+		return c.String(http.StatusInternalServerError, errors.Wrap(err, "failed to update user").Error())
+	}
+
+	return c.JSON(http.StatusOK, &prefs)
+}
@@ -3,9 +3,12 @@ package handler_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -133,6 +136,46 @@ func TestGetUser(t *testing.T) {
 	})
 }
 
+func TestGetUserPrograms(t *testing.T) {
+	d := db.OpenMock()
+	require.NoError(t, d.StoreUser(context.Background(), db.User{
+		UID:      "test",
+		Programs: []string{"a", "missing", "b"},
+	}))
+	for _, pid := range []string{"a", "b"} {
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: pid, Name: pid}))
+	}
+
+	get := func(t *testing.T, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetUserPrograms(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("MissingUID", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get(t, "").Code)
+	})
+	t.Run("BadUID", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get(t, "uid=doesnotexist").Code)
+	})
+	t.Run("PartialMiss", func(t *testing.T) {
+		rec := get(t, "uid=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		programs := make(map[string]db.Program)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &programs))
+		assert.Len(t, programs, 2)
+		assert.Equal(t, "a", programs["a"].Name)
+		assert.Equal(t, "b", programs["b"].Name)
+		assert.NotContains(t, programs, "missing")
+	})
+}
+
 func TestDeleteUser(t *testing.T) {
 	t.Run("MissingUID", func(t *testing.T) {
 		d := db.OpenMock()
@@ -218,3 +261,334 @@ func TestDeleteUser(t *testing.T) {
 		}
 	})
 }
+
+func TestExportUserData(t *testing.T) {
+	d := db.OpenMock()
+	require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+	require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "other"}))
+	require.NoError(t, d.StoreUser(context.Background(), db.User{
+		UID:         "test",
+		DisplayName: "Joe Bruin",
+		Programs:    []string{"p1", "p2"},
+		Classes:     []string{"c1"},
+	}))
+	require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "p1", Name: "first"}))
+	require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "p2", Name: "second"}))
+	require.NoError(t, d.StoreClass(context.Background(), db.Class{
+		CID:         "c1",
+		Name:        "CS 31",
+		Instructors: []string{"admin"},
+		Members:     []string{"test"},
+	}))
+
+	export := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.ExportUserData(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("MissingParams", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, export("uid=test").Code)
+	})
+	t.Run("Forbidden", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, export("uid=test&requester=other").Code)
+	})
+	t.Run("BadUID", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, export("uid=doesnotexist&requester=admin").Code)
+	})
+	for _, requester := range []string{"test", "admin"} {
+		t.Run("By_"+requester, func(t *testing.T) {
+			rec := export("uid=test&requester=" + requester)
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var bundle struct {
+				Profile  db.User      `json:"profile"`
+				Programs []db.Program `json:"programs"`
+				Classes  []struct {
+					CID        string `json:"cid"`
+					Instructor bool   `json:"instructor"`
+				} `json:"classes"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &bundle))
+			assert.Equal(t, "Joe Bruin", bundle.Profile.DisplayName)
+			if assert.Len(t, bundle.Programs, 2) {
+				assert.Equal(t, "first", bundle.Programs[0].Name)
+				assert.Equal(t, "second", bundle.Programs[1].Name)
+			}
+			if assert.Len(t, bundle.Classes, 1) {
+				assert.Equal(t, "c1", bundle.Classes[0].CID)
+				assert.False(t, bundle.Classes[0].Instructor)
+			}
+		})
+	}
+}
+
+func TestEraseUserData(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "admin", Admin: true}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "other", Programs: []string{"p3"}}))
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "test",
+			Programs: []string{"p1", "p2"},
+			Classes:  []string{"c1", "c2", "c3"},
+		}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "p1", WID: "w1"}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "p2"}))
+		require.NoError(t, d.StoreProgram(context.Background(), db.Program{UID: "p3", WID: "w1"}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "c1",
+			WID:         "w1",
+			Instructors: []string{"other"},
+			Members:     []string{"test", "other"},
+			Programs:    []string{"p1", "p3"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "c2",
+			WID:         "w2",
+			Creator:     "test",
+			Instructors: []string{"test"},
+		}))
+		require.NoError(t, d.StoreClass(context.Background(), db.Class{
+			CID:         "c3",
+			WID:         "w3",
+			Creator:     "test",
+			Instructors: []string{"test", "other"},
+		}))
+		return d
+	}
+	erase := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.EraseUserData(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("MissingConfirm", func(t *testing.T) {
+		d := setup(t)
+		rec := erase(t, d, `{"uid": "test", "requester": "test"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		_, err := d.LoadUser(context.Background(), "test")
+		assert.NoError(t, err)
+	})
+	t.Run("Forbidden", func(t *testing.T) {
+		d := setup(t)
+		rec := erase(t, d, `{"uid": "test", "requester": "other", "confirm": "test"}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("BadUID", func(t *testing.T) {
+		d := setup(t)
+		rec := erase(t, d, `{"uid": "nobody", "requester": "admin", "confirm": "nobody"}`)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	for _, requester := range []string{"test", "admin"} {
+		t.Run("By_"+requester, func(t *testing.T) {
+			d := setup(t)
+			rec := erase(t, d, fmt.Sprintf(`{"uid": "test", "requester": "%s", "confirm": "test"}`, requester))
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			// profile
+			_, err := d.LoadUser(context.Background(), "test")
+			assert.Error(t, err)
+
+			// programs
+			for _, pid := range []string{"p1", "p2"} {
+				_, err := d.LoadProgram(context.Background(), pid)
+				assert.Error(t, err, pid)
+			}
+			_, err = d.LoadProgram(context.Background(), "p3")
+			assert.NoError(t, err)
+
+			// class references
+			c1, err := d.LoadClass(context.Background(), "c1")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"other"}, c1.Members)
+			assert.Equal(t, []string{"p3"}, c1.Programs)
+			c2, err := d.LoadClass(context.Background(), "c2")
+			require.NoError(t, err)
+			assert.Empty(t, c2.Instructors)
+			assert.Empty(t, c2.Creator)
+			// classes with another instructor are handed to them.
+			c3, err := d.LoadClass(context.Background(), "c3")
+			require.NoError(t, err)
+			assert.Equal(t, "other", c3.Creator)
+		})
+	}
+}
+
+func TestGetUserStreak(t *testing.T) {
+	type streak struct {
+		Current    int    `json:"current"`
+		Longest    int    `json:"longest"`
+		LastActive string `json:"lastActive"`
+	}
+	now := time.Now().UTC()
+	daysAgo := func(n int) time.Time { return now.AddDate(0, 0, -n) }
+
+	setup := func(t *testing.T, timezone string, programs ...db.Program) *db.MockDB {
+		// programs are seeded as they are, since storing them
+		// would refresh their UpdatedAt.
+		pids := []string{}
+		for i := range programs {
+			programs[i].UID = fmt.Sprintf("p%d", i)
+			pids = append(pids, programs[i].UID)
+		}
+		d := db.OpenMockWith(nil, programs, nil)
+		require.NoError(t, d.StoreUser(context.Background(), db.User{
+			UID:      "test",
+			Programs: pids,
+			Timezone: timezone,
+		}))
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, streak) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetUserStreak(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		s := streak{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &s))
+		}
+		return rec, s
+	}
+	created := func(t time.Time) db.Program {
+		return db.Program{DateCreated: t.Format(db.TimestampLayout)}
+	}
+
+	t.Run("notSelf", func(t *testing.T) {
+		rec, _ := get(t, setup(t, ""), "uid=test&requester=other")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("noActivity", func(t *testing.T) {
+		rec, s := get(t, setup(t, ""), "uid=test&requester=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, streak{}, s)
+	})
+	t.Run("consecutive", func(t *testing.T) {
+		d := setup(t, "",
+			created(daysAgo(0)),
+			db.Program{
+				DateCreated: daysAgo(2).Format(db.TimestampLayout),
+				UpdatedAt:   daysAgo(1).Format(db.TimestampLayout),
+			},
+			created(daysAgo(10)),
+			created(daysAgo(11)),
+			created(daysAgo(12)),
+			created(daysAgo(13)),
+		)
+		rec, s := get(t, d, "uid=test&requester=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, streak{
+			Current:    3,
+			Longest:    4,
+			LastActive: now.Format("2006-01-02"),
+		}, s)
+	})
+	t.Run("gapped", func(t *testing.T) {
+		d := setup(t, "", created(daysAgo(3)), created(daysAgo(5)))
+		rec, s := get(t, d, "uid=test&requester=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, streak{
+			Current:    0,
+			Longest:    1,
+			LastActive: daysAgo(3).Format("2006-01-02"),
+		}, s)
+	})
+	t.Run("userTimezone", func(t *testing.T) {
+		// 01:00 UTC is still the previous day twelve hours west.
+		early := time.Date(now.Year(), now.Month(), now.Day(), 1, 0, 0, 0, time.UTC)
+		d := setup(t, "Etc/GMT+12", created(early))
+		rec, s := get(t, d, "uid=test&requester=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, early.AddDate(0, 0, -1).Format("2006-01-02"), s.LastActive)
+	})
+}
+
+func TestNotificationPrefs(t *testing.T) {
+	setup := func(t *testing.T) *db.MockDB {
+		d := db.OpenMock()
+		require.NoError(t, d.StoreUser(context.Background(), db.User{UID: "test"}))
+		return d
+	}
+	get := func(t *testing.T, d *db.MockDB, query string) (*httptest.ResponseRecorder, db.NotificationPrefs) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.GetNotificationPrefs(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+
+		p := db.NotificationPrefs{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+		}
+		return rec, p
+	}
+	set := func(t *testing.T, d *db.MockDB, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		require.NoError(t, handler.SetNotificationPrefs(&db.DBContext{
+			Context: c,
+			TLADB:   d,
+		}))
+		return rec
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		rec, p := get(t, setup(t), "uid=test&requester=test")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, db.DefaultNotificationPrefs(), p)
+	})
+	t.Run("notSelf", func(t *testing.T) {
+		d := setup(t)
+		rec, _ := get(t, d, "uid=test&requester=other")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = set(t, d, `{"uid": "test", "requester": "other", "prefs": {"comment": false}}`)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+	t.Run("missingUser", func(t *testing.T) {
+		rec, _ := get(t, setup(t), "uid=missing&requester=missing")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("unknownKey", func(t *testing.T) {
+		d := setup(t)
+		rec := set(t, d, `{"uid": "test", "requester": "test", "prefs": {"comment": false, "sms": true}}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		_, p := get(t, d, "uid=test&requester=test")
+		assert.Equal(t, db.DefaultNotificationPrefs(), p)
+	})
+	t.Run("subset", func(t *testing.T) {
+		d := setup(t)
+		rec := set(t, d, `{"uid": "test", "requester": "test", "prefs": {"comment": false}}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		_, p := get(t, d, "uid=test&requester=test")
+		assert.False(t, p.Comment)
+		assert.True(t, p.ClassInvite)
+		assert.True(t, p.Deadline)
+
+		rec = set(t, d, `{"uid": "test", "requester": "test", "prefs": {"deadline": false}}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		_, p = get(t, d, "uid=test&requester=test")
+		assert.False(t, p.Comment)
+		assert.True(t, p.ClassInvite)
+		assert.False(t, p.Deadline)
+	})
+}
@@ -0,0 +1,45 @@
+package httpext
+
+import "github.com/labstack/echo/v4"
+
+// Error codes identify the kind of an error response, so that
+// clients need not parse its message. They never change once
+// published.
+const (
+	CodeInvalidBody     = "INVALID_BODY"
+	CodeInvalidRequest  = "INVALID_REQUEST"
+	CodeInvalidUID      = "INVALID_UID"
+	CodeUnauthorized    = "UNAUTHORIZED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeUserNotFound    = "USER_NOT_FOUND"
+	CodeClassNotFound   = "CLASS_NOT_FOUND"
+	CodeProgramNotFound = "PROGRAM_NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodeGone            = "GONE"
+	CodeTooLarge        = "TOO_LARGE"
+	CodeRateLimited     = "RATE_LIMITED"
+	CodeTimeout         = "TIMEOUT"
+	CodeInternal        = "INTERNAL"
+)
+
+// ErrorBody is the body of an error response.
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes what went wrong in a request.
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error responds to the request with the given status and a
+// JSON body holding the error code and message:
+//
+//  {"error": {"code": "CLASS_NOT_FOUND", "message": "..."}}
+func Error(c echo.Context, status int, code, message string) error {
+	return c.JSON(status, &ErrorBody{
+		Error: ErrorDetail{Code: code, Message: message},
+	})
+}
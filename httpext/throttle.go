@@ -0,0 +1,97 @@
+package httpext
+
+import (
+	"sync"
+	"time"
+)
+
+// Throttle enforces a cooldown between actions taken under
+// the same key, such as a user's ID. It is safe for
+// concurrent use.
+type Throttle struct {
+	cooldown time.Duration
+
+	mu        sync.Mutex
+	last      map[string]time.Time
+	nextSweep time.Time
+}
+
+// NewThrottle returns a Throttle that allows one action per
+// key every cooldown. A cooldown of zero allows every action.
+func NewThrottle(cooldown time.Duration) *Throttle {
+	return &Throttle{
+		cooldown: cooldown,
+		last:     make(map[string]time.Time),
+	}
+}
+
+// Allow reports whether an action under the given key may
+// happen now, recording it if so. If it may not, Allow also
+// returns how long remains until it may.
+func (t *Throttle) Allow(key string) (bool, time.Duration) {
+	if t.cooldown <= 0 {
+		return true, 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if wait := t.wait(key, now); wait > 0 {
+		return false, wait
+	}
+	t.last[key] = now
+	return true, 0
+}
+
+// Wait returns how long remains until an action under the
+// given key may happen, or zero if it may happen now. Unlike
+// Allow, it does not record the action; Record should be called
+// once the action has succeeded, so that failed attempts do not
+// use up the cooldown.
+func (t *Throttle) Wait(key string) time.Duration {
+	if t.cooldown <= 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.wait(key, time.Now())
+}
+
+// Record records that an action under the given key happened
+// now, starting its cooldown.
+func (t *Throttle) Record(key string) {
+	if t.cooldown <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last[key] = time.Now()
+}
+
+// wait is Wait for callers already holding t.mu.
+func (t *Throttle) wait(key string, now time.Time) time.Duration {
+	t.sweep(now)
+	if last, ok := t.last[key]; ok {
+		if wait := t.cooldown - now.Sub(last); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// sweep evicts keys whose cooldown has passed, at most once
+// per cooldown. t.mu must be held.
+func (t *Throttle) sweep(now time.Time) {
+	if now.Before(t.nextSweep) {
+		return
+	}
+	for key, last := range t.last {
+		if now.Sub(last) >= t.cooldown {
+			delete(t.last, key)
+		}
+	}
+	t.nextSweep = now.Add(t.cooldown)
+}
@@ -0,0 +1,48 @@
+package httpext_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uclaacm/teach-la-go-backend/httpext"
+)
+
+func TestThrottle(t *testing.T) {
+	t.Run("Cooldown", func(t *testing.T) {
+		th := httpext.NewThrottle(time.Hour)
+		ok, _ := th.Allow("a")
+		assert.True(t, ok)
+		ok, wait := th.Allow("a")
+		assert.False(t, ok)
+		assert.Greater(t, int64(wait), int64(0))
+
+		ok, _ = th.Allow("b")
+		assert.True(t, ok)
+	})
+	t.Run("Expiry", func(t *testing.T) {
+		th := httpext.NewThrottle(10 * time.Millisecond)
+		ok, _ := th.Allow("a")
+		assert.True(t, ok)
+		time.Sleep(20 * time.Millisecond)
+		ok, _ = th.Allow("a")
+		assert.True(t, ok)
+	})
+	t.Run("WaitThenRecord", func(t *testing.T) {
+		th := httpext.NewThrottle(time.Hour)
+		// waiting alone does not start the cooldown.
+		assert.Zero(t, th.Wait("a"))
+		assert.Zero(t, th.Wait("a"))
+		th.Record("a")
+		assert.Greater(t, int64(th.Wait("a")), int64(0))
+		ok, _ := th.Allow("a")
+		assert.False(t, ok)
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		th := httpext.NewThrottle(0)
+		for i := 0; i < 3; i++ {
+			ok, _ := th.Allow("a")
+			assert.True(t, ok)
+		}
+	})
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	_ "github.com/heroku/x/hmetrics/onload"
@@ -18,6 +21,31 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
+// shutdownTimeout is how long in-flight requests are given to
+// finish when the server is asked to stop.
+const shutdownTimeout = 15 * time.Second
+
+// defaultPort is the port served on when neither the PORT
+// variable nor the port flag give a valid one.
+const defaultPort = "8081"
+
+// validPort returns whether port is a legal TCP port number.
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// resolvePort picks the port to serve on: the PORT variable
+// if it is valid, then the port flag, then defaultPort.
+func resolvePort(env, flag string) string {
+	for _, port := range []string{env, flag} {
+		if validPort(port) {
+			return port
+		}
+	}
+	return defaultPort
+}
+
 func serve(c *cli.Context) error {
 	e := echo.New()
 	e.HideBanner = true
@@ -26,15 +54,29 @@ func serve(c *cli.Context) error {
 		e.Logger.SetLevel(log.DEBUG)
 	}
 
+	// rate limits are keyed on the client IP, so only trust
+	// X-Forwarded-For entries added by our own proxies.
+	extractor, ipErr := handler.ClientIPExtractor(os.Getenv("TRUSTED_PROXIES"))
+	if ipErr != nil {
+		e.Logger.Fatal(ipErr)
+		return ipErr
+	}
+	e.IPExtractor = extractor
+
 	// middleware
-	e.Use(middleware.Logger())
+	e.Use(handler.RequestID)
+	e.Use(handler.LogRequest(os.Stdout))
 	e.Use(middleware.Recover())
+	e.Use(handler.RateLimit(10, 20))
+	e.Use(handler.MaxBodyBytes(handler.DefaultMaxBodyBytes))
 	e.Use(middleware.Gzip())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
 		AllowHeaders: []string{echo.HeaderContentType},
 		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
 	}))
+	e.Use(handler.Maintenance)
+	handler.SetMaintenance(os.Getenv("MAINTENANCE_MODE") == "true")
 
 	// Check for working credentials in the following partial order:
 	// - JSON
@@ -60,8 +102,6 @@ func serve(c *cli.Context) error {
 		e.Logger.Fatal(errors.Wrap(err, "failed to open connection to firestore"))
 		return err
 	}
-	defer d.Close()
-
 	// Register our database handler to every Echo context.
 	e.Use(func(nxt echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -72,35 +112,96 @@ func serve(c *cli.Context) error {
 		}
 	})
 
+	// health check
+	e.GET("/health", handler.Health)
+	e.GET("/healthz", handler.Ready)
+	e.GET("/livez", handler.Live)
+
 	// user management
 	e.GET("/user/get", handler.GetUser)
+	e.GET("/user/programs", handler.GetUserPrograms)
+	e.GET("/user/classes", handler.GetUserClasses)
 	e.PUT("/user/update", d.UpdateUser)
 	e.POST("/user/create", d.CreateUser)
+	e.GET("/user/export", handler.ExportUserData)
+	e.DELETE("/user/erase", handler.EraseUserData)
+	e.GET("/user/streak", handler.GetUserStreak)
+	e.GET("/user/notifications", handler.GetNotificationPrefs)
+	e.PUT("/user/notifications", handler.SetNotificationPrefs)
 
 	// program management
 	e.GET("/program/get", d.GetProgram)
 	e.PUT("/program/update", d.UpdateProgram)
 	e.POST("/program/create", d.CreateProgram)
+	e.POST("/program/validate", handler.ValidateProgram)
 	e.DELETE("/program/delete", d.DeleteProgram)
+	e.GET("/program/classes", handler.GetProgramClasses)
+	e.PUT("/program/rename", handler.RenameProgram)
+	e.PUT("/program/restore", handler.RestoreProgram)
+	e.GET("/program/similarity", handler.CompareProgramSimilarity)
+	e.GET("/program/template", handler.GetMemberProgramForTemplate)
+	e.GET("/program/version", handler.GetProgramVersion)
+	e.PUT("/program/notes", handler.SetProgramNotes)
+	e.GET("/program/language", handler.GetUserProgramsByLanguage)
+	e.GET("/program/largest", handler.GetLargestPrograms)
+	e.PUT("/program/thumbnail/reset", handler.ResetProgramThumbnail)
+	e.POST("/program/fork", handler.ForkProgram)
+	e.GET("/program/languages", handler.ListLanguages)
+	e.GET("/program/search", handler.SearchPrograms)
 
 	// class management
 	e.POST("/class/get", handler.GetClass)
 	e.POST("/class/create", d.CreateClass)
 	e.PUT("/class/join", d.JoinClass)
+	e.PUT("/class/join/code", handler.JoinByCode)
 	e.PUT("/class/leave", d.LeaveClass)
 	e.POST("/class/members", d.GetClassMembers)
+	e.PUT("/class/archive", handler.ArchiveClassPrograms)
+	e.PUT("/class/codelimit", handler.SetClassCodeLimit)
+	e.GET("/class/card", handler.GetClassCard)
+	e.POST("/class/distribute", handler.DistributeToMembers)
+	e.POST("/class/enroll", handler.EnrollStudents)
+	e.PUT("/class/members/remove", handler.RemoveStudent)
+	e.GET("/class/shared", handler.GetSharedClasses)
+	e.GET("/class/summary", handler.GetClassSummary)
+	e.PUT("/class/summary/rebuild", handler.RebuildClassSummary)
+	e.POST("/class/copy", handler.CopyClassSettings)
+	e.POST("/class/clone", handler.CopyClass)
+	e.GET("/class/engagement", handler.GetClassEngagement)
+	e.GET("/class/languages/trend", handler.GetClassLanguageTrend)
+	e.GET("/class/instructors", handler.GetClassInstructors)
+	e.PUT("/class/program/remove", handler.RemoveProgramFromClass)
+	e.GET("/class/dashboard", handler.GetTeacherDashboard)
+	e.PUT("/class/timezone", handler.SetClassTimezone)
+	e.PUT("/class/rename", handler.RenameClass)
+	e.GET("/class/forkers", handler.GetTemplateForkers)
+	e.GET("/class/resolve", handler.ResolveJoinCode)
+	e.GET("/class/recommended", handler.GetRecommendedClasses)
+	e.GET("/class/storage", handler.GetClassStorage)
+	e.DELETE("/class/delete", handler.DeleteClass)
+	e.PUT("/class/instructors/promote", handler.PromoteInstructor)
+	e.PUT("/class/instructors/demote", handler.DemoteInstructor)
+	e.PUT("/class/deadline", handler.SetTemplateDeadline)
+	e.GET("/class/timeliness", handler.GetSubmissionTimeliness)
+	e.PUT("/class/program/move", handler.MoveClassProgram)
+
+	// admin management
+	e.PUT("/admin/thumbnails", handler.RemapThumbnails)
+	e.POST("/admin/classes", handler.BatchCreateClasses)
+	e.GET("/admin/classes", handler.ListAllClasses)
+	e.PUT("/admin/programs/languages", handler.AuditProgramLanguages)
+	e.PUT("/admin/classes/joincodes", handler.FindJoinCodeCollisions)
+	e.POST("/admin/programs/owners", handler.ResolveProgramOwners)
+	e.PUT("/admin/users/displaynames", handler.BackfillDisplayNameKeys)
+	e.PUT(handler.MaintenancePath, handler.SetMaintenanceMode)
 
 	// collaborative coding management
 	e.POST("/collab/create", d.CreateCollab)
 	e.GET("/collab/join/:id", d.JoinCollab)
 
 	// check for PORT variable.
-	var port string
-	if osPort := os.Getenv("PORT"); osPort != "" {
-		port = osPort
-	} else {
-		port = c.String("port")
-	}
+	port := resolvePort(os.Getenv("PORT"), c.String("port"))
+	e.Logger.Printf("listening on port %s", port)
 
 	// server configuration
 	s := &http.Server{
@@ -109,7 +210,28 @@ func serve(c *cli.Context) error {
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
-	e.Logger.Fatal(e.StartServer(s))
+	go func() {
+		if err := e.StartServer(s); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(errors.Wrap(err, "failed to start server"))
+		}
+	}()
+
+	// on SIGINT or SIGTERM, let in-flight requests finish
+	// before closing the database, so writes are not cut off.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	sig := <-quit
+
+	e.Logger.Printf("received %v, shutting down", sig)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		e.Logger.Error(errors.Wrap(err, "failed to shut down server gracefully"))
+	}
+	if err := d.Close(); err != nil {
+		e.Logger.Error(errors.Wrap(err, "failed to close connection to firestore"))
+	}
+	e.Logger.Printf("shutdown complete")
 
 	return nil
 }
@@ -155,7 +277,7 @@ func main() {
 			&cli.StringFlag{
 				Name:    "port",
 				Aliases: []string{"p"},
-				Value:   "8081",
+				Value:   defaultPort,
 				Usage:   "Change the port number",
 			},
 		},
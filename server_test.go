@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePort(t *testing.T) {
+	assert.Equal(t, "5000", resolvePort("5000", "8082"))
+	assert.Equal(t, "8082", resolvePort("", "8082"))
+	assert.Equal(t, defaultPort, resolvePort("", ""))
+	for _, invalid := range []string{"0", "65536", "-1", "http", ":8080"} {
+		assert.Equal(t, "8082", resolvePort(invalid, "8082"), invalid)
+		assert.Equal(t, defaultPort, resolvePort(invalid, invalid), invalid)
+	}
+}